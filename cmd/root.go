@@ -8,8 +8,11 @@ import (
 	_ "github.com/dysodeng/devops-tools/internal/module"
 	"github.com/dysodeng/devops-tools/internal/module/container"
 	"github.com/dysodeng/devops-tools/internal/module/kubernetes"
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
 	"github.com/dysodeng/devops-tools/internal/module/system"
 	"github.com/dysodeng/devops-tools/internal/module/version"
+	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
 )
 
@@ -18,16 +21,50 @@ var rootCmd = &cobra.Command{
 	Short:   "运维工具箱",
 	Long:    "运维工具箱",
 	Version: fmt.Sprintf("%s\n", version.Version()),
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		pkg.SetRoot(rootDir)
+		if err := mirror.Setup(mirrorName, mirrorConfig); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		manifests.SetOverrideDir(manifestDir)
+		if dryRun {
+			pkg.EnableDryRun(os.Stdout)
+		}
+		if err := system.CheckRequirements(cmd); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
 	Run: func(cmd *cobra.Command, args []string) {
 		_ = cmd.Help()
 	},
 }
 
+var (
+	// dryRun 预演模式，仅打印执行计划
+	dryRun bool
+	// rootDir 目标根目录，用于制作离线镜像或chroot环境
+	rootDir string
+	// mirrorName 镜像源
+	mirrorName string
+	// mirrorConfig 镜像源配置文件
+	mirrorConfig string
+	// manifestDir 资源清单覆盖目录
+	manifestDir string
+)
+
 func init() {
+	rootCmd.PersistentFlags().BoolVarP(&dryRun, "dry-run", "", false, "仅打印将要执行的命令与写入的文件，不修改主机")
+	rootCmd.PersistentFlags().StringVarP(&rootDir, "root", "", "/", "目标根目录，所有文件操作与命令都将在该目录下进行")
+	rootCmd.PersistentFlags().StringVarP(&mirrorName, "mirror", "", mirror.Aliyun, "镜像源: "+mirror.Usage())
+	rootCmd.PersistentFlags().StringVarP(&mirrorConfig, "mirror-config", "", "", "镜像源配置文件(yaml)，其中的配置项覆盖所选镜像源")
+	rootCmd.PersistentFlags().StringVarP(&manifestDir, "manifest-dir", "", "", "资源清单覆盖目录，其中的同名文件优先于内置资源清单")
 	rootCmd.AddCommand(version.Cmd)
 	rootCmd.AddCommand(system.Cmd)
 	rootCmd.AddCommand(container.Cmd)
 	rootCmd.AddCommand(kubernetes.Cmd)
+	rootCmd.AddCommand(manifests.Cmd)
 }
 
 func Execute() {
@@ -0,0 +1,136 @@
+package compat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultKubernetesVersion 默认Kubernetes版本
+const DefaultKubernetesVersion = "v1.27.6"
+
+// VersionRange 次版本范围，包含Min与Max，如1.6~1.7
+type VersionRange struct {
+	Min string `json:"min" yaml:"min"`
+	Max string `json:"max" yaml:"max"`
+}
+
+// Contains version的次版本是否在范围内，version可带v前缀与补丁版本
+func (r VersionRange) Contains(version string) bool {
+	v, ok := parseMinor(version)
+	if !ok {
+		return false
+	}
+	lower, _ := parseMinor(r.Min)
+	upper, _ := parseMinor(r.Max)
+	return !v.less(lower) && !upper.less(v)
+}
+
+func (r VersionRange) String() string {
+	if r.Min == r.Max {
+		return r.Min
+	}
+	return r.Min + "~" + r.Max
+}
+
+// Release Kubernetes次版本对应的组件版本
+type Release struct {
+	Kubernetes string       `json:"kubernetes" yaml:"kubernetes"` // 次版本，如v1.27
+	Pause      string       `json:"pause" yaml:"pause"`
+	Etcd       string       `json:"etcd" yaml:"etcd"`
+	CoreDNS    string       `json:"coredns" yaml:"coredns"`
+	Containerd VersionRange `json:"containerd" yaml:"containerd"`
+	Calico     VersionRange `json:"calico" yaml:"calico"`
+}
+
+// PauseImage pause镜像名称，不含仓库地址
+func (r Release) PauseImage() string {
+	return "pause:" + r.Pause
+}
+
+// releases 版本兼容矩阵，pause、etcd、coredns与各次版本最新补丁版本的kubeadm内置版本保持一致，
+// 同一次版本的较早补丁版本可能内置更旧的etcd与coredns，containerd与calico范围参考各项目发布说明
+var releases = []Release{
+	{Kubernetes: "v1.24", Pause: "3.7", Etcd: "3.5.6-0", CoreDNS: "v1.8.6", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.24", "3.26"}},
+	{Kubernetes: "v1.25", Pause: "3.8", Etcd: "3.5.9-0", CoreDNS: "v1.9.3", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.25", "3.26"}},
+	{Kubernetes: "v1.26", Pause: "3.9", Etcd: "3.5.10-0", CoreDNS: "v1.9.3", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.26", "3.26"}},
+	{Kubernetes: "v1.27", Pause: "3.9", Etcd: "3.5.12-0", CoreDNS: "v1.10.1", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.26", "3.27"}},
+	{Kubernetes: "v1.28", Pause: "3.9", Etcd: "3.5.15-0", CoreDNS: "v1.10.1", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.27", "3.28"}},
+	{Kubernetes: "v1.29", Pause: "3.9", Etcd: "3.5.16-0", CoreDNS: "v1.11.1", Containerd: VersionRange{"1.6", "1.7"}, Calico: VersionRange{"3.27", "3.29"}},
+	{Kubernetes: "v1.30", Pause: "3.9", Etcd: "3.5.15-0", CoreDNS: "v1.11.3", Containerd: VersionRange{"1.6", "2.0"}, Calico: VersionRange{"3.28", "3.30"}},
+	{Kubernetes: "v1.31", Pause: "3.10", Etcd: "3.5.15-0", CoreDNS: "v1.11.3", Containerd: VersionRange{"1.7", "2.0"}, Calico: VersionRange{"3.29", "3.30"}},
+	{Kubernetes: "v1.32", Pause: "3.10", Etcd: "3.5.16-0", CoreDNS: "v1.11.3", Containerd: VersionRange{"1.7", "2.1"}, Calico: VersionRange{"3.30", "3.30"}},
+}
+
+// Releases 全部支持的Kubernetes次版本
+func Releases() []Release {
+	return append([]Release(nil), releases...)
+}
+
+// Lookup 查找Kubernetes版本对应的组件版本，k8sVersion可带v前缀与补丁版本
+func Lookup(k8sVersion string) (Release, error) {
+	v, ok := parseMinor(k8sVersion)
+	if ok {
+		for _, release := range releases {
+			if r, _ := parseMinor(release.Kubernetes); r == v {
+				return release, nil
+			}
+		}
+	}
+	return Release{}, fmt.Errorf(
+		"不支持的Kubernetes版本%s，支持的版本为%s~%s",
+		k8sVersion, releases[0].Kubernetes, releases[len(releases)-1].Kubernetes,
+	)
+}
+
+// NormalizeVersion 补全v前缀，如1.27.6补全为v1.27.6
+func NormalizeVersion(version string) string {
+	return "v" + strings.TrimPrefix(strings.TrimSpace(version), "v")
+}
+
+// AtLeast version的次版本是否不低于min，如AtLeast("v1.31.2", "1.31")
+func AtLeast(version, min string) bool {
+	v, ok := parseMinor(version)
+	if !ok {
+		return false
+	}
+	m, _ := parseMinor(min)
+	return !v.less(m)
+}
+
+// minor 主版本与次版本
+type minor struct {
+	major, minor int
+}
+
+func (m minor) less(other minor) bool {
+	if m.major != other.major {
+		return m.major < other.major
+	}
+	return m.minor < other.minor
+}
+
+// parseMinor 解析版本号中的主版本与次版本
+func parseMinor(version string) (minor, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(strings.TrimSpace(version), "v"), ".", 3)
+	if len(parts) < 2 {
+		return minor{}, false
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return minor{}, false
+	}
+	// 次版本可能带有后缀，如2.0-rc
+	digits := strings.IndexFunc(parts[1], func(r rune) bool { return r < '0' || r > '9' })
+	if digits == 0 {
+		return minor{}, false
+	}
+	if digits > 0 {
+		parts[1] = parts[1][:digits]
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return minor{}, false
+	}
+	return minor{major: major, minor: m}, true
+}
@@ -4,91 +4,154 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
+	"strings"
 
 	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
 )
 
 const (
 	ContainerdSockPath   = "/run/containerd/containerd.sock"
 	ContainerdConfigPath = "/etc/containerd"
+	ContainerdCertsPath  = "/etc/containerd/certs.d"
+	DockerSockPath       = "/var/run/docker.sock"
+	DockerConfigPath     = "/etc/docker"
+	CriDockerdSockPath   = "/run/cri-dockerd.sock"
 )
 
+// CRISocket kubeadm使用的CRI socket，安装Docker时节点上同时存在containerd，需要显式指定
+func CRISocket(withDocker bool) string {
+	if withDocker {
+		return "unix://" + CriDockerdSockPath
+	}
+	return "unix://" + ContainerdSockPath
+}
+
 // containerdConfig containerd配置
 func containerdConfig() error {
-	_ = os.Mkdir(ContainerdConfigPath, os.ModeDir)
-	_ = os.Rename(
-		fmt.Sprintf("%s/config.toml", ContainerdConfigPath),
-		fmt.Sprintf("%s/config.toml.bak", ContainerdConfigPath),
-	)
-	_ = pkg.ExecCmd(
-		exec.Command("touch", fmt.Sprintf("%s/config.toml", ContainerdConfigPath)),
-	)
-
-	configFilePath := fmt.Sprintf("%s/config.toml", ContainerdConfigPath)
-	configFile, e := os.Create(configFilePath)
-	if e != nil {
-		return e
+	configFilePath := path.Join(ContainerdConfigPath, "config.toml")
+
+	// 备份原有配置
+	if err := pkg.MkdirAll(ContainerdConfigPath, 0755); err != nil {
+		return err
 	}
-	configCmd := exec.Command("containerd", "config", "default")
-	configCmd.Stdout = configFile
-	if err := configCmd.Run(); err != nil {
+	if err := pkg.BackupFile(configFilePath); err != nil {
 		return err
 	}
 
-	if err := pkg.ExecCmd(
-		exec.Command(
-			"sed",
-			"-i",
-			"s#registry.k8s.io/pause:3.8#registry.aliyuncs.com/google_containers/pause:3.9#g",
-			fmt.Sprintf("%s/config.toml", ContainerdConfigPath),
-		),
-	); err != nil {
+	data, err := pkg.CmdOutput(exec.Command("containerd", "config", "default"))
+	if err != nil {
 		return err
 	}
-	if err := pkg.ExecCmd(
-		exec.Command(
-			"sed",
-			"-i",
-			"s#SystemdCgroup = false#SystemdCgroup = true#g",
-			fmt.Sprintf("%s/config.toml", ContainerdConfigPath),
-		),
-	); err != nil {
+	if len(data) == 0 && pkg.IsDryRun() {
+		// 预演模式下无法获取默认配置，以空配置展示修改项
+		data = []byte("version = 2\n")
+	}
+	config, err := parseContainerdConfig(configFilePath, data)
+	if err != nil {
 		return err
 	}
 
+	sandboxImage, err := PauseImage(containerKubernetesVersion)
+	if err != nil {
+		return err
+	}
+	settings := map[string]any{
+		"sandbox_image":  sandboxImage,
+		"systemd_cgroup": true,
+		"config_path":    ContainerdCertsPath,
+	}
 	// 指定数据目录
 	if containerWithDataDirectory != "" {
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"sed",
-				"-i",
-				fmt.Sprintf("s#/var/lib/containerd#%s#g", containerWithDataDirectory),
-				fmt.Sprintf("%s/config.toml", ContainerdConfigPath),
-			),
-		); err != nil {
+		settings["root"] = containerWithDataDirectory
+	}
+	for key, value := range settings {
+		if err = config.Set(key, value); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return config.Save(settings)
 }
 
-// crictlConfig 配置crictl
-func crictlConfig() error {
-	configFile, e := os.OpenFile("/etc/crictl.yaml", os.O_CREATE|os.O_RDWR, 0644)
-	if e != nil {
-		return e
-	}
-	defer func() {
-		_ = configFile.Close()
-	}()
-
-	if _, err := configFile.Write([]byte(fmt.Sprintf(`runtime-endpoint: unix://%s
+// crictlConfig 配置crictl，sockPath为CRI服务socket
+func crictlConfig(sockPath string) error {
+	return pkg.WriteFile("/etc/crictl.yaml", []byte(fmt.Sprintf(`runtime-endpoint: unix://%s
 image-endpoint: unix://%s
 timeout: 10
-debug: false`, ContainerdSockPath, ContainerdSockPath))); err != nil {
+debug: false`, sockPath, sockPath)), 0644)
+}
+
+// containerdConfigFile containerd配置文件路径
+var containerdConfigFile string
+
+// containerdConfigRestart 修改配置后重启containerd
+var containerdConfigRestart bool
+
+// configCmd containerd配置命令
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "containerd配置",
+	Long:  "查看与修改containerd配置，支持version 2与version 3配置格式",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+// configGetCmd 获取containerd配置项
+var configGetCmd = &cobra.Command{
+	Use:   "get <key>",
+	Short: "获取containerd配置项",
+	Long:  "获取containerd配置项，key为别名(" + strings.Join(ContainerdConfigKeys(), "|") + ")或点分路径",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := LoadContainerdConfig(containerdConfigFile)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		value, err := config.Get(args[0])
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		fmt.Println(value)
+	},
+}
+
+// configSetCmd 设置containerd配置项
+var configSetCmd = &cobra.Command{
+	Use:   "set <key> <value>",
+	Short: "设置containerd配置项",
+	Long:  "设置containerd配置项，key为别名(" + strings.Join(ContainerdConfigKeys(), "|") + ")或点分路径",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setContainerdConfig(args[0], ParseValue(args[1]), containerdConfigRestart); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// setContainerdConfig 修改containerd配置项
+func setContainerdConfig(key string, value any, restart bool) error {
+	config, err := LoadContainerdConfig(containerdConfigFile)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	if err = config.Set(key, value); err != nil {
+		return err
+	}
+	if err = pkg.BackupFile(containerdConfigFile); err != nil {
+		return err
+	}
+	if err = config.Save(map[string]any{key: value}); err != nil {
+		return err
+	}
+	if !restart {
+		fmt.Println("配置已修改，执行 systemctl restart containerd 后生效")
+		return nil
+	}
+	return pkg.ExecCmd(exec.Command("systemctl", "restart", "containerd.service"))
 }
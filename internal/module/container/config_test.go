@@ -0,0 +1,124 @@
+package container
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// fakeRunner 按命令行返回预设输出
+type fakeRunner map[string]string
+
+func (r fakeRunner) Run(*exec.Cmd) error {
+	return nil
+}
+
+func (r fakeRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	return []byte(r[pkg.CommandLine(cmd)]), nil
+}
+
+// useMemFS 将全局文件系统替换为内存文件系统，测试结束后恢复
+func useMemFS(t *testing.T) *pkg.MemFS {
+	t.Helper()
+	m := pkg.NewMemFS()
+	prev := pkg.HostFS()
+	pkg.SetFS(m)
+	t.Cleanup(func() { pkg.SetFS(prev) })
+	return m
+}
+
+const defaultConfigV2 = `version = 2
+root = "/var/lib/containerd"
+
+[plugins]
+  [plugins."io.containerd.grpc.v1.cri"]
+    sandbox_image = "registry.k8s.io/pause:3.6"
+    [plugins."io.containerd.grpc.v1.cri".containerd]
+      snapshotter = "overlayfs"
+      [plugins."io.containerd.grpc.v1.cri".containerd.runtimes.runc.options]
+        SystemdCgroup = false
+    [plugins."io.containerd.grpc.v1.cri".registry]
+      config_path = ""
+`
+
+const defaultConfigV3 = `version = 3
+root = "/var/lib/containerd"
+
+[plugins]
+  [plugins."io.containerd.cri.v1.images"]
+    snapshotter = "overlayfs"
+    [plugins."io.containerd.cri.v1.images".pinned_images]
+      sandbox = "registry.k8s.io/pause:3.10"
+    [plugins."io.containerd.cri.v1.images".registry]
+      config_path = ""
+  [plugins."io.containerd.cri.v1.runtime"]
+    [plugins."io.containerd.cri.v1.runtime".containerd.runtimes.runc.options]
+      SystemdCgroup = false
+`
+
+func TestContainerdConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults string
+		dataDir  string
+	}{
+		{name: "version 2", defaults: defaultConfigV2},
+		{name: "version 3", defaults: defaultConfigV3},
+		{name: "指定数据目录", defaults: defaultConfigV2, dataDir: "/data/containerd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemFS(t)
+			if err := m.WriteFile("/etc/containerd/config.toml", []byte("# old\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			prevRunner := pkg.GetRunner()
+			pkg.SetRunner(fakeRunner{"containerd config default": tt.defaults})
+			defer pkg.SetRunner(prevRunner)
+			containerKubernetesVersion, containerWithDataDirectory = compat.DefaultKubernetesVersion, tt.dataDir
+			defer func() { containerKubernetesVersion, containerWithDataDirectory = "", "" }()
+
+			if err := containerdConfig(); err != nil {
+				t.Fatalf("containerdConfig() error = %v", err)
+			}
+
+			if old, err := m.ReadFile("/etc/containerd/config.toml.bak"); err != nil || string(old) != "# old\n" {
+				t.Errorf("config.toml.bak = %q, %v", old, err)
+			}
+			config, err := LoadContainerdConfig("/etc/containerd/config.toml")
+			if err != nil {
+				t.Fatal(err)
+			}
+			sandboxImage, _ := PauseImage(compat.DefaultKubernetesVersion)
+			root := "/var/lib/containerd"
+			if tt.dataDir != "" {
+				root = tt.dataDir
+			}
+			for key, want := range map[string]any{
+				"sandbox_image":  sandboxImage,
+				"systemd_cgroup": true,
+				"config_path":    ContainerdCertsPath,
+				"snapshotter":    "overlayfs",
+				"root":           root,
+			} {
+				if got, err := config.Get(key); err != nil || got != want {
+					t.Errorf("%s = %v, %v, want %v", key, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCrictlConfig(t *testing.T) {
+	m := useMemFS(t)
+	if err := crictlConfig(CriDockerdSockPath); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := m.ReadFile("/etc/crictl.yaml")
+	want := "runtime-endpoint: unix:///run/cri-dockerd.sock\nimage-endpoint: unix:///run/cri-dockerd.sock\ntimeout: 10\ndebug: false"
+	if string(data) != want {
+		t.Errorf("crictl.yaml = %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,226 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/pelletier/go-toml"
+)
+
+// containerd配置中的插件名
+const (
+	criPluginV2        = "io.containerd.grpc.v1.cri"
+	criImagesPluginV3  = "io.containerd.cri.v1.images"
+	criRuntimePluginV3 = "io.containerd.cri.v1.runtime"
+)
+
+// containerdConfigKeys 配置项别名，按配置版本映射到实际路径
+var containerdConfigKeys = map[string]map[int64][]string{
+	"sandbox_image": {
+		2: {"plugins", criPluginV2, "sandbox_image"},
+		3: {"plugins", criImagesPluginV3, "pinned_images", "sandbox"},
+	},
+	"systemd_cgroup": {
+		2: {"plugins", criPluginV2, "containerd", "runtimes", "runc", "options", "SystemdCgroup"},
+		3: {"plugins", criRuntimePluginV3, "containerd", "runtimes", "runc", "options", "SystemdCgroup"},
+	},
+	"snapshotter": {
+		2: {"plugins", criPluginV2, "containerd", "snapshotter"},
+		3: {"plugins", criImagesPluginV3, "snapshotter"},
+	},
+	"config_path": {
+		2: {"plugins", criPluginV2, "registry", "config_path"},
+		3: {"plugins", criImagesPluginV3, "registry", "config_path"},
+	},
+	"root": {
+		2: {"root"},
+		3: {"root"},
+	},
+	"state": {
+		2: {"state"},
+		3: {"state"},
+	},
+}
+
+// ContainerdConfigKeys 支持的配置项别名
+func ContainerdConfigKeys() []string {
+	keys := make([]string, 0, len(containerdConfigKeys))
+	for key := range containerdConfigKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ContainerdConfig containerd配置文件
+type ContainerdConfig struct {
+	file string
+	tree *toml.Tree
+}
+
+// LoadContainerdConfig 加载containerd配置文件
+func LoadContainerdConfig(file string) (*ContainerdConfig, error) {
+	data, err := pkg.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseContainerdConfig(file, data)
+}
+
+func parseContainerdConfig(file string, data []byte) (*ContainerdConfig, error) {
+	tree, err := toml.LoadBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s解析失败: %w", file, err)
+	}
+	config := &ContainerdConfig{file: file, tree: tree}
+	if version := config.Version(); version != 2 && version != 3 {
+		return nil, fmt.Errorf("%s配置版本为%d，仅支持version 2与version 3", file, version)
+	}
+	return config, nil
+}
+
+// Version 配置版本，未声明version的旧配置视为1
+func (c *ContainerdConfig) Version() int64 {
+	version, ok := c.tree.Get("version").(int64)
+	if !ok {
+		return 1
+	}
+	return version
+}
+
+// resolve 将别名或点分路径解析为配置路径
+func (c *ContainerdConfig) resolve(key string) ([]string, error) {
+	if paths, ok := containerdConfigKeys[key]; ok {
+		return paths[c.Version()], nil
+	}
+	return splitKey(key)
+}
+
+// Get 获取配置项，key为别名或点分路径(如plugins."io.containerd.grpc.v1.cri".sandbox_image)
+func (c *ContainerdConfig) Get(key string) (any, error) {
+	keys, err := c.resolve(key)
+	if err != nil {
+		return nil, err
+	}
+	value := c.tree.GetPath(keys)
+	if value == nil {
+		return nil, fmt.Errorf("配置项%s不存在", key)
+	}
+	return value, nil
+}
+
+// Set 设置配置项，value的类型与已有配置项保持一致
+func (c *ContainerdConfig) Set(key string, value any) error {
+	keys, err := c.resolve(key)
+	if err != nil {
+		return err
+	}
+	if current := c.tree.GetPath(keys); current != nil {
+		if _, ok := current.(*toml.Tree); ok {
+			return fmt.Errorf("配置项%s为配置段，不能直接设置", key)
+		}
+		if value, err = convertValue(value, reflect.TypeOf(current)); err != nil {
+			return fmt.Errorf("配置项%s: %w", key, err)
+		}
+	}
+	c.tree.SetPath(keys, value)
+	return nil
+}
+
+// Save 写入配置文件并重新加载校验
+func (c *ContainerdConfig) Save(expected map[string]any) error {
+	data, err := c.tree.Marshal()
+	if err != nil {
+		return err
+	}
+	if err = pkg.MkdirAll(path.Dir(c.file), 0755); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile(c.file, data, 0644); err != nil {
+		return err
+	}
+
+	saved, err := LoadContainerdConfig(c.file)
+	if err != nil {
+		return err
+	}
+	for key, value := range expected {
+		actual, err := saved.Get(key)
+		if err != nil {
+			return fmt.Errorf("配置校验失败: %w", err)
+		}
+		if fmt.Sprint(actual) != fmt.Sprint(value) {
+			return fmt.Errorf("配置校验失败: %s期望为%v，实际为%v", key, value, actual)
+		}
+	}
+	return nil
+}
+
+// splitKey 拆分点分路径，支持带引号的路径段
+func splitKey(key string) ([]string, error) {
+	var keys []string
+	var current strings.Builder
+	var quote rune
+	quoted := false
+	for _, r := range key {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote, quoted = r, true
+		case r == '.':
+			if current.Len() == 0 && !quoted {
+				return nil, fmt.Errorf("配置项%s格式错误", key)
+			}
+			keys = append(keys, current.String())
+			current.Reset()
+			quoted = false
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if quote != 0 || (current.Len() == 0 && !quoted) {
+		return nil, fmt.Errorf("配置项%s格式错误", key)
+	}
+	return append(keys, current.String()), nil
+}
+
+// ParseValue 解析命令行输入的配置值
+func ParseValue(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	if i, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return i
+	}
+	return value
+}
+
+// convertValue 将value转换为目标类型
+func convertValue(value any, typ reflect.Type) (any, error) {
+	if reflect.TypeOf(value) == typ {
+		return value, nil
+	}
+	text := fmt.Sprint(value)
+	switch typ.Kind() {
+	case reflect.String:
+		return text, nil
+	case reflect.Bool:
+		return strconv.ParseBool(text)
+	case reflect.Int64:
+		return strconv.ParseInt(text, 10, 64)
+	case reflect.Float64:
+		return strconv.ParseFloat(text, 64)
+	}
+	return nil, errors.New("不支持的配置值类型" + typ.String())
+}
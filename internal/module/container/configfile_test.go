@@ -0,0 +1,113 @@
+package container
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestContainerdConfigGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		key     string
+		want    any
+		wantErr bool
+	}{
+		{name: "v2 sandbox_image", config: defaultConfigV2, key: "sandbox_image", want: "registry.k8s.io/pause:3.6"},
+		{name: "v3 sandbox_image", config: defaultConfigV3, key: "sandbox_image", want: "registry.k8s.io/pause:3.10"},
+		{name: "v2 systemd_cgroup", config: defaultConfigV2, key: "systemd_cgroup", want: false},
+		{name: "v3 systemd_cgroup", config: defaultConfigV3, key: "systemd_cgroup", want: false},
+		{name: "v3 snapshotter", config: defaultConfigV3, key: "snapshotter", want: "overlayfs"},
+		{name: "点分路径", config: defaultConfigV2, key: `plugins."io.containerd.grpc.v1.cri".containerd.snapshotter`, want: "overlayfs"},
+		{name: "单引号路径", config: defaultConfigV3, key: `plugins.'io.containerd.cri.v1.images'.snapshotter`, want: "overlayfs"},
+		{name: "不存在的配置项", config: defaultConfigV2, key: "state", wantErr: true},
+		{name: "路径格式错误", config: defaultConfigV2, key: "plugins..cri", wantErr: true},
+		{name: "未闭合的引号", config: defaultConfigV2, key: `plugins."cri`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseContainerdConfig("config.toml", []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := config.Get(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Get(%s) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get(%s) = %#v, want %#v", tt.key, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerdConfigSet(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		key     string
+		value   any
+		want    any
+		wantErr bool
+	}{
+		{name: "v2 字符串转布尔", config: defaultConfigV2, key: "systemd_cgroup", value: ParseValue("true"), want: true},
+		{name: "v3 字符串转布尔", config: defaultConfigV3, key: "systemd_cgroup", value: "true", want: true},
+		{name: "v3 sandbox_image", config: defaultConfigV3, key: "sandbox_image", value: "registry.aliyuncs.com/google_containers/pause:3.10", want: "registry.aliyuncs.com/google_containers/pause:3.10"},
+		{name: "数字转为已有的字符串类型", config: defaultConfigV2, key: "sandbox_image", value: int64(1), want: "1"},
+		{name: "新增配置项", config: defaultConfigV2, key: "state", value: "/run/containerd", want: "/run/containerd"},
+		{name: "类型不兼容", config: defaultConfigV2, key: "systemd_cgroup", value: "yes", wantErr: true},
+		{name: "不能覆盖配置段", config: defaultConfigV3, key: `plugins."io.containerd.cri.v1.images"`, value: "x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseContainerdConfig("config.toml", []byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = config.Set(tt.key, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Set(%s) error = %v, wantErr %v", tt.key, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			// 序列化后重新解析，确认写入的值与类型
+			data, err := config.tree.Marshal()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reloaded, err := parseContainerdConfig("config.toml", data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := reloaded.Get(tt.key); err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Get(%s) after Set = %#v, %v, want %#v", tt.key, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseContainerdConfigVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		want    int64
+		wantErr bool
+	}{
+		{name: "version 2", config: "version = 2\n", want: 2},
+		{name: "version 3", config: "version = 3\n", want: 3},
+		{name: "未声明version的旧配置", config: "root = \"/var/lib/containerd\"\n", wantErr: true},
+		{name: "无效TOML", config: "version = \n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := parseContainerdConfig("config.toml", []byte(tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseContainerdConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && config.Version() != tt.want {
+				t.Errorf("Version() = %d, want %d", config.Version(), tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,15 @@
 package container
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"os"
+	"path"
 
+	"github.com/dysodeng/devops-tools/internal/module/compat"
 	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
 )
 
@@ -23,27 +28,55 @@ var containerWithDocker bool
 // containerWithDataDirectory 指定容器运行时数据存储目录
 var containerWithDataDirectory string
 
+// containerOfflineDirectory 离线安装包目录
+var containerOfflineDirectory string
+
 // installContainerCmd 安装容器运行时
 var installContainerCmd = &cobra.Command{
 	Use:   "install",
 	Short: "安装容器运行时，默认安装containerd",
 	Long:  "安装容器运行时，默认安装containerd",
 	Run: func(cmd *cobra.Command, args []string) {
-		var err error
-		if containerWithDocker {
-			err = installDocker(system.System.LinuxDistro, system.System.Arch)
+		_, err := compat.Lookup(containerKubernetesVersion)
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if containerOfflineDirectory != "" {
+			if containerWithDocker {
+				err = errors.New("离线安装暂不支持Docker")
+			} else {
+				err = installContainerdOffline(system.System.LinuxDistroFamily, system.System.Arch, containerOfflineDirectory)
+			}
+		} else if containerWithDocker {
+			err = installDocker(system.System.LinuxDistroFamily, system.System.Arch)
 		} else {
-			err = installContainerd(system.System.LinuxDistro, system.System.Arch)
+			err = installContainerd(system.System.LinuxDistroFamily, system.System.Arch)
 		}
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
+		if !containerWithDocker && !pkg.IsDryRun() {
+			if err = CheckContainerdVersion(containerKubernetesVersion); err != nil {
+				log.Printf("警告: %s", err)
+			}
+		}
 	},
 }
 
 func InitContainerCmd() {
+	system.Require(installContainerCmd, system.RequireLinux, system.RequireRoot)
 	installContainerCmd.Flags().BoolVarP(&containerWithDocker, "with-docker", "", false, "安装Docker")
+	installContainerCmd.Flags().StringVarP(&containerOfflineDirectory, "offline", "", "", "离线安装，指定containerd、runc与CNI插件release包及其SHA256校验文件所在目录")
+	installContainerCmd.Flags().StringVarP(&containerKubernetesVersion, "kubernetes-version", "", compat.DefaultKubernetesVersion, "配套的Kubernetes版本，用于确定pause镜像与检查containerd版本")
 	installContainerCmd.Flags().StringVarP(&containerWithDataDirectory, "with-data", "", "", "指定容器运行时数据存储目录")
-	Cmd.AddCommand(installContainerCmd)
+	system.Require(configGetCmd, system.RequireLinux)
+	system.Require(configSetCmd, system.RequireLinux, system.RequireRoot)
+	configCmd.PersistentFlags().StringVarP(&containerdConfigFile, "file", "f", path.Join(ContainerdConfigPath, "config.toml"), "containerd配置文件")
+	configSetCmd.Flags().BoolVarP(&containerdConfigRestart, "restart", "", false, "修改后重启containerd")
+	configCmd.AddCommand(configGetCmd, configSetCmd)
+	Cmd.AddCommand(installContainerCmd, configCmd)
+	initRegistryCmd()
+	initImageCmd()
 }
@@ -1,101 +1,95 @@
 package container
 
 import (
+	"fmt"
 	"os/exec"
-	"strings"
+	"regexp"
 
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/module/system"
 	"github.com/dysodeng/devops-tools/internal/pkg"
 )
 
 // installContainerd 安装containerd
-func installContainerd(linuxDistro, arch string) error {
-	var err error
-	switch linuxDistro {
-	case "CentOS":
-		// 关闭防火墙
-		if err = pkg.ExecCmd(exec.Command("systemctl", "stop", "firewalld.service")); err != nil {
-			return err
-		}
-		if err = pkg.ExecCmd(exec.Command("systemctl", "disable", "firewalld.service")); err != nil {
-			return err
-		}
+func installContainerd(family system.Family, arch string) error {
+	pm, err := system.GetPackageManager()
+	if err != nil {
+		return err
+	}
 
-		// 关闭selinux
-		if err = pkg.ExecCmd(exec.Command("setenforce", "0")); err != nil {
-			return err
-		}
-		if err = pkg.ExecCmd(exec.Command("sed", "-i", "s/^SELINUX=enforcing$/SELINUX=permissive/", "/etc/selinux/config")); err != nil {
-			return err
-		}
+	if err = prepareHost(family); err != nil {
+		return err
+	}
 
-		// 安装containerd
-		if err = pkg.ExecCmd(exec.Command("yum", "install", "-y", "yum-utils", "device-mapper-persistent-data", "lvm2")); err != nil {
-			return err
-		}
-		if err = pkg.ExecCmd(exec.Command("yum-config-manager", "--add-repo", "https://mirrors.aliyun.com/docker-ce/linux/centos/docker-ce.repo")); err != nil {
-			return err
-		}
-		if err = pkg.ExecCmd(exec.Command("yum", "install", "-y", "containerd.io", "runc")); err != nil {
-			return err
-		}
-		if err = pkg.ExecCmd(exec.Command("systemctl", "stop", "containerd.service")); err != nil {
+	var packages []system.Package
+	switch family {
+	case system.FamilyRHEL:
+		// 发行版自带的containerd版本较旧，使用docker-ce仓库中的containerd.io
+		baseURL, gpgKey := mirror.Current().DockerCERepo(system.ELVersion())
+		if err = pm.AddRepo(system.Repo{Name: "docker-ce", BaseURL: baseURL, GPGKey: gpgKey}); err != nil {
 			return err
 		}
+		packages = system.Packages("containerd.io", "runc")
 
-		// 配置containerd
-		if err = containerdConfig(); err != nil {
-			return err
-		}
+	case system.FamilyDebian:
+		// 安装发行版最新containerd
+		packages = system.Packages("containerd")
 
-		if err = crictlConfig(); err != nil {
-			return err
-		}
+	case system.FamilySUSE:
+		packages = system.Packages("containerd", "runc")
+	}
 
-		// 启动containerd服务
-		return pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "containerd.service"))
+	// 安装containerd
+	if err = pm.Refresh(); err != nil {
+		return err
+	}
+	if err = pm.Install(packages...); err != nil {
+		return err
+	}
+	_ = pkg.ExecCmd(exec.Command("systemctl", "stop", "containerd.service"))
 
-	case "Ubuntu":
-		fallthrough
+	// 配置containerd
+	if err = containerdConfig(); err != nil {
+		return err
+	}
 
-	case "Debian":
+	if err = crictlConfig(ContainerdSockPath); err != nil {
+		return err
+	}
 
-		// 关闭防火墙
-		_ = pkg.ExecCmd(exec.Command("systemctl", "disable", "ufw", "--now"))
+	// 启动containerd服务
+	return pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "containerd.service"))
+}
 
-		if err = pkg.ExecCmd(exec.Command("apt-get", "update")); err != nil {
-			return err
-		}
+// selinuxConfigPath selinux配置文件
+const selinuxConfigPath = "/etc/selinux/config"
 
-		// 安装ubuntu发行版最新containerd
-		searchCmd := exec.Command("apt-cache", "madison", "containerd")
-		output, e := searchCmd.Output()
-		if e != nil {
-			return e
-		}
-		searchList := strings.Split(string(output), "\n")
-		var containerdVersion string
-		if len(searchList) > 0 {
-			versionList := strings.Split(searchList[0], "|")
-			if len(versionList) >= 3 {
-				containerdVersion = "containerd=" + strings.TrimSpace(versionList[1])
-			}
-		}
-		if err = pkg.ExecCmd(exec.Command("apt", "install", "-y", containerdVersion)); err != nil {
-			return err
-		}
+// prepareHost 安装容器运行时前关闭防火墙与selinux，均为尽力而为
+func prepareHost(family system.Family) error {
+	switch family {
+	case system.FamilyRHEL:
+		// 关闭防火墙，未安装firewalld时忽略
+		_ = pkg.ExecCmd(exec.Command("systemctl", "disable", "firewalld.service", "--now"))
 
-		// 配置containerd
-		if err = containerdConfig(); err != nil {
-			return err
+		// 关闭selinux，未启用selinux时setenforce失败，未安装selinux时没有配置文件
+		_ = pkg.ExecCmd(exec.Command("setenforce", "0"))
+		if !pkg.FileExists(selinuxConfigPath) {
+			return nil
 		}
+		return pkg.EditFile(selinuxConfigPath, func(content string) string {
+			return regexp.MustCompile(`(?m)^SELINUX=enforcing$`).ReplaceAllString(content, "SELINUX=permissive")
+		})
 
-		if err = crictlConfig(); err != nil {
-			return err
-		}
+	case system.FamilyDebian:
+		// 关闭防火墙
+		_ = pkg.ExecCmd(exec.Command("systemctl", "disable", "ufw", "--now"))
+		return nil
 
-		// 启动containerd服务
-		return pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "containerd"))
+	case system.FamilySUSE:
+		// 关闭防火墙
+		_ = pkg.ExecCmd(exec.Command("systemctl", "disable", "firewalld", "--now"))
+		return nil
 	}
 
-	return nil
+	return fmt.Errorf("不支持的Linux发行版: %s", system.System.LinuxDistro)
 }
@@ -0,0 +1,60 @@
+package container
+
+import (
+	"errors"
+	"os/exec"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// failRunner 所有命令均执行失败，模拟未安装firewalld、未启用selinux的主机
+type failRunner struct{}
+
+func (failRunner) Run(*exec.Cmd) error {
+	return errors.New("exit status 1")
+}
+
+func (failRunner) Output(*exec.Cmd) ([]byte, error) {
+	return nil, errors.New("exit status 1")
+}
+
+func TestPrepareHost(t *testing.T) {
+	prev := pkg.GetRunner()
+	pkg.SetRunner(failRunner{})
+	t.Cleanup(func() { pkg.SetRunner(prev) })
+
+	tests := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{name: "未安装selinux"},
+		{name: "selinux配置改为permissive", config: "SELINUX=enforcing\nSELINUXTYPE=targeted\n", want: "SELINUX=permissive\nSELINUXTYPE=targeted\n"},
+		{name: "selinux已禁用", config: "SELINUX=disabled\n", want: "SELINUX=disabled\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemFS(t)
+			if tt.config != "" {
+				if err := m.WriteFile(selinuxConfigPath, []byte(tt.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := prepareHost(system.FamilyRHEL); err != nil {
+				t.Fatalf("prepareHost() error = %v", err)
+			}
+			if tt.config == "" {
+				return
+			}
+			data, err := m.ReadFile(selinuxConfigPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("%s = %q, want %q", selinuxConfigPath, data, tt.want)
+			}
+		})
+	}
+}
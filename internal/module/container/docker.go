@@ -1,5 +1,235 @@
 package container
 
-func installDocker(linuxDistro, arch string) error {
-	return nil
+import (
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// criDockerdVersion cri-dockerd版本
+const criDockerdVersion = "0.3.14"
+
+// criDockerdBinPath cri-dockerd安装路径
+const criDockerdBinPath = "/usr/local/bin/cri-dockerd"
+
+// installDocker 安装Docker Engine与cri-dockerd
+func installDocker(family system.Family, arch string) error {
+	pm, err := system.GetPackageManager()
+	if err != nil {
+		return err
+	}
+
+	if err = prepareHost(family); err != nil {
+		return err
+	}
+
+	packages := system.Packages("docker-ce", "docker-ce-cli", "containerd.io", "docker-buildx-plugin", "docker-compose-plugin")
+	switch family {
+	case system.FamilyRHEL:
+		baseURL, gpgKey := mirror.Current().DockerCERepo(system.ELVersion())
+		if err = pm.AddRepo(system.Repo{Name: "docker-ce", BaseURL: baseURL, GPGKey: gpgKey}); err != nil {
+			return err
+		}
+
+	case system.FamilyDebian:
+		if err = pm.Refresh(); err != nil {
+			return err
+		}
+		if err = pm.Install(system.Packages("ca-certificates", "curl", "gnupg")...); err != nil {
+			return err
+		}
+		uri, gpgKey := mirror.Current().DockerCEApt(strings.ToLower(system.System.LinuxDistro))
+		if err = pm.ImportKey("docker", gpgKey); err != nil {
+			return err
+		}
+		if err = pm.AddRepo(system.Repo{
+			Name:       "docker",
+			BaseURL:    uri,
+			Suite:      system.System.CodeName,
+			Components: []string{"stable"},
+			GPGKey:     gpgKey,
+		}); err != nil {
+			return err
+		}
+
+	case system.FamilySUSE:
+		// docker-ce未提供openSUSE/SLES软件源，使用发行版自带的docker
+		packages = system.Packages("docker", "docker-buildx", "docker-compose")
+	}
+
+	// 安装docker
+	if err = pm.Refresh(); err != nil {
+		return err
+	}
+	if err = pm.Install(packages...); err != nil {
+		return err
+	}
+	_ = pkg.ExecCmd(exec.Command("systemctl", "stop", "docker.service"))
+
+	// 配置docker
+	if err = dockerConfig(); err != nil {
+		return err
+	}
+	if err = pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "docker.service")); err != nil {
+		return err
+	}
+
+	// kubelet通过cri-dockerd使用docker
+	if err = installCriDockerd(arch); err != nil {
+		return err
+	}
+
+	return crictlConfig(CriDockerdSockPath)
+}
+
+// dockerConfig 配置daemon.json
+func dockerConfig() error {
+	return editDockerDaemonConfig(func(config map[string]any) error {
+		// kubelet默认使用systemd cgroup驱动，docker需保持一致
+		config["exec-opts"] = []string{"native.cgroupdriver=systemd"}
+		config["storage-driver"] = "overlay2"
+		config["log-driver"] = "json-file"
+		config["log-opts"] = map[string]string{"max-size": "100m", "max-file": "3"}
+
+		// 指定数据目录
+		if containerWithDataDirectory != "" {
+			config["data-root"] = containerWithDataDirectory
+		}
+		return nil
+	})
+}
+
+// DockerCgroupDriver daemon.json中exec-opts指定的cgroup驱动，未指定时为Docker默认的cgroupfs
+func DockerCgroupDriver() (string, error) {
+	configFilePath := path.Join(DockerConfigPath, "daemon.json")
+	data, err := pkg.ReadFile(configFilePath)
+	if err != nil {
+		return "", err
+	}
+	var config struct {
+		ExecOpts []string `json:"exec-opts"`
+	}
+	if len(strings.TrimSpace(string(data))) > 0 {
+		if err = json.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("%s解析失败: %w", configFilePath, err)
+		}
+	}
+	for _, opt := range config.ExecOpts {
+		if driver, ok := strings.CutPrefix(opt, "native.cgroupdriver="); ok {
+			return driver, nil
+		}
+	}
+	return "cgroupfs", nil
+}
+
+// editDockerDaemonConfig 修改daemon.json，保留已有配置项
+func editDockerDaemonConfig(edit func(config map[string]any) error) error {
+	configFilePath := path.Join(DockerConfigPath, "daemon.json")
+	if err := pkg.MkdirAll(DockerConfigPath, 0755); err != nil {
+		return err
+	}
+
+	config := map[string]any{}
+	if data, err := pkg.ReadFile(configFilePath); err == nil && len(strings.TrimSpace(string(data))) > 0 {
+		if err = json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("%s解析失败: %w", configFilePath, err)
+		}
+		if err = pkg.BackupFile(configFilePath); err != nil {
+			return err
+		}
+	}
+
+	if err := edit(config); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return pkg.WriteFile(configFilePath, append(data, '\n'), 0644)
+}
+
+// installCriDockerd 从GitHub Release安装cri-dockerd并注册systemd服务
+func installCriDockerd(arch string) error {
+	url := mirror.Current().GitHubURL(fmt.Sprintf(
+		"https://github.com/Mirantis/cri-dockerd/releases/download/v%s/cri-dockerd-%s.%s.tgz",
+		criDockerdVersion,
+		criDockerdVersion,
+		arch,
+	))
+	archive := fmt.Sprintf("/tmp/cri-dockerd-%s.%s.tgz", criDockerdVersion, arch)
+	if err := pkg.ExecCmd(exec.Command("curl", "-fsSL", "-o", archive, url)); err != nil {
+		return err
+	}
+	if err := pkg.ExecCmd(exec.Command(
+		"tar", "-xzf", archive, "-C", path.Dir(criDockerdBinPath), "--strip-components=1", "cri-dockerd/cri-dockerd",
+	)); err != nil {
+		return err
+	}
+	_ = pkg.Remove(archive)
+
+	pauseImage, err := PauseImage(containerKubernetesVersion)
+	if err != nil {
+		return err
+	}
+	if err = writeCriDockerdService(pauseImage); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile("/etc/systemd/system/cri-docker.socket", []byte(fmt.Sprintf(`[Unit]
+Description=CRI Docker Socket for the API
+PartOf=cri-docker.service
+
+[Socket]
+ListenStream=%s
+SocketMode=0660
+SocketUser=root
+SocketGroup=docker
+
+[Install]
+WantedBy=sockets.target
+`, CriDockerdSockPath)), 0644); err != nil {
+		return err
+	}
+
+	if err = pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "cri-docker.socket", "cri-docker.service"))
+}
+
+// writeCriDockerdService 写入cri-dockerd服务文件，pauseImage为sandbox镜像
+func writeCriDockerdService(pauseImage string) error {
+	return pkg.WriteFile(criDockerdServicePath, []byte(fmt.Sprintf(`[Unit]
+Description=CRI Interface for Docker Application Container Engine
+Documentation=https://docs.mirantis.com
+After=network-online.target firewalld.service docker.service
+Wants=network-online.target
+Requires=cri-docker.socket
+
+[Service]
+Type=notify
+ExecStart=%s --container-runtime-endpoint fd:// --network-plugin=cni --pod-infra-container-image=%s
+ExecReload=/bin/kill -s HUP $MAINPID
+TimeoutSec=0
+RestartSec=2
+Restart=always
+StartLimitBurst=3
+StartLimitInterval=60s
+LimitNOFILE=infinity
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+Delegate=yes
+KillMode=process
+
+[Install]
+WantedBy=multi-user.target
+`, criDockerdBinPath, pauseImage)), 0644)
 }
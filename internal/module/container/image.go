@@ -0,0 +1,690 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/images/archive"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/reference/docker"
+	dockerremote "github.com/containerd/containerd/remotes/docker"
+	"github.com/containerd/containerd/remotes/docker/config"
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/spf13/cobra"
+)
+
+// DefaultNamespace Kubernetes使用的containerd命名空间
+const DefaultNamespace = "k8s.io"
+
+// ImageInfo 镜像信息
+type ImageInfo struct {
+	Name      string            `json:"name" yaml:"name"`
+	Digest    string            `json:"digest" yaml:"digest"`
+	MediaType string            `json:"media_type" yaml:"media_type"`
+	Size      int64             `json:"size" yaml:"size"`
+	Platforms []string          `json:"platforms,omitempty" yaml:"platforms,omitempty"`
+	CreatedAt time.Time         `json:"created_at" yaml:"created_at"`
+	Labels    map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// ImageDetail 镜像详情
+type ImageDetail struct {
+	ImageInfo `yaml:",inline"`
+	Config    *ocispec.Image `json:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// NewClient 连接containerd，namespace为空时使用k8s.io
+func NewClient(namespace string) (*containerd.Client, error) {
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+	client, err := containerd.New(ContainerdSockPath, containerd.WithDefaultNamespace(namespace))
+	if err != nil {
+		return nil, fmt.Errorf("连接containerd失败: %w", err)
+	}
+	return client, nil
+}
+
+// NormalizeImage 补全镜像地址，如nginx补全为docker.io/library/nginx:latest
+func NormalizeImage(ref string) (string, error) {
+	named, err := docker.ParseDockerRef(ref)
+	if err != nil {
+		return "", fmt.Errorf("镜像地址%s无效: %w", ref, err)
+	}
+	return named.String(), nil
+}
+
+// platformMatcher 平台匹配，platform为空时使用本机平台，多个平台以逗号分隔
+func platformMatcher(platform string) (platforms.MatchComparer, error) {
+	if platform == "" {
+		return platforms.Default(), nil
+	}
+	var list []ocispec.Platform
+	for _, item := range strings.Split(platform, ",") {
+		p, err := platforms.Parse(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("平台%s无效: %w", item, err)
+		}
+		list = append(list, p)
+	}
+	if len(list) == 1 {
+		return platforms.Only(list[0]), nil
+	}
+	return platforms.Any(list...), nil
+}
+
+// platformArgs ctr命令的--platform参数
+func platformArgs(platform string) []string {
+	var args []string
+	for _, item := range strings.Split(platform, ",") {
+		args = append(args, "--platform", strings.TrimSpace(item))
+	}
+	return args
+}
+
+// imageInfo 读取镜像摘要信息
+func imageInfo(ctx context.Context, store content.Store, image images.Image) ImageInfo {
+	info := ImageInfo{
+		Name:      image.Name,
+		Digest:    image.Target.Digest.String(),
+		MediaType: image.Target.MediaType,
+		CreatedAt: image.CreatedAt,
+		Labels:    image.Labels,
+	}
+	info.Size, _ = image.Size(ctx, store, platforms.Default())
+	if list, err := images.Platforms(ctx, store, image.Target); err == nil {
+		for _, p := range list {
+			info.Platforms = append(info.Platforms, platforms.Format(p))
+		}
+	}
+	return info
+}
+
+// ListImages 列出镜像
+func ListImages(namespace string, filters ...string) ([]ImageInfo, error) {
+	client, err := NewClient(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	list, err := client.ImageService().List(ctx, filters...)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]ImageInfo, 0, len(list))
+	for _, image := range list {
+		infos = append(infos, imageInfo(ctx, client.ContentStore(), image))
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name < infos[j].Name
+	})
+	return infos, nil
+}
+
+// InspectImage 镜像详情，platform为空时读取本机平台的镜像配置
+func InspectImage(namespace, ref, platform string) (ImageDetail, error) {
+	client, err := NewClient(namespace)
+	if err != nil {
+		return ImageDetail{}, err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	name, err := NormalizeImage(ref)
+	if err != nil {
+		return ImageDetail{}, err
+	}
+	image, err := client.ImageService().Get(ctx, name)
+	if err != nil {
+		return ImageDetail{}, fmt.Errorf("镜像%s不存在: %w", name, err)
+	}
+
+	detail := ImageDetail{ImageInfo: imageInfo(ctx, client.ContentStore(), image)}
+	matcher, err := platformMatcher(platform)
+	if err != nil {
+		return detail, err
+	}
+	configDesc, err := images.Config(ctx, client.ContentStore(), image.Target, matcher)
+	if err != nil {
+		// 镜像缺少当前平台时仅返回摘要信息
+		return detail, nil
+	}
+	data, err := content.ReadBlob(ctx, client.ContentStore(), configDesc)
+	if err != nil {
+		return detail, nil
+	}
+	var imageConfig ocispec.Image
+	if err = json.Unmarshal(data, &imageConfig); err == nil {
+		detail.Config = &imageConfig
+	}
+	return detail, nil
+}
+
+// PullImage 拉取镜像并解压，读取containerd hosts.toml中的镜像仓库配置
+func PullImage(namespace, ref, platform string, out io.Writer) error {
+	return pullImage(namespace, ref, platform, out, true)
+}
+
+// FetchImage 拉取镜像但不解压，用于获取其他平台的镜像，多个平台以逗号分隔
+func FetchImage(namespace, ref, platform string, out io.Writer) error {
+	return pullImage(namespace, ref, platform, out, false)
+}
+
+func pullImage(namespace, ref, platform string, out io.Writer, unpack bool) error {
+	name, err := NormalizeImage(ref)
+	if err != nil {
+		return err
+	}
+	if pkg.IsDryRun() {
+		args := []string{"-n", namespaceOrDefault(namespace), "images", "pull", "--hosts-dir", ContainerdCertsPath}
+		if platform != "" {
+			args = append(args, platformArgs(platform)...)
+		}
+		if !unpack {
+			args = append(args, "--skip-unpack")
+		}
+		return pkg.ExecCmd(exec.Command("ctr", append(args, name)...))
+	}
+
+	client, err := NewClient(namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	certsPath, _ := containerdCertsPath(false)
+	resolver := dockerremote.NewResolver(dockerremote.ResolverOptions{
+		Hosts: config.ConfigureHosts(context.Background(), config.HostOptions{
+			HostDir: config.HostDirFromRoot(certsPath),
+		}),
+	})
+
+	matcher, err := platformMatcher(platform)
+	if err != nil {
+		return err
+	}
+	progress := newPullProgress(out)
+	opts := []containerd.RemoteOpt{
+		containerd.WithResolver(resolver),
+		containerd.WithPlatformMatcher(matcher),
+		containerd.WithImageHandler(progress.handler()),
+	}
+	if unpack {
+		image, err := client.Pull(context.Background(), name, append(opts, containerd.WithPullUnpack)...)
+		if err != nil {
+			return fmt.Errorf("拉取镜像%s失败: %w", name, err)
+		}
+		_, _ = fmt.Fprintf(out, "%s: %s\n", image.Name(), image.Target().Digest)
+		return nil
+	}
+	image, err := client.Fetch(context.Background(), name, opts...)
+	if err != nil {
+		return fmt.Errorf("拉取镜像%s失败: %w", name, err)
+	}
+	_, _ = fmt.Fprintf(out, "%s: %s\n", image.Name, image.Target.Digest)
+	return nil
+}
+
+// pullProgress 拉取进度
+type pullProgress struct {
+	mu    sync.Mutex
+	out   io.Writer
+	total int64
+	count int
+}
+
+func newPullProgress(out io.Writer) *pullProgress {
+	return &pullProgress{out: out}
+}
+
+// handler 每获取一个镜像对象输出一行进度
+func (p *pullProgress) handler() images.Handler {
+	return images.HandlerFunc(func(ctx context.Context, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.count++
+		p.total += desc.Size
+		_, _ = fmt.Fprintf(
+			p.out, "[%d] %-12s %s %s (累计%s)\n",
+			p.count, descKind(desc), shortDigest(desc.Digest.String()), pkg.HumanSize(uint64(desc.Size)), pkg.HumanSize(uint64(p.total)),
+		)
+		return nil, nil
+	})
+}
+
+// descKind 镜像对象类型
+func descKind(desc ocispec.Descriptor) string {
+	switch {
+	case images.IsIndexType(desc.MediaType):
+		return "index"
+	case images.IsManifestType(desc.MediaType):
+		return "manifest"
+	case images.IsConfigType(desc.MediaType):
+		return "config"
+	case images.IsLayerType(desc.MediaType):
+		return "layer"
+	}
+	return desc.MediaType
+}
+
+// shortDigest 缩短摘要显示
+func shortDigest(digest string) string {
+	digest = strings.TrimPrefix(digest, "sha256:")
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// TagImage 为镜像添加新名称
+func TagImage(namespace, source, target string) error {
+	sourceName, err := NormalizeImage(source)
+	if err != nil {
+		return err
+	}
+	targetName, err := NormalizeImage(target)
+	if err != nil {
+		return err
+	}
+	if pkg.IsDryRun() {
+		return pkg.ExecCmd(exec.Command("ctr", "-n", namespaceOrDefault(namespace), "images", "tag", "--force", sourceName, targetName))
+	}
+
+	client, err := NewClient(namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	store := client.ImageService()
+	image, err := store.Get(ctx, sourceName)
+	if err != nil {
+		return fmt.Errorf("镜像%s不存在: %w", sourceName, err)
+	}
+	image.Name = targetName
+	if _, err = store.Create(ctx, image); err != nil {
+		if _, err = store.Update(ctx, image, "target"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveImages 删除镜像
+func RemoveImages(namespace string, refs ...string) error {
+	var names []string
+	for _, ref := range refs {
+		name, err := NormalizeImage(ref)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	if pkg.IsDryRun() {
+		return pkg.ExecCmd(exec.Command("ctr", append([]string{"-n", namespaceOrDefault(namespace), "images", "rm", "--sync"}, names...)...))
+	}
+
+	client, err := NewClient(namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	for _, name := range names {
+		if err = client.ImageService().Delete(ctx, name, images.SynchronousDelete()); err != nil {
+			return fmt.Errorf("删除镜像%s失败: %w", name, err)
+		}
+		fmt.Println(name)
+	}
+	return nil
+}
+
+// exportPath 导出文件的主机路径，相对路径按当前目录解析后再置于--root下
+func exportPath(file string) (string, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return "", err
+	}
+	return pkg.HostFS().Path(file), nil
+}
+
+// ExportImages 导出镜像为tar包，platform为空时导出所有平台，多个平台以逗号分隔
+func ExportImages(namespace, file, platform string, refs ...string) error {
+	file, err := exportPath(file)
+	if err != nil {
+		return err
+	}
+	var names []string
+	for _, ref := range refs {
+		name, err := NormalizeImage(ref)
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+	}
+	if pkg.IsDryRun() {
+		args := []string{"-n", namespaceOrDefault(namespace), "images", "export"}
+		if platform != "" {
+			args = append(args, platformArgs(platform)...)
+		} else {
+			args = append(args, "--all-platforms")
+		}
+		return pkg.ExecCmd(exec.Command("ctr", append(append(args, file), names...)...))
+	}
+
+	client, err := NewClient(namespace)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	opts := []archive.ExportOpt{archive.WithSkipMissing(client.ContentStore())}
+	if platform != "" {
+		matcher, err := platformMatcher(platform)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, archive.WithPlatform(matcher))
+	} else {
+		opts = append(opts, archive.WithAllPlatforms())
+	}
+	for _, name := range names {
+		opts = append(opts, archive.WithImage(client.ImageService(), name))
+	}
+
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = client.Export(context.Background(), f, opts...); err != nil {
+		_ = f.Close()
+		_ = os.Remove(file)
+		return fmt.Errorf("导出镜像失败: %w", err)
+	}
+	return f.Close()
+}
+
+// PruneImages 删除未被任何容器使用的镜像，keep中的镜像及其同摘要的其他名称不删除，返回删除的镜像
+func PruneImages(namespace string, keep ...string) ([]string, error) {
+	kept := map[string]bool{}
+	for _, ref := range keep {
+		name, err := NormalizeImage(ref)
+		if err != nil {
+			return nil, err
+		}
+		kept[name] = true
+	}
+
+	client, err := NewClient(namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+
+	ctx := context.Background()
+	containers, err := client.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 容器使用中的镜像按摘要判断，同一镜像的其他名称也会保留
+	used := map[string]bool{}
+	for _, c := range containers {
+		info, err := c.Info(ctx)
+		if err != nil || info.Image == "" {
+			continue
+		}
+		if image, err := client.ImageService().Get(ctx, info.Image); err == nil {
+			used[image.Target.Digest.String()] = true
+		}
+	}
+
+	list, err := client.ImageService().List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, image := range list {
+		if kept[image.Name] {
+			used[image.Target.Digest.String()] = true
+		}
+	}
+	var pruned []string
+	for _, image := range list {
+		if used[image.Target.Digest.String()] {
+			continue
+		}
+		if pkg.IsDryRun() {
+			err = pkg.ExecCmd(exec.Command("ctr", "-n", namespaceOrDefault(namespace), "images", "rm", image.Name))
+		} else {
+			err = client.ImageService().Delete(ctx, image.Name)
+		}
+		if err != nil {
+			return pruned, err
+		}
+		pruned = append(pruned, image.Name)
+	}
+	return pruned, nil
+}
+
+func namespaceOrDefault(namespace string) string {
+	if namespace == "" {
+		return DefaultNamespace
+	}
+	return namespace
+}
+
+// printImages 以表格形式输出镜像列表
+func printImages(out io.Writer, list []ImageInfo) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "IMAGE\tDIGEST\tSIZE\tPLATFORMS")
+	for _, info := range list {
+		_, _ = fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\n",
+			info.Name, shortDigest(info.Digest), pkg.HumanSize(uint64(info.Size)), strings.Join(info.Platforms, ","),
+		)
+	}
+	_ = w.Flush()
+}
+
+var (
+	imageNamespace     string
+	imagePlatform      string
+	imageOutput        string
+	imageInspectOutput string
+	imageFilters       []string
+	imagePruneAll      bool
+	imagePruneDir      string
+)
+
+// imageCmd 镜像管理命令
+var imageCmd = &cobra.Command{
+	Use:   "image",
+	Short: "容器镜像管理",
+	Long:  "通过containerd管理容器镜像，默认命名空间为k8s.io",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+// imageListCmd 列出镜像
+var imageListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "列出镜像",
+	Long:  "列出镜像，--filter 语法与 ctr images ls 一致，如name~=pause",
+	Run: func(cmd *cobra.Command, args []string) {
+		list, err := ListImages(imageNamespace, imageFilters...)
+		if err == nil {
+			if imageOutput == pkg.OutputTable {
+				printImages(os.Stdout, list)
+			} else {
+				err = pkg.PrintStructured(os.Stdout, imageOutput, list)
+			}
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// imagePullCmd 拉取镜像
+var imagePullCmd = &cobra.Command{
+	Use:   "pull <image>",
+	Short: "拉取镜像",
+	Long:  "拉取镜像并解压，使用containerd hosts.toml中配置的镜像仓库",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := PullImage(imageNamespace, args[0], imagePlatform, os.Stdout); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// imageTagCmd 镜像添加新名称
+var imageTagCmd = &cobra.Command{
+	Use:   "tag <source> <target>",
+	Short: "为镜像添加新名称",
+	Long:  "为镜像添加新名称，目标名称已存在时覆盖",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := TagImage(imageNamespace, args[0], args[1]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// imageRemoveCmd 删除镜像
+var imageRemoveCmd = &cobra.Command{
+	Use:   "rm <image>...",
+	Short: "删除镜像",
+	Long:  "删除镜像",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := RemoveImages(imageNamespace, args...); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// imageExportCmd 导出镜像
+var imageExportCmd = &cobra.Command{
+	Use:   "export <file> <image>...",
+	Short: "导出镜像",
+	Long:  "导出镜像为OCI/Docker兼容的tar包，未指定--platform时导出所有平台",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := ExportImages(imageNamespace, args[0], imagePlatform, args[1:]...); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// imagePruneCmd 清理镜像
+var imagePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "清理未使用的镜像",
+	Long: "删除未被任何容器使用的镜像，默认保留sandbox镜像与镜像包目录index.json中的镜像，" +
+		"避免删除离线安装预加载的镜像，--all时一并删除",
+	Run: func(cmd *cobra.Command, args []string) {
+		var keep []string
+		if !imagePruneAll {
+			var err error
+			if keep, err = pruneKeepImages(imagePruneDir); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+		pruned, err := PruneImages(imageNamespace, keep...)
+		for _, name := range pruned {
+			fmt.Println(name)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// pruneKeepImages 清理镜像时保留的sandbox镜像与镜像包中的镜像
+func pruneKeepImages(dir string) ([]string, error) {
+	keep, err := BundleImages(dir)
+	if err != nil {
+		return nil, err
+	}
+	if sandbox, err := SandboxImage(); err == nil && sandbox != "" {
+		keep = append(keep, sandbox)
+	}
+	return keep, nil
+}
+
+// imageInspectCmd 镜像详情
+var imageInspectCmd = &cobra.Command{
+	Use:   "inspect <image>",
+	Short: "查看镜像详情",
+	Long:  "查看镜像详情与镜像配置",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		detail, err := InspectImage(imageNamespace, args[0], imagePlatform)
+		if err == nil {
+			err = pkg.PrintStructured(os.Stdout, imageInspectOutput, detail)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func initImageCmd() {
+	// containerd socket仅root可访问
+	for _, cmd := range []*cobra.Command{imageListCmd, imagePullCmd, imageTagCmd, imageRemoveCmd, imageExportCmd, imagePruneCmd, imageInspectCmd} {
+		system.Require(cmd, system.RequireLinux, system.RequireRoot)
+	}
+	imageCmd.PersistentFlags().StringVarP(&imageNamespace, "namespace", "n", DefaultNamespace, "containerd命名空间")
+	imageListCmd.Flags().StringVarP(&imageOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	imageListCmd.Flags().StringSliceVarP(&imageFilters, "filter", "", nil, "过滤条件，可指定多个")
+	imageInspectCmd.Flags().StringVarP(&imageInspectOutput, "output", "o", pkg.OutputJSON, "输出格式: json|yaml")
+	imagePruneCmd.Flags().BoolVarP(&imagePruneAll, "all", "", false, "同时删除sandbox镜像与镜像包中的镜像")
+	imagePruneCmd.Flags().StringVarP(&imagePruneDir, "image-dir", "", DefaultImageDir(), "镜像包目录，其中index.json记录的镜像不删除")
+	for _, cmd := range []*cobra.Command{imagePullCmd, imageExportCmd, imageInspectCmd} {
+		cmd.Flags().StringVarP(&imagePlatform, "platform", "", "", "平台，如linux/amd64，多个平台以逗号分隔")
+	}
+	imageCmd.AddCommand(imageListCmd, imagePullCmd, imageTagCmd, imageRemoveCmd, imageExportCmd, imagePruneCmd, imageInspectCmd)
+	Cmd.AddCommand(imageCmd)
+}
@@ -0,0 +1,94 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+func TestExportPath(t *testing.T) {
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+	// 临时目录可能为符号链接，以切换后的当前目录为准
+	if dir, err = os.Getwd(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		root string
+		file string
+		want string
+	}{
+		{name: "相对路径", root: "/", file: "out.tar", want: filepath.Join(dir, "out.tar")},
+		{name: "相对子目录", root: "/", file: "./images/../out.tar", want: filepath.Join(dir, "out.tar")},
+		{name: "绝对路径", root: "/", file: "/tmp/out.tar", want: "/tmp/out.tar"},
+		{name: "指定根目录", root: "/mnt/sysroot", file: "out.tar", want: filepath.Join("/mnt/sysroot", dir, "out.tar")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prev := pkg.HostFS()
+			pkg.SetFS(pkg.NewOSFS(tt.root))
+			defer pkg.SetFS(prev)
+
+			got, err := exportPath(tt.file)
+			if err != nil {
+				t.Fatalf("exportPath() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("exportPath(%s) = %s, want %s", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPruneKeepImages(t *testing.T) {
+	dir := t.TempDir()
+	index := `{"kubernetes_version": "v1.30.4", "images": [
+  {"name": "registry.aliyuncs.com/google_containers/kube-apiserver:v1.30.4", "file": "kube-apiserver.tar"},
+  {"name": "docker.io/calico/node:v3.27.0", "file": "calico-node.tar"}
+]}`
+	if err := os.WriteFile(filepath.Join(dir, "index.json"), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := useMemFS(t)
+	if err := m.WriteFile("/etc/containerd/config.toml", []byte(defaultConfigV2), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := pruneKeepImages(dir)
+	if err != nil {
+		t.Fatalf("pruneKeepImages() error = %v", err)
+	}
+	want := []string{
+		"registry.aliyuncs.com/google_containers/kube-apiserver:v1.30.4",
+		"docker.io/calico/node:v3.27.0",
+		"registry.k8s.io/pause:3.6",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("pruneKeepImages() = %v, want %v", got, want)
+	}
+
+	// 没有镜像包与containerd配置时不保留任何镜像
+	useMemFS(t)
+	if got, err = pruneKeepImages(t.TempDir()); err != nil || len(got) != 0 {
+		t.Errorf("pruneKeepImages() = %v, %v, want empty", got, err)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "index.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pruneKeepImages(dir); err == nil {
+		t.Error("pruneKeepImages() should fail on invalid index.json")
+	}
+}
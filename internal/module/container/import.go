@@ -0,0 +1,426 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/archive/compression"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/platforms"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// defaultSnapshotter containerd默认快照器
+const defaultSnapshotter = "overlayfs"
+
+// imageDirName 镜像包目录名
+const imageDirName = "image"
+
+// bundleIndexFile save-images生成的镜像包索引文件
+const bundleIndexFile = "index.json"
+
+// ociLayoutFile OCI layout目录标识文件
+const ociLayoutFile = "oci-layout"
+
+// ociIndexFile OCI layout中记录镜像清单的文件
+const ociIndexFile = "index.json"
+
+// 镜像导入状态
+const (
+	ImportStatusImported = "imported"
+	ImportStatusSkipped  = "skipped"
+	ImportStatusFailed   = "failed"
+)
+
+// ImportTask 镜像导入任务
+type ImportTask struct {
+	Path     string            // tar、tar.gz、tar.zst文件或OCI layout目录
+	Expected map[string]string // 期望导入的镜像名称与摘要，摘要已存在时跳过导入，导入后校验摘要
+}
+
+// ImportResult 镜像导入结果
+type ImportResult struct {
+	Path     string
+	Status   string
+	Images   []string
+	Duration time.Duration
+	Err      error
+}
+
+// Importer 镜像导入器，可并发使用
+type Importer struct {
+	client      *containerd.Client
+	namespace   string
+	snapshotter string
+	platform    string
+	matcher     platforms.MatchComparer
+}
+
+// NewImporter 创建镜像导入器，snapshotter为空时使用containerd配置中的快照器，platform为空时使用本机平台
+func NewImporter(namespace, snapshotter, platform string) (*Importer, error) {
+	matcher, err := platformMatcher(platform)
+	if err != nil {
+		return nil, err
+	}
+	if snapshotter == "" {
+		snapshotter = ConfiguredSnapshotter()
+	}
+	importer := &Importer{
+		namespace:   namespaceOrDefault(namespace),
+		snapshotter: snapshotter,
+		platform:    platform,
+		matcher:     matcher,
+	}
+	if pkg.IsDryRun() {
+		return importer, nil
+	}
+	if importer.client, err = NewClient(namespace); err != nil {
+		return nil, err
+	}
+	return importer, nil
+}
+
+// ConfiguredSnapshotter containerd配置中的快照器，未配置时为overlayfs
+func ConfiguredSnapshotter() string {
+	config, err := LoadContainerdConfig(path.Join(ContainerdConfigPath, "config.toml"))
+	if err != nil {
+		return defaultSnapshotter
+	}
+	if value, err := config.Get("snapshotter"); err == nil {
+		if snapshotter, ok := value.(string); ok && snapshotter != "" {
+			return snapshotter
+		}
+	}
+	return defaultSnapshotter
+}
+
+// Close 断开containerd连接
+func (i *Importer) Close() error {
+	if i.client == nil {
+		return nil
+	}
+	return i.client.Close()
+}
+
+// Import 导入镜像并解压到快照器
+func (i *Importer) Import(task ImportTask) ImportResult {
+	start := time.Now()
+	result := ImportResult{Path: task.Path}
+	var skipped bool
+	result.Images, skipped, result.Err = i.importImages(task)
+	result.Duration = time.Since(start)
+	switch {
+	case result.Err != nil:
+		result.Status = ImportStatusFailed
+	case skipped:
+		result.Status = ImportStatusSkipped
+	default:
+		result.Status = ImportStatusImported
+	}
+	return result
+}
+
+// importImages 返回导入的镜像，镜像均已存在时跳过导入并返回已存在的镜像
+func (i *Importer) importImages(task ImportTask) ([]string, bool, error) {
+	if pkg.IsDryRun() {
+		// 预演模式下不连接containerd，以等价的ctr命令展示导入计划
+		args := []string{"-n", i.namespace, "images", "import", "--snapshotter", i.snapshotter}
+		if i.platform != "" {
+			args = append(args, platformArgs(i.platform)...)
+		}
+		return []string{}, false, pkg.ExecCmd(exec.Command("ctr", append(args, task.Path)...))
+	}
+
+	ctx := context.Background()
+	expected := task.Expected
+	if len(expected) == 0 {
+		// 镜像目录中没有index.json时从镜像包的index.json中读取镜像名称与摘要
+		expected = archiveImages(task.Path)
+	}
+	if i.imported(ctx, expected) {
+		names := make([]string, 0, len(expected))
+		for name := range expected {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, true, nil
+	}
+
+	reader, err := openImageArchive(task.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	list, err := i.client.Import(ctx, reader, containerd.WithImportPlatform(i.matcher))
+	if err != nil {
+		return nil, false, fmt.Errorf("导入%s失败: %w", filepath.Base(task.Path), err)
+	}
+
+	imported := map[string]string{}
+	names := []string{}
+	for _, image := range list {
+		imported[image.Name] = image.Target.Digest.String()
+		names = append(names, image.Name)
+		if err = containerd.NewImageWithPlatform(i.client, image, i.matcher).Unpack(ctx, i.snapshotter); err != nil {
+			return names, false, fmt.Errorf("解压镜像%s到%s失败: %w", image.Name, i.snapshotter, err)
+		}
+	}
+
+	// 校验导入的镜像与期望摘要一致
+	for name, digest := range task.Expected {
+		actual, ok := imported[name]
+		switch {
+		case !ok:
+			return names, false, fmt.Errorf("%s中不包含镜像%s", filepath.Base(task.Path), name)
+		case digest != "" && actual != digest:
+			return names, false, fmt.Errorf("镜像%s摘要校验失败，期望%s，实际%s", name, digest, actual)
+		}
+	}
+	return names, false, nil
+}
+
+// archiveImages 读取镜像包中OCI index.json记录的镜像名称与摘要，
+// 仅包含manifest.json的docker save格式或镜像未命名时无法确定摘要，返回nil
+func archiveImages(path string) map[string]string {
+	var data []byte
+	if info, err := os.Stat(path); err != nil {
+		return nil
+	} else if info.IsDir() {
+		if data, err = os.ReadFile(filepath.Join(path, ociIndexFile)); err != nil {
+			return nil
+		}
+	} else {
+		reader, err := openImageArchive(path)
+		if err != nil {
+			return nil
+		}
+		defer func() {
+			_ = reader.Close()
+		}()
+		tr := tar.NewReader(reader)
+		for data == nil {
+			header, err := tr.Next()
+			if err != nil {
+				return nil
+			}
+			if strings.TrimPrefix(header.Name, "./") == ociIndexFile {
+				if data, err = io.ReadAll(tr); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+
+	var index ocispec.Index
+	if json.Unmarshal(data, &index) != nil {
+		return nil
+	}
+	expected := map[string]string{}
+	for _, desc := range index.Manifests {
+		name := desc.Annotations[images.AnnotationImageName]
+		if name == "" {
+			// 仅有标签的ref.name无法确定镜像名称
+			ref := desc.Annotations[ocispec.AnnotationRefName]
+			if !strings.ContainsAny(ref, "/:") {
+				return nil
+			}
+			var err error
+			if name, err = NormalizeImage(ref); err != nil {
+				return nil
+			}
+		}
+		expected[name] = desc.Digest.String()
+	}
+	if len(expected) == 0 {
+		return nil
+	}
+	return expected
+}
+
+// imported 期望的镜像均已存在且摘要一致时返回true，存在的镜像会补充解压到快照器
+func (i *Importer) imported(ctx context.Context, expected map[string]string) bool {
+	if len(expected) == 0 {
+		return false
+	}
+	for name, digest := range expected {
+		if digest == "" {
+			return false
+		}
+		image, err := i.client.ImageService().Get(ctx, name)
+		if err != nil || image.Target.Digest.String() != digest {
+			return false
+		}
+		if err = containerd.NewImageWithPlatform(i.client, image, i.matcher).Unpack(ctx, i.snapshotter); err != nil && !errdefs.IsAlreadyExists(err) {
+			return false
+		}
+	}
+	return true
+}
+
+// ImageDigest 获取镜像摘要，预演模式下返回空
+func ImageDigest(namespace, ref string) (string, error) {
+	name, err := NormalizeImage(ref)
+	if err != nil {
+		return "", err
+	}
+	if pkg.IsDryRun() {
+		return "", nil
+	}
+	client, err := NewClient(namespace)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		_ = client.Close()
+	}()
+	image, err := client.ImageService().Get(context.Background(), name)
+	if err != nil {
+		return "", fmt.Errorf("镜像%s不存在: %w", name, err)
+	}
+	return image.Target.Digest.String(), nil
+}
+
+// IsImageArchive 是否为可导入的镜像包：tar、tar.gz、tgz、tar.zst文件或OCI layout目录
+func IsImageArchive(path string, info os.FileInfo) bool {
+	if info.IsDir() {
+		_, err := os.Stat(filepath.Join(path, ociLayoutFile))
+		return err == nil
+	}
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz", ".tar.zst"} {
+		if strings.HasSuffix(info.Name(), ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openImageArchive 打开镜像包，压缩包自动解压，OCI layout目录以tar流读取
+func openImageArchive(path string) (io.ReadCloser, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return tarDirectory(path), nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := compression.DecompressStream(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("%s解压失败: %w", filepath.Base(path), err)
+	}
+	return &archiveReader{Reader: stream, closers: []io.Closer{stream, file}}, nil
+}
+
+// archiveReader 关闭时依次关闭解压流与文件
+type archiveReader struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *archiveReader) Close() error {
+	var errs []error
+	for _, c := range r.closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// tarDirectory 将目录打包为tar流
+func tarDirectory(dir string) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(writer)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name, err := filepath.Rel(dir, path)
+			if err != nil || name == "." {
+				return err
+			}
+			if !info.IsDir() && !info.Mode().IsRegular() {
+				return nil
+			}
+			header, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			header.Name = filepath.ToSlash(name)
+			if err = tw.WriteHeader(header); err != nil || info.IsDir() {
+				return err
+			}
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = file.Close()
+			}()
+			_, err = io.Copy(tw, file)
+			return err
+		})
+		if err == nil {
+			err = tw.Close()
+		}
+		_ = writer.CloseWithError(err)
+	}()
+	return reader
+}
+
+// DefaultImageDir 默认镜像包目录，当前目录下不存在image目录时使用程序所在目录下的image目录
+func DefaultImageDir() string {
+	if info, err := os.Stat(imageDirName); err == nil && info.IsDir() {
+		return imageDirName
+	}
+	if exe, err := os.Executable(); err == nil {
+		if exe, err = filepath.EvalSymlinks(exe); err == nil {
+			return filepath.Join(filepath.Dir(exe), imageDirName)
+		}
+	}
+	return imageDirName
+}
+
+// BundleImages 镜像包目录index.json中记录的镜像，目录中没有index.json时返回空
+func BundleImages(dir string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(dir, bundleIndexFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var index struct {
+		Images []struct {
+			Name string `json:"name"`
+		} `json:"images"`
+	}
+	if err = json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("%s解析失败: %w", filepath.Join(dir, bundleIndexFile), err)
+	}
+	names := make([]string, 0, len(index.Images))
+	for _, image := range index.Images {
+		names = append(names, image.Name)
+	}
+	return names, nil
+}
@@ -0,0 +1,289 @@
+package container
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// 离线安装目录
+const (
+	offlineContainerdDir = "/usr/local"
+	offlineRuncPath      = "/usr/local/sbin/runc"
+	offlineCNIDir        = "/opt/cni/bin"
+)
+
+// offlinePackage 离线安装包
+type offlinePackage struct {
+	name     string // 名称
+	pattern  string // 文件名匹配规则
+	required bool   // 是否必需
+	file     string // 匹配到的文件
+}
+
+// offlinePackages 离线安装所需的发行包，均为官方release文件名
+func offlinePackages(arch string) []*offlinePackage {
+	return []*offlinePackage{
+		{name: "containerd", pattern: "containerd-[0-9]*-linux-" + arch + ".tar.gz", required: true},
+		{name: "runc", pattern: "runc." + arch, required: true},
+		{name: "cni-plugins", pattern: "cni-plugins-linux-" + arch + "-v*.tgz"},
+	}
+}
+
+// installContainerdOffline 从本地release包离线安装containerd、runc与CNI插件
+func installContainerdOffline(family system.Family, arch, dir string) error {
+	if err := prepareHost(family); err != nil {
+		return err
+	}
+
+	packages := offlinePackages(arch)
+	if err := findOfflinePackages(dir, packages); err != nil {
+		return err
+	}
+
+	// 校验SHA256
+	checksums, err := readChecksums(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range packages {
+		if p.file == "" {
+			continue
+		}
+		if err = verifyChecksum(p.file, checksums); err != nil {
+			return err
+		}
+	}
+
+	_ = pkg.ExecCmd(exec.Command("systemctl", "stop", "containerd.service"))
+
+	for _, p := range packages {
+		if p.file == "" {
+			log.Printf("未找到%s安装包(%s)，跳过", p.name, p.pattern)
+			continue
+		}
+		log.Printf("正在安装%s: %s", p.name, filepath.Base(p.file))
+		switch p.name {
+		case "containerd":
+			err = extractTarball(p.file, offlineContainerdDir)
+		case "runc":
+			err = installBinary(p.file, offlineRuncPath)
+		case "cni-plugins":
+			err = extractTarball(p.file, offlineCNIDir)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = pkg.WriteFile("/etc/systemd/system/containerd.service", []byte(fmt.Sprintf(`[Unit]
+Description=containerd container runtime
+Documentation=https://containerd.io
+After=network.target local-fs.target
+
+[Service]
+ExecStartPre=-/sbin/modprobe overlay
+ExecStart=%s
+Type=notify
+Delegate=yes
+KillMode=process
+Restart=always
+RestartSec=5
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+OOMScoreAdjust=-999
+
+[Install]
+WantedBy=multi-user.target
+`, path.Join(offlineContainerdDir, "bin", "containerd"))), 0644); err != nil {
+		return err
+	}
+	if err = pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
+		return err
+	}
+
+	// 配置containerd
+	if err = containerdConfig(); err != nil {
+		return err
+	}
+	if err = crictlConfig(ContainerdSockPath); err != nil {
+		return err
+	}
+
+	// 启动containerd服务
+	return pkg.ExecCmd(exec.Command("systemctl", "enable", "--now", "containerd.service"))
+}
+
+// findOfflinePackages 在目录中查找安装包
+func findOfflinePackages(dir string, packages []*offlinePackage) error {
+	for _, p := range packages {
+		matches, err := filepath.Glob(filepath.Join(dir, p.pattern))
+		if err != nil {
+			return err
+		}
+		switch {
+		case len(matches) > 1:
+			return fmt.Errorf("%s存在多个%s安装包: %s", dir, p.name, strings.Join(matches, ", "))
+		case len(matches) == 1:
+			p.file = matches[0]
+		case p.required:
+			return fmt.Errorf("%s中未找到%s安装包(%s)", dir, p.name, p.pattern)
+		}
+	}
+	return nil
+}
+
+// readChecksums 读取目录中的*.sha256sum、*.sha256与SHA256SUMS校验文件
+func readChecksums(dir string) (map[string]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	checksums := map[string]string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, ".sha256sum") || strings.HasSuffix(name, ".sha256") || name == "SHA256SUMS") {
+			continue
+		}
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			// 格式: <sha256>  <文件名>，二进制模式文件名前带*
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			target := strings.TrimSuffix(strings.TrimSuffix(name, ".sha256sum"), ".sha256")
+			if len(fields) > 1 {
+				target = filepath.Base(strings.TrimPrefix(fields[1], "*"))
+			}
+			checksums[target] = strings.ToLower(fields[0])
+		}
+		_ = file.Close()
+		if err = scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return checksums, nil
+}
+
+// verifyChecksum 校验文件SHA256
+func verifyChecksum(file string, checksums map[string]string) error {
+	name := filepath.Base(file)
+	expected, ok := checksums[name]
+	if !ok {
+		return fmt.Errorf("未找到%s的SHA256校验值，请将官方发布的校验文件放在同一目录", name)
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("%s SHA256校验失败，期望%s，实际%s", name, expected, actual)
+	}
+	log.Printf("%s SHA256校验通过", name)
+	return nil
+}
+
+// extractTarball 解压tar.gz中的目录与普通文件到dest
+func extractTarball(file, dest string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("%s解压失败: %w", filepath.Base(file), err)
+	}
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	if err = pkg.MkdirAll(dest, 0755); err != nil {
+		return err
+	}
+	// 已创建的目录
+	dirs := map[string]bool{dest: true}
+	mkdir := func(dir string) error {
+		if dirs[dir] {
+			return nil
+		}
+		dirs[dir] = true
+		return pkg.MkdirAll(dir, 0755)
+	}
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s解压失败: %w", filepath.Base(file), err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name == "." {
+			continue
+		}
+		if name == ".." || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return fmt.Errorf("%s包含非法路径: %s", filepath.Base(file), header.Name)
+		}
+		target := path.Join(dest, name)
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = mkdir(target)
+		case tar.TypeReg:
+			var data []byte
+			if data, err = io.ReadAll(reader); err == nil {
+				if err = mkdir(path.Dir(target)); err == nil {
+					err = pkg.WriteFile(target, data, os.FileMode(header.Mode).Perm())
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// installBinary 安装单个可执行文件
+func installBinary(file, target string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	if err = pkg.MkdirAll(path.Dir(target), 0755); err != nil {
+		return err
+	}
+	return pkg.WriteFile(target, data, 0755)
+}
@@ -0,0 +1,399 @@
+package container
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/pelletier/go-toml"
+	"github.com/spf13/cobra"
+)
+
+// defaultRegistry hosts.toml中作用于所有仓库的配置目录
+const defaultRegistry = "_default"
+
+// Registry 镜像仓库配置
+type Registry struct {
+	Name         string   // 仓库名称，如docker.io、registry.k8s.io
+	Mirrors      []string // 镜像地址，按顺序尝试
+	SkipVerify   bool     // 跳过TLS证书校验
+	CAFile       string   // 自定义CA证书文件
+	Username     string   // 认证用户名
+	Password     string   // 认证密码
+	OverridePath bool     // 镜像地址包含完整API路径(如Harbor代理项目)
+}
+
+// server 仓库上游地址
+func (r Registry) server() string {
+	if r.Name == "docker.io" {
+		return "https://registry-1.docker.io"
+	}
+	return "https://" + r.Name
+}
+
+// hostsDir 仓库在certs.d中的配置目录
+func (r Registry) hostsDir(base string) string {
+	return path.Join(base, r.Name)
+}
+
+// hostsToml 生成containerd hosts.toml
+func (r Registry) hostsToml(caFile string) []byte {
+	var b strings.Builder
+	b.WriteString("# Generated by devops container registry add\n")
+	// _default作用于所有仓库，不指定上游地址
+	if r.Name != defaultRegistry {
+		b.WriteString(fmt.Sprintf("server = %s\n", strconv.Quote(r.server())))
+	}
+	for _, mirror := range r.Mirrors {
+		b.WriteString(fmt.Sprintf("\n[host.%s]\n", strconv.Quote(mirror)))
+		b.WriteString("  capabilities = [\"pull\", \"resolve\"]\n")
+		if r.SkipVerify {
+			b.WriteString("  skip_verify = true\n")
+		}
+		if caFile != "" {
+			b.WriteString(fmt.Sprintf("  ca = %s\n", strconv.Quote(caFile)))
+		}
+		if r.OverridePath {
+			b.WriteString("  override_path = true\n")
+		}
+		if r.Username != "" {
+			auth := base64.StdEncoding.EncodeToString([]byte(r.Username + ":" + r.Password))
+			b.WriteString(fmt.Sprintf("  [host.%s.header]\n", strconv.Quote(mirror)))
+			b.WriteString(fmt.Sprintf("    authorization = %s\n", strconv.Quote("Basic "+auth)))
+		}
+	}
+	return []byte(b.String())
+}
+
+// validateRegistryName 校验仓库名称，名称用作certs.d下的目录名，不能包含路径分隔符或为.与..
+func validateRegistryName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("仓库名称%s无效，应为域名(如docker.io)或_default", name)
+	}
+	return nil
+}
+
+// validate 校验仓库配置
+func (r Registry) validate() error {
+	if err := validateRegistryName(r.Name); err != nil {
+		return err
+	}
+	if len(r.Mirrors) == 0 {
+		return errors.New("至少需要通过--endpoint指定一个镜像地址")
+	}
+	for _, mirror := range r.Mirrors {
+		u, err := url.Parse(mirror)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("镜像地址%s无效，需以http://或https://开头", mirror)
+		}
+	}
+	if r.Password != "" && r.Username == "" {
+		return errors.New("设置--password时需要同时设置--username")
+	}
+	return nil
+}
+
+// AddContainerdRegistry 写入containerd hosts.toml，并确保config.toml中启用了config_path
+func AddContainerdRegistry(r Registry) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+
+	certsPath, err := containerdCertsPath(true)
+	if err != nil {
+		return err
+	}
+	dir := r.hostsDir(certsPath)
+	if err = pkg.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	// 自定义CA证书复制到仓库配置目录
+	var caFile string
+	if r.CAFile != "" {
+		ca, err := os.ReadFile(r.CAFile)
+		if err != nil {
+			return err
+		}
+		caFile = path.Join(dir, path.Base(r.CAFile))
+		if err = pkg.WriteFile(caFile, ca, 0644); err != nil {
+			return err
+		}
+	}
+
+	hostsFile := path.Join(dir, "hosts.toml")
+	if err = pkg.BackupFile(hostsFile); err != nil {
+		return err
+	}
+	// 包含认证信息时仅root可读
+	perm := os.FileMode(0644)
+	if r.Username != "" {
+		perm = 0600
+	}
+	return pkg.WriteFile(hostsFile, r.hostsToml(caFile), perm)
+}
+
+// containerdCertsPath 获取config.toml中的config_path，enable为true且未设置时设置为默认目录
+func containerdCertsPath(enable bool) (string, error) {
+	configFile := path.Join(ContainerdConfigPath, "config.toml")
+	config, err := LoadContainerdConfig(configFile)
+	if err != nil {
+		if pkg.IsDryRun() {
+			return ContainerdCertsPath, nil
+		}
+		return "", fmt.Errorf("读取containerd配置失败，请先执行 devops container install: %w", err)
+	}
+	if configPath, _ := config.Get("config_path"); configPath != nil && configPath != "" {
+		return fmt.Sprint(configPath), nil
+	}
+	if !enable {
+		return ContainerdCertsPath, nil
+	}
+	if err = config.Set("config_path", ContainerdCertsPath); err != nil {
+		return "", err
+	}
+	if err = pkg.BackupFile(configFile); err != nil {
+		return "", err
+	}
+	if err = config.Save(map[string]any{"config_path": ContainerdCertsPath}); err != nil {
+		return "", err
+	}
+	fmt.Println("已在containerd配置中启用config_path，执行 systemctl restart containerd 后生效")
+	return ContainerdCertsPath, nil
+}
+
+// RemoveContainerdRegistry 删除仓库的hosts.toml配置目录
+func RemoveContainerdRegistry(name string) error {
+	if err := validateRegistryName(name); err != nil {
+		return err
+	}
+	certsPath, err := containerdCertsPath(false)
+	if err != nil {
+		return err
+	}
+	dir := path.Join(certsPath, name)
+	if path.Dir(dir) != path.Clean(certsPath) {
+		return fmt.Errorf("仓库%s的配置目录%s不在%s下", name, dir, certsPath)
+	}
+	entries, err := pkg.HostFS().ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("仓库%s未配置", name)
+	}
+	for _, entry := range entries {
+		if err = pkg.Remove(path.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return pkg.Remove(dir)
+}
+
+// AddDockerRegistry 写入daemon.json中的registry-mirrors与insecure-registries
+func AddDockerRegistry(r Registry) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	if r.Name != "docker.io" && !r.SkipVerify && r.CAFile == "" {
+		return fmt.Errorf("Docker仅支持为docker.io配置镜像地址，%s请使用 docker pull 完整镜像地址", r.Name)
+	}
+
+	// 自定义CA证书
+	if r.CAFile != "" {
+		ca, err := os.ReadFile(r.CAFile)
+		if err != nil {
+			return err
+		}
+		for _, mirror := range r.Mirrors {
+			u, _ := url.Parse(mirror)
+			dir := path.Join(DockerConfigPath, "certs.d", u.Host)
+			if err = pkg.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			if err = pkg.WriteFile(path.Join(dir, "ca.crt"), ca, 0644); err != nil {
+				return err
+			}
+		}
+	}
+
+	err := editDockerDaemonConfig(func(config map[string]any) error {
+		if r.Name == "docker.io" {
+			config["registry-mirrors"] = appendUnique(config["registry-mirrors"], r.Mirrors...)
+		}
+		if r.SkipVerify {
+			var hosts []string
+			for _, mirror := range r.Mirrors {
+				u, _ := url.Parse(mirror)
+				hosts = append(hosts, u.Host)
+			}
+			config["insecure-registries"] = appendUnique(config["insecure-registries"], hosts...)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if r.Username != "" {
+		fmt.Println("Docker仓库认证信息请通过 docker login 配置")
+	}
+	return nil
+}
+
+// appendUnique 向daemon.json中的数组追加不重复的值
+func appendUnique(existing any, values ...string) []string {
+	var result []string
+	seen := map[string]bool{}
+	if list, ok := existing.([]any); ok {
+		for _, item := range list {
+			if value, ok := item.(string); ok && !seen[value] {
+				seen[value] = true
+				result = append(result, value)
+			}
+		}
+	}
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// listContainerdRegistries 列出hosts.toml中配置的仓库
+func listContainerdRegistries() error {
+	certsPath, err := containerdCertsPath(false)
+	if err != nil {
+		return err
+	}
+	entries, err := pkg.HostFS().ReadDir(certsPath)
+	if err != nil {
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REGISTRY\tSERVER\tMIRRORS")
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := pkg.ReadFile(path.Join(certsPath, entry.Name(), "hosts.toml"))
+		if err != nil {
+			continue
+		}
+		tree, err := toml.LoadBytes(data)
+		if err != nil {
+			_, _ = fmt.Fprintf(w, "%s\t<解析失败: %v>\t\n", entry.Name(), err)
+			continue
+		}
+		var mirrors []string
+		if hosts, ok := tree.Get("host").(*toml.Tree); ok {
+			mirrors = hosts.Keys()
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%v\t%s\n", entry.Name(), tree.Get("server"), strings.Join(mirrors, ","))
+	}
+	return w.Flush()
+}
+
+var (
+	registry        Registry
+	registryDocker  bool
+	registryRestart bool
+)
+
+// registryCmd 镜像仓库配置命令
+var registryCmd = &cobra.Command{
+	Use:   "registry",
+	Short: "镜像仓库配置",
+	Long:  "配置镜像仓库的镜像地址、证书与认证信息",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+// registryAddCmd 添加镜像仓库配置
+var registryAddCmd = &cobra.Command{
+	Use:   "add <registry>",
+	Short: "添加镜像仓库配置",
+	Long:  "为镜像仓库(如docker.io、registry.k8s.io，_default表示所有仓库)配置镜像地址，写入containerd的hosts.toml，使用--docker时同时写入daemon.json",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		registry.Name = args[0]
+		if err := addRegistry(registry, registryDocker, registryRestart); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// registryRemoveCmd 删除镜像仓库配置
+var registryRemoveCmd = &cobra.Command{
+	Use:   "rm <registry>",
+	Short: "删除镜像仓库配置",
+	Long:  "删除containerd中镜像仓库的hosts.toml配置",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := RemoveContainerdRegistry(args[0]); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// registryListCmd 列出镜像仓库配置
+var registryListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "列出镜像仓库配置",
+	Long:  "列出containerd中已配置的镜像仓库",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := listContainerdRegistries(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// addRegistry 添加镜像仓库配置
+func addRegistry(r Registry, withDocker, restart bool) error {
+	if err := AddContainerdRegistry(r); err != nil {
+		return err
+	}
+	if withDocker {
+		if err := AddDockerRegistry(r); err != nil {
+			return err
+		}
+	}
+	if !restart {
+		return nil
+	}
+	// hosts.toml修改后即时生效，仅daemon.json与config.toml修改需要重启
+	services := []string{"containerd.service"}
+	if withDocker {
+		services = append(services, "docker.service")
+	}
+	return pkg.ExecCmd(exec.Command("systemctl", append([]string{"restart"}, services...)...))
+}
+
+func initRegistryCmd() {
+	system.Require(registryAddCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(registryRemoveCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(registryListCmd, system.RequireLinux)
+	registryAddCmd.Flags().StringSliceVarP(&registry.Mirrors, "endpoint", "e", nil, "镜像地址，可指定多个，按顺序尝试")
+	registryAddCmd.Flags().BoolVarP(&registry.SkipVerify, "skip-verify", "", false, "跳过TLS证书校验")
+	registryAddCmd.Flags().StringVarP(&registry.CAFile, "ca-file", "", "", "自定义CA证书文件")
+	registryAddCmd.Flags().StringVarP(&registry.Username, "username", "u", "", "认证用户名")
+	registryAddCmd.Flags().StringVarP(&registry.Password, "password", "p", "", "认证密码")
+	registryAddCmd.Flags().BoolVarP(&registry.OverridePath, "override-path", "", false, "镜像地址包含完整API路径(如https://harbor.example.com/v2/proxy)")
+	registryAddCmd.Flags().BoolVarP(&registryDocker, "docker", "", false, "同时配置Docker的daemon.json")
+	registryAddCmd.Flags().BoolVarP(&registryRestart, "restart", "", false, "配置后重启容器运行时")
+	registryCmd.AddCommand(registryAddCmd, registryRemoveCmd, registryListCmd)
+	Cmd.AddCommand(registryCmd)
+}
@@ -0,0 +1,124 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// containerKubernetesVersion 容器运行时对应的Kubernetes版本，用于确定pause镜像
+var containerKubernetesVersion string
+
+// criDockerdServicePath cri-dockerd服务文件
+const criDockerdServicePath = "/etc/systemd/system/cri-docker.service"
+
+// containerdVersionPattern containerd --version输出中的版本号
+var containerdVersionPattern = regexp.MustCompile(`\sv?(\d+\.\d+\.\d+\S*)`)
+
+// PauseImage Kubernetes版本对应的pause镜像，使用当前镜像源
+func PauseImage(k8sVersion string) (string, error) {
+	release, err := compat.Lookup(k8sVersion)
+	if err != nil {
+		return "", err
+	}
+	return mirror.Current().Image(release.PauseImage()), nil
+}
+
+// ContainerdVersion 已安装的containerd版本
+func ContainerdVersion() (string, error) {
+	out, err := pkg.CmdOutput(exec.Command("containerd", "--version"))
+	if err != nil {
+		return "", fmt.Errorf("获取containerd版本失败: %w", err)
+	}
+	if len(out) == 0 && pkg.IsDryRun() {
+		return "", errors.New("预演模式无法获取containerd版本")
+	}
+	match := containerdVersionPattern.FindStringSubmatch(string(out))
+	if match == nil {
+		return "", fmt.Errorf("无法解析containerd版本: %s", strings.TrimSpace(string(out)))
+	}
+	return match[1], nil
+}
+
+// CheckContainerdVersion 检查已安装的containerd版本是否在Kubernetes版本支持范围内
+func CheckContainerdVersion(k8sVersion string) error {
+	release, err := compat.Lookup(k8sVersion)
+	if err != nil {
+		return err
+	}
+	version, err := ContainerdVersion()
+	if err != nil {
+		return err
+	}
+	if !release.Containerd.Contains(version) {
+		return fmt.Errorf(
+			"containerd %s不在Kubernetes %s支持的范围%s内",
+			version, release.Kubernetes, release.Containerd,
+		)
+	}
+	return nil
+}
+
+// SandboxImage containerd配置中的sandbox镜像
+func SandboxImage() (string, error) {
+	config, err := LoadContainerdConfig(path.Join(ContainerdConfigPath, "config.toml"))
+	if err != nil {
+		return "", err
+	}
+	value, err := config.Get("sandbox_image")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprint(value), nil
+}
+
+// SyncSandboxImage 将容器运行时的sandbox镜像更新为Kubernetes版本对应的pause镜像，已一致时不做修改
+func SyncSandboxImage(withDocker bool, k8sVersion string) error {
+	image, err := PauseImage(k8sVersion)
+	if err != nil {
+		return err
+	}
+
+	if withDocker {
+		data, _ := pkg.ReadFile(criDockerdServicePath)
+		if strings.Contains(string(data), "--pod-infra-container-image="+image+"\n") {
+			return nil
+		}
+		log.Printf("更新cri-dockerd pause镜像为%s", image)
+		if err = writeCriDockerdService(image); err != nil {
+			return err
+		}
+		if err = pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
+			return err
+		}
+		return pkg.ExecCmd(exec.Command("systemctl", "restart", "cri-docker.service"))
+	}
+
+	configFilePath := path.Join(ContainerdConfigPath, "config.toml")
+	config, err := LoadContainerdConfig(configFilePath)
+	if err != nil {
+		return err
+	}
+	if current, _ := config.Get("sandbox_image"); current == image {
+		return nil
+	}
+	log.Printf("更新containerd sandbox镜像为%s", image)
+	if err = config.Set("sandbox_image", image); err != nil {
+		return err
+	}
+	if err = pkg.BackupFile(configFilePath); err != nil {
+		return err
+	}
+	if err = config.Save(map[string]any{"sandbox_image": image}); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(exec.Command("systemctl", "restart", "containerd.service"))
+}
@@ -0,0 +1,455 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// addonManifestDir 插件渲染后的资源清单目录，disable时据此删除资源
+const addonManifestDir = "/etc/kubernetes/addons"
+
+// 插件状态
+const (
+	AddonStatusReady        = "ready"
+	AddonStatusNotReady     = "not-ready"
+	AddonStatusNotInstalled = "not-installed"
+	AddonStatusUnknown      = "unknown"
+)
+
+// AddonParam 插件参数，以--<name>参数传入
+type AddonParam struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	Default     string `json:"default,omitempty" yaml:"default,omitempty"`
+	Bool        bool   `json:"bool,omitempty" yaml:"bool,omitempty"`
+	Required    bool   `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// Addon 集群插件
+type Addon struct {
+	Name        string            `json:"name" yaml:"name"`
+	Description string            `json:"description" yaml:"description"`
+	Namespace   string            `json:"namespace" yaml:"namespace"`
+	Manifests   []string          `json:"manifests" yaml:"manifests"`                 // 资源清单名称
+	Images      []string          `json:"images" yaml:"images"`                       // 引用的镜像，save-images据此打包
+	Renames     map[string]string `json:"renames,omitempty" yaml:"renames,omitempty"` // 镜像仓库在镜像源中的名称
+	Params      []AddonParam      `json:"params,omitempty" yaml:"params,omitempty"`
+	Ready       []string          `json:"ready" yaml:"ready"` // 就绪检查资源，如deployment/metrics-server
+	Notes       string            `json:"notes,omitempty" yaml:"notes,omitempty"`
+
+	// Patch 根据参数修改资源清单
+	Patch func(manifest []byte, params map[string]string) ([]byte, error) `json:"-" yaml:"-"`
+	// Extra 插件就绪后应用的资源，如MetalLB地址池
+	Extra func(params map[string]string) ([]byte, error) `json:"-" yaml:"-"`
+}
+
+// Version 插件版本，取第一个资源清单的版本
+func (a Addon) Version() string {
+	if m, err := manifests.Get(a.Manifests[0]); err == nil {
+		return m.Version
+	}
+	return "-"
+}
+
+// getAddon 查找插件
+func getAddon(name string) (Addon, error) {
+	for _, addon := range addons {
+		if addon.Name == name {
+			return addon, nil
+		}
+	}
+	var names []string
+	for _, addon := range addons {
+		names = append(names, addon.Name)
+	}
+	return Addon{}, fmt.Errorf("插件%s不存在，可选%s", name, strings.Join(names, "、"))
+}
+
+// addonParams 合并插件参数默认值并校验必填参数，values中不属于该插件的参数返回错误
+func addonParams(addon Addon, values map[string]string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, param := range addon.Params {
+		params[param.Name] = param.Default
+	}
+	for name, value := range values {
+		if _, ok := params[name]; !ok {
+			return nil, fmt.Errorf("参数--%s不适用于插件%s", name, addon.Name)
+		}
+		params[name] = value
+	}
+	for _, param := range addon.Params {
+		if param.Required && params[param.Name] == "" {
+			return nil, fmt.Errorf("插件%s缺少必填参数--%s: %s", addon.Name, param.Name, param.Description)
+		}
+		if param.Bool {
+			value, err := strconv.ParseBool(params[param.Name])
+			if err != nil {
+				return nil, fmt.Errorf("参数--%s的值%s无效，应为true或false", param.Name, params[param.Name])
+			}
+			params[param.Name] = strconv.FormatBool(value)
+		}
+	}
+	return params, nil
+}
+
+// renderAddon 读取插件资源清单，按参数修改并替换镜像
+func renderAddon(addon Addon, params map[string]string) ([]byte, error) {
+	var docs []string
+	for _, name := range addon.Manifests {
+		data, err := manifests.Read(name)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, strings.TrimSuffix(string(data), "\n"))
+	}
+	manifest := []byte(strings.Join(docs, "\n---\n") + "\n")
+	if addon.Patch != nil {
+		var err error
+		if manifest, err = addon.Patch(manifest, params); err != nil {
+			return nil, err
+		}
+	}
+	return rewriteManifestImages(manifest, addon.imageRewrites())
+}
+
+// imageRewrites 插件镜像在镜像源中的替换规则，仅在使用镜像源替代registry.k8s.io时生效
+func (a Addon) imageRewrites() []mirror.ImageRewrite {
+	profile := mirror.Current()
+	if profile.ImageRepository == "" || profile.ImageRepository == "registry.k8s.io" {
+		return nil
+	}
+	var rules []mirror.ImageRewrite
+	for repo, name := range a.Renames {
+		rules = append(rules, mirror.ImageRewrite{From: repo, To: profile.Image(name)})
+	}
+	return rules
+}
+
+// addonFiles 插件资源清单与附加资源文件
+func addonFiles(addon Addon) (manifest, extra string) {
+	return filepath.Join(addonManifestDir, addon.Name+".yaml"), filepath.Join(addonManifestDir, addon.Name+"-extra.yaml")
+}
+
+// enableAddon 安装插件，wait为0时不等待就绪
+func enableAddon(addon Addon, values map[string]string, wait time.Duration) error {
+	params, err := addonParams(addon, values)
+	if err != nil {
+		return err
+	}
+	manifest, err := renderAddon(addon, params)
+	if err != nil {
+		return err
+	}
+	var extra []byte
+	if addon.Extra != nil {
+		if extra, err = addon.Extra(params); err != nil {
+			return err
+		}
+	}
+	if len(extra) > 0 && wait == 0 {
+		return fmt.Errorf("插件%s需要在就绪后创建附加资源，不能关闭等待", addon.Name)
+	}
+
+	manifestFile, extraFile := addonFiles(addon)
+	if err = pkg.MkdirAll(addonManifestDir, 0755); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile(manifestFile, manifest, 0644); err != nil {
+		return err
+	}
+	log.Printf("安装插件%s %s...", addon.Name, addon.Version())
+	if err = pkg.ExecCmd(exec.Command("kubectl", "apply", "-f", manifestFile)); err != nil {
+		return err
+	}
+	if wait > 0 {
+		if err = waitAddon(addon, wait); err != nil {
+			return err
+		}
+	}
+	if len(extra) > 0 {
+		if err = pkg.WriteFile(extraFile, extra, 0644); err != nil {
+			return err
+		}
+		if err = pkg.ExecCmd(exec.Command("kubectl", "apply", "-f", extraFile)); err != nil {
+			return err
+		}
+	}
+	if addon.Notes != "" {
+		fmt.Println(addon.Notes)
+	}
+	return nil
+}
+
+// waitAddon 等待插件的就绪检查资源完成滚动更新
+func waitAddon(addon Addon, timeout time.Duration) error {
+	for _, resource := range addon.Ready {
+		if err := pkg.ExecCmd(exec.Command(
+			"kubectl", "-n", addon.Namespace, "rollout", "status", resource, "--timeout", timeout.String(),
+		)); err != nil {
+			return fmt.Errorf("插件%s未就绪: %w", addon.Name, err)
+		}
+	}
+	return nil
+}
+
+// disableAddon 删除插件资源，优先使用安装时的资源清单
+func disableAddon(addon Addon) error {
+	manifestFile, extraFile := addonFiles(addon)
+	if pkg.FileExists(extraFile) {
+		if err := pkg.ExecCmd(exec.Command("kubectl", "delete", "--ignore-not-found", "-f", extraFile)); err != nil {
+			return err
+		}
+		if err := pkg.Remove(extraFile); err != nil {
+			return err
+		}
+	}
+	if !pkg.FileExists(manifestFile) {
+		// 未通过本工具安装时使用默认参数渲染资源清单
+		params := map[string]string{}
+		for _, param := range addon.Params {
+			params[param.Name] = param.Default
+		}
+		manifest, err := renderAddon(addon, params)
+		if err != nil {
+			return err
+		}
+		if err = pkg.MkdirAll(addonManifestDir, 0755); err != nil {
+			return err
+		}
+		if err = pkg.WriteFile(manifestFile, manifest, 0644); err != nil {
+			return err
+		}
+	}
+	log.Printf("删除插件%s...", addon.Name)
+	if err := pkg.ExecCmd(exec.Command("kubectl", "delete", "--ignore-not-found", "-f", manifestFile)); err != nil {
+		return err
+	}
+	return pkg.Remove(manifestFile)
+}
+
+// AddonState 插件状态
+type AddonState struct {
+	Name      string `json:"name" yaml:"name"`
+	Version   string `json:"version" yaml:"version"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Status    string `json:"status" yaml:"status"`
+	Message   string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// addonState 通过就绪检查资源判断插件状态
+func addonState(addon Addon) AddonState {
+	state := AddonState{Name: addon.Name, Version: addon.Version(), Namespace: addon.Namespace, Status: AddonStatusReady}
+	for _, resource := range addon.Ready {
+		out, err := pkg.CmdOutput(exec.Command(
+			"kubectl", "-n", addon.Namespace, "get", resource,
+			"-o", "jsonpath={.status.numberAvailable}{.status.availableReplicas}/{.status.desiredNumberScheduled}{.spec.replicas}",
+		))
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			out = exitErr.Stderr
+		}
+		message := strings.TrimSpace(string(out))
+		switch {
+		case err == nil && len(out) == 0 && pkg.IsDryRun():
+			state.Status, state.Message = AddonStatusUnknown, "预演模式不查询集群"
+			return state
+		case err != nil && strings.Contains(message, "NotFound"):
+			state.Status, state.Message = AddonStatusNotInstalled, ""
+			return state
+		case err != nil:
+			state.Status, state.Message = AddonStatusUnknown, message
+			if errors.Is(err, exec.ErrNotFound) {
+				state.Message = "未安装kubectl"
+			}
+			return state
+		}
+		ready, desired, _ := strings.Cut(message, "/")
+		if ready != desired || desired == "" {
+			state.Status = AddonStatusNotReady
+			state.Message = strings.TrimSpace(state.Message + " " + resource + " " + message)
+		}
+	}
+	return state
+}
+
+var (
+	addonOutput  string
+	addonWait    bool
+	addonTimeout time.Duration
+	addonValues  = map[string]pflag.Value{}
+)
+
+// addonCmd 集群插件
+var addonCmd = &cobra.Command{
+	Use:   "addon",
+	Short: "集群插件",
+	Long:  "安装、删除与查看集群插件，插件镜像使用当前镜像源，资源清单可通过--manifest-dir覆盖",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+// addonListCmd 查看插件列表
+var addonListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "查看可用插件",
+	Long:  "查看可用插件及其参数",
+	Run: func(cmd *cobra.Command, args []string) {
+		if addonOutput != pkg.OutputTable {
+			if err := pkg.PrintStructured(os.Stdout, addonOutput, addons); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tVERSION\tNAMESPACE\tPARAMS\tDESCRIPTION")
+		for _, addon := range addons {
+			var params []string
+			for _, param := range addon.Params {
+				name := "--" + param.Name
+				if param.Required {
+					name += "(必填)"
+				}
+				params = append(params, name)
+			}
+			if len(params) == 0 {
+				params = []string{"-"}
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", addon.Name, addon.Version(), addon.Namespace, strings.Join(params, ","), addon.Description)
+		}
+		_ = w.Flush()
+	},
+}
+
+// addonEnableCmd 安装插件
+var addonEnableCmd = &cobra.Command{
+	Use:   "enable <name>",
+	Short: "安装插件",
+	Long:  "安装插件并等待就绪，插件参数见addon list",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		addon, err := getAddon(args[0])
+		if err == nil {
+			values := map[string]string{}
+			for name, value := range addonValues {
+				if cmd.Flags().Changed(name) {
+					values[name] = value.String()
+				}
+			}
+			wait := addonTimeout
+			if !addonWait {
+				wait = 0
+			}
+			err = enableAddon(addon, values, wait)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// addonDisableCmd 删除插件
+var addonDisableCmd = &cobra.Command{
+	Use:   "disable <name>",
+	Short: "删除插件",
+	Long:  "删除插件创建的全部资源",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		addon, err := getAddon(args[0])
+		if err == nil {
+			err = disableAddon(addon)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// addonStatusCmd 查看插件状态
+var addonStatusCmd = &cobra.Command{
+	Use:   "status [name...]",
+	Short: "查看插件状态",
+	Long:  "查看插件是否安装与就绪，未指定插件时查看全部",
+	Run: func(cmd *cobra.Command, args []string) {
+		list := addons
+		if len(args) > 0 {
+			list = nil
+			for _, name := range args {
+				addon, err := getAddon(name)
+				if err != nil {
+					fmt.Println(err.Error())
+					os.Exit(1)
+				}
+				list = append(list, addon)
+			}
+		}
+		var states []AddonState
+		for _, addon := range list {
+			states = append(states, addonState(addon))
+		}
+		if addonOutput != pkg.OutputTable {
+			if err := pkg.PrintStructured(os.Stdout, addonOutput, states); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tVERSION\tNAMESPACE\tSTATUS\tMESSAGE")
+		for _, state := range states {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", state.Name, state.Version, state.Namespace, state.Status, state.Message)
+		}
+		_ = w.Flush()
+	},
+}
+
+func initAddonCmd() {
+	addonListCmd.Flags().StringVarP(&addonOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	addonStatusCmd.Flags().StringVarP(&addonOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	addonEnableCmd.Flags().BoolVarP(&addonWait, "wait", "", true, "等待插件就绪")
+	addonEnableCmd.Flags().DurationVarP(&addonTimeout, "timeout", "", 5*time.Minute, "等待就绪超时时间")
+
+	// 注册全部插件的参数，参数名在插件间唯一
+	params := map[string]AddonParam{}
+	for _, addon := range addons {
+		for _, param := range addon.Params {
+			params[param.Name] = param
+		}
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := params[name]
+		if param.Bool {
+			// 布尔参数可省略取值，如--kubelet-insecure-tls
+			value, _ := strconv.ParseBool(param.Default)
+			addonEnableCmd.Flags().BoolP(name, "", value, param.Description)
+		} else {
+			addonEnableCmd.Flags().StringP(name, "", param.Default, param.Description)
+		}
+		addonValues[name] = addonEnableCmd.Flags().Lookup(name).Value
+	}
+
+	addonCmd.AddCommand(addonListCmd, addonEnableCmd, addonDisableCmd, addonStatusCmd)
+}
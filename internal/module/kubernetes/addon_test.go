@@ -0,0 +1,51 @@
+package kubernetes
+
+import (
+	"testing"
+)
+
+func TestAddonState(t *testing.T) {
+	const jsonpath = "-o jsonpath={.status.numberAvailable}{.status.availableReplicas}/{.status.desiredNumberScheduled}{.spec.replicas}"
+	addon, err := getAddon("metallb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		runner      fakeRunner
+		wantStatus  string
+		wantMessage string
+	}{
+		{
+			name: "全部就绪",
+			runner: fakeRunner{
+				"kubectl -n metallb-system get deployment/controller " + jsonpath: "1/1",
+				"kubectl -n metallb-system get daemonset/speaker " + jsonpath:     "3/3",
+			},
+			wantStatus: AddonStatusReady,
+		},
+		{
+			name: "部分未就绪",
+			runner: fakeRunner{
+				"kubectl -n metallb-system get deployment/controller " + jsonpath: "1/1",
+				"kubectl -n metallb-system get daemonset/speaker " + jsonpath:     "2/3",
+			},
+			wantStatus:  AddonStatusNotReady,
+			wantMessage: "daemonset/speaker 2/3",
+		},
+		{
+			name:       "查询失败",
+			runner:     fakeRunner{},
+			wantStatus: AddonStatusUnknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRunner(t, tt.runner)
+			state := addonState(addon)
+			if state.Status != tt.wantStatus || state.Message != tt.wantMessage {
+				t.Errorf("addonState() = %s, %q, want %s, %q", state.Status, state.Message, tt.wantStatus, tt.wantMessage)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+)
+
+// addons 插件注册表
+var addons = []Addon{
+	{
+		Name:        "metrics-server",
+		Description: "集群资源指标，kubectl top与HPA依赖",
+		Namespace:   "kube-system",
+		Manifests:   []string{manifests.MetricsServer},
+		Images:      []string{"k8s.gcr.io/metrics-server/metrics-server:v0.6.1"},
+		Params: []AddonParam{
+			{Name: "kubelet-insecure-tls", Description: "不校验kubelet证书，kubelet使用自签名证书时需要开启", Bool: true, Default: "false"},
+		},
+		Ready: []string{"deployment/metrics-server"},
+		Patch: func(manifest []byte, params map[string]string) ([]byte, error) {
+			if params["kubelet-insecure-tls"] != "true" {
+				return manifest, nil
+			}
+			return insertAfter(manifest, "        - --metric-resolution=15s\n", "        - --kubelet-insecure-tls\n")
+		},
+	},
+	{
+		Name:        "ingress-nginx",
+		Description: "Ingress控制器，以NodePort方式暴露",
+		Namespace:   "ingress-nginx",
+		Manifests:   []string{manifests.IngressNginx},
+		Images: []string{
+			"registry.k8s.io/ingress-nginx/controller:v1.11.2",
+			"registry.k8s.io/ingress-nginx/kube-webhook-certgen:v1.4.3",
+		},
+		Renames: map[string]string{
+			"registry.k8s.io/ingress-nginx/controller":           "nginx-ingress-controller",
+			"registry.k8s.io/ingress-nginx/kube-webhook-certgen": "kube-webhook-certgen",
+		},
+		Ready: []string{"deployment/ingress-nginx-controller"},
+		Notes: "查看访问端口: kubectl -n ingress-nginx get service ingress-nginx-controller",
+	},
+	{
+		Name:        "local-path-provisioner",
+		Description: "基于节点本地目录的动态存储",
+		Namespace:   "local-path-storage",
+		Manifests:   []string{manifests.LocalPath},
+		Images:      []string{"docker.io/rancher/local-path-provisioner:v0.0.30", "docker.io/library/busybox:latest"},
+		Params: []AddonParam{
+			{Name: "local-path-dir", Description: "节点上的存储目录", Default: "/opt/local-path-provisioner"},
+			{Name: "default-storage-class", Description: "设置local-path为默认StorageClass", Bool: true, Default: "false"},
+		},
+		Ready: []string{"deployment/local-path-provisioner"},
+		Patch: func(manifest []byte, params map[string]string) ([]byte, error) {
+			// 辅助Pod定义在ConfigMap中，不属于工作负载，单独替换镜像
+			manifest = []byte(strings.ReplaceAll(string(manifest), "image: busybox\n", "image: "+mirror.Current().RewriteImage("busybox")+"\n"))
+			var err error
+			if dir := params["local-path-dir"]; dir != "/opt/local-path-provisioner" {
+				if !strings.HasPrefix(dir, "/") {
+					return nil, fmt.Errorf("存储目录%s必须为绝对路径", dir)
+				}
+				manifest = []byte(strings.ReplaceAll(string(manifest), `"/opt/local-path-provisioner"`, fmt.Sprintf("%q", dir)))
+			}
+			if params["default-storage-class"] == "true" {
+				manifest, err = insertAfter(
+					manifest,
+					"kind: StorageClass\nmetadata:\n  name: local-path\n",
+					"  annotations:\n    storageclass.kubernetes.io/is-default-class: \"true\"\n",
+				)
+			}
+			return manifest, err
+		},
+	},
+	{
+		Name:        "metallb",
+		Description: "裸金属LoadBalancer，使用L2模式宣告地址池",
+		Namespace:   "metallb-system",
+		Manifests:   []string{manifests.MetalLB},
+		Images:      []string{"quay.io/metallb/controller:v0.14.8", "quay.io/metallb/speaker:v0.14.8"},
+		Params: []AddonParam{
+			{Name: "metallb-addresses", Description: "LoadBalancer地址池，逗号分隔，如192.168.1.240-192.168.1.250", Required: true},
+		},
+		Ready: []string{"deployment/controller", "daemonset/speaker"},
+		Extra: func(params map[string]string) ([]byte, error) {
+			var addresses []string
+			for _, address := range strings.Split(params["metallb-addresses"], ",") {
+				if address = strings.TrimSpace(address); address != "" {
+					addresses = append(addresses, fmt.Sprintf("  - %s\n", address))
+				}
+			}
+			return []byte(`apiVersion: metallb.io/v1beta1
+kind: IPAddressPool
+metadata:
+  name: default
+  namespace: metallb-system
+spec:
+  addresses:
+` + strings.Join(addresses, "") + `---
+apiVersion: metallb.io/v1beta1
+kind: L2Advertisement
+metadata:
+  name: default
+  namespace: metallb-system
+spec:
+  ipAddressPools:
+  - default
+`), nil
+		},
+	},
+	{
+		Name:        "dashboard",
+		Description: "Kubernetes Dashboard",
+		Namespace:   "kubernetes-dashboard",
+		Manifests:   []string{manifests.Dashboard},
+		Images:      []string{"docker.io/kubernetesui/dashboard:v2.7.0", "docker.io/kubernetesui/metrics-scraper:v1.0.8"},
+		Params: []AddonParam{
+			{Name: "dashboard-admin", Description: "创建集群管理员账号dashboard-admin", Bool: true, Default: "false"},
+		},
+		Ready: []string{"deployment/kubernetes-dashboard", "deployment/dashboard-metrics-scraper"},
+		Notes: "访问: kubectl proxy后打开 http://localhost:8001/api/v1/namespaces/kubernetes-dashboard/services/https:kubernetes-dashboard:/proxy/\n" +
+			"使用--dashboard-admin安装时获取登录令牌: kubectl -n kubernetes-dashboard create token dashboard-admin",
+		Extra: func(params map[string]string) ([]byte, error) {
+			if params["dashboard-admin"] != "true" {
+				return nil, nil
+			}
+			return []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: dashboard-admin
+  namespace: kubernetes-dashboard
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: dashboard-admin
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: cluster-admin
+subjects:
+- kind: ServiceAccount
+  name: dashboard-admin
+  namespace: kubernetes-dashboard
+`), nil
+		},
+	},
+}
+
+// insertAfter 在资源清单的anchor之后插入内容，未找到anchor时返回错误
+func insertAfter(manifest []byte, anchor, content string) ([]byte, error) {
+	i := strings.Index(string(manifest), anchor)
+	if i < 0 {
+		return nil, fmt.Errorf("资源清单中未找到%q，无法修改", strings.TrimSpace(anchor))
+	}
+	i += len(anchor)
+	return []byte(string(manifest[:i]) + content + string(manifest[i:])), nil
+}
@@ -0,0 +1,247 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+)
+
+// imageIndexFile 镜像包索引文件
+const imageIndexFile = "index.json"
+
+// bundleManifests 需要打包镜像的资源清单
+var bundleManifests = []string{manifests.Calico, manifests.Flannel, manifests.KubeVIP}
+
+// ImageIndex 镜像包索引，记录镜像与tar文件的对应关系
+type ImageIndex struct {
+	KubernetesVersion string       `json:"kubernetes_version"`
+	ImageRepository   string       `json:"image_repository"`
+	Platforms         []string     `json:"platforms"`
+	CreatedAt         time.Time    `json:"created_at"`
+	Images            []IndexImage `json:"images"`
+}
+
+// IndexImage 镜像包中的镜像
+type IndexImage struct {
+	Name   string `json:"name"`
+	Digest string `json:"digest,omitempty"` // 镜像摘要，load-image据此跳过已存在的镜像并校验
+	File   string `json:"file"`
+	Source string `json:"source"` // kubernetes、资源清单文件名或addon/插件名
+}
+
+// kubernetesImages Kubernetes组件镜像，优先使用kubeadm计算，未安装kubeadm时使用版本兼容矩阵，
+// 矩阵中etcd与coredns按次版本的最新补丁版本记录，较早的补丁版本可能内置更旧的版本
+func kubernetesImages(k8sVersion, imageRepository string) ([]string, error) {
+	version := compat.NormalizeVersion(k8sVersion)
+	out, err := pkg.CmdOutput(exec.Command(
+		"kubeadm", "config", "images", "list",
+		"--kubernetes-version", version,
+		"--image-repository", imageRepository,
+	))
+	// 预演模式没有输出，按版本兼容矩阵列出镜像
+	if err == nil && len(out) > 0 {
+		return strings.Fields(string(out)), nil
+	}
+
+	release, err := compat.Lookup(version)
+	if err != nil {
+		return nil, fmt.Errorf("未安装kubeadm，%w", err)
+	}
+	if !pkg.IsDryRun() {
+		log.Printf(
+			"警告: 未安装kubeadm，etcd:%s与coredns:%s取自兼容矩阵中%s的最新补丁版本，可能与%s内置版本不同，建议安装对应版本的kubeadm后制作镜像包",
+			release.Etcd, release.CoreDNS, release.Kubernetes, version,
+		)
+	}
+	var list []string
+	for _, name := range []string{"kube-apiserver", "kube-controller-manager", "kube-scheduler", "kube-proxy"} {
+		list = append(list, fmt.Sprintf("%s/%s:%s", imageRepository, name, version))
+	}
+	// 使用自定义镜像仓库时kubeadm不保留coredns/子路径
+	coreDNS := imageRepository + "/coredns:" + release.CoreDNS
+	if imageRepository == "registry.k8s.io" {
+		coreDNS = imageRepository + "/coredns/coredns:" + release.CoreDNS
+	}
+	return append(list,
+		fmt.Sprintf("%s/pause:%s", imageRepository, release.Pause),
+		fmt.Sprintf("%s/etcd:%s", imageRepository, release.Etcd),
+		coreDNS,
+	), nil
+}
+
+// manifestImages 读取资源清单中工作负载引用的镜像，模板使用默认集群配置渲染
+func manifestImages(name string) ([]string, error) {
+	m, err := manifests.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch {
+	case name == manifests.KubeVIP:
+		data, err = renderTemplate(name, newKubeVIPTemplateData(HASpec{VIP: "127.0.0.1"}, haNode{BindPort: 6443}))
+	case m.Template:
+		spec := defaultClusterSpec()
+		spec.CNI.Plugin = name
+		spec.CNI = spec.CNI.withDefaults()
+		data, err = renderTemplate(name, newCNITemplateData(spec))
+	default:
+		data, err = manifests.Read(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	images, err := manifests.Images(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", m.File, err)
+	}
+	var list []string
+	for _, image := range images {
+		list = append(list, image.Image)
+	}
+	return list, nil
+}
+
+// imageFileName 镜像对应的tar文件名
+func imageFileName(name string) string {
+	return strings.NewReplacer("/", "_", ":", "_", "@", "_").Replace(name) + ".tar"
+}
+
+// bundleImages 计算镜像包中的全部镜像并去重，addonNames为需要打包镜像的插件
+func bundleImages(k8sVersion, imageRepository string, addonNames []string) ([]IndexImage, error) {
+	var list []IndexImage
+	seen := map[string]bool{}
+	add := func(source string, rules []mirror.ImageRewrite, refs ...string) error {
+		rules = append(rules, mirror.Current().ImageRules()...)
+		for _, ref := range refs {
+			name, err := container.NormalizeImage(mirror.RewriteImage(ref, rules))
+			if err != nil {
+				return err
+			}
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			list = append(list, IndexImage{Name: name, File: imageFileName(name), Source: source})
+		}
+		return nil
+	}
+
+	k8sImages, err := kubernetesImages(k8sVersion, imageRepository)
+	if err != nil {
+		return nil, err
+	}
+	if err = add("kubernetes", nil, k8sImages...); err != nil {
+		return nil, err
+	}
+	for _, name := range bundleManifests {
+		refs, err := manifestImages(name)
+		if err != nil {
+			return nil, err
+		}
+		m, _ := manifests.Get(name)
+		if err = add(m.File, nil, refs...); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range addonNames {
+		addon, err := getAddon(name)
+		if err != nil {
+			return nil, err
+		}
+		if err = add("addon/"+addon.Name, addon.imageRewrites(), addon.Images...); err != nil {
+			return nil, err
+		}
+	}
+	return list, nil
+}
+
+// saveImages 拉取镜像并导出到镜像包目录，生成的目录可直接用于load-image
+func saveImages(k8sVersion, dir string, arches, addonNames []string) error {
+	imageRepository := mirror.Current().ImageRepository
+	list, err := bundleImages(k8sVersion, imageRepository, addonNames)
+	if err != nil {
+		return err
+	}
+
+	var platformList []string
+	for _, arch := range arches {
+		platformList = append(platformList, "linux/"+arch)
+	}
+	platform := strings.Join(platformList, ",")
+
+	if err = pkg.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, image := range list {
+		log.Printf("[%d/%d] %s", i+1, len(list), image.Name)
+		if err = container.FetchImage(container.DefaultNamespace, image.Name, platform, os.Stdout); err != nil {
+			return err
+		}
+		if list[i].Digest, err = container.ImageDigest(container.DefaultNamespace, image.Name); err != nil {
+			return err
+		}
+		if err = container.ExportImages(container.DefaultNamespace, filepath.Join(dir, image.File), platform, image.Name); err != nil {
+			return err
+		}
+	}
+
+	index := ImageIndex{
+		KubernetesVersion: compat.NormalizeVersion(k8sVersion),
+		ImageRepository:   imageRepository,
+		Platforms:         platformList,
+		CreatedAt:         time.Now(),
+		Images:            list,
+	}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = pkg.WriteFile(filepath.Join(dir, imageIndexFile), append(data, '\n'), 0644); err != nil {
+		return err
+	}
+	log.Printf("已导出%d个镜像到%s", len(list), dir)
+	return nil
+}
+
+var (
+	saveImagesDir    string
+	saveImagesArches []string
+	saveImagesAddons []string
+)
+
+// saveImagesCmd 制作镜像包
+var saveImagesCmd = &cobra.Command{
+	Use:   "save-images",
+	Short: "制作离线镜像包",
+	Long:  "拉取指定Kubernetes版本的组件镜像、CNI资源清单与插件引用的镜像，导出到镜像目录供load-image使用",
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := filepath.Abs(saveImagesDir)
+		if err == nil {
+			err = saveImages(withKubernetesVersion, dir, saveImagesArches, saveImagesAddons)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func initSaveImagesCmd() {
+	saveImagesCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", compat.DefaultKubernetesVersion, "指定Kubernetes版本")
+	saveImagesCmd.Flags().StringVarP(&saveImagesDir, "dir", "", container.DefaultImageDir(), "镜像包目录")
+	saveImagesCmd.Flags().StringSliceVarP(&saveImagesArches, "arch", "", []string{runtime.GOARCH}, "CPU架构，可指定多个，如amd64,arm64")
+	saveImagesCmd.Flags().StringSliceVarP(&saveImagesAddons, "addons", "", []string{"metrics-server"}, "需要打包镜像的插件，可指定多个，如metrics-server,ingress-nginx")
+}
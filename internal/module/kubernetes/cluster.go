@@ -2,10 +2,17 @@ package kubernetes
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
+	"strconv"
 
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/module/preflight"
 	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
 )
@@ -14,52 +21,186 @@ import (
 var initKubernetesClusterCmd = &cobra.Command{
 	Use:   "init-cluster",
 	Short: "初始化Kubernetes集群",
-	Long:  "初始化Kubernetes集群",
+	Long:  "根据--config指定的集群配置文件与命令行参数生成kubeadm配置，保存到" + kubeadmConfigFile + "后初始化Kubernetes集群",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := initKubernetesCluster(withKubernetesVersion); err != nil {
+		spec, err := clusterSpec(cmd)
+		if err == nil {
+			err = initKubernetesCluster(spec)
+		}
+		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
 	},
 }
 
-// initKubernetesCluster 初始化k8s集群
-func initKubernetesCluster(k8sVersion string) error {
+var (
+	clusterConfigFile   string
+	clusterFlags        ClusterSpec
+	clusterFeatureGates map[string]string
+	clusterHA           bool
+)
+
+func initClusterFlags() {
+	flags := initKubernetesClusterCmd.Flags()
+	flags.StringVarP(&clusterConfigFile, "config", "", "", "集群配置文件(YAML)，命令行参数优先")
+	flags.StringVarP(&clusterFlags.ServiceSubnet, "service-cidr", "", "", "Service网段，默认10.96.0.0/16")
+	flags.StringVarP(&clusterFlags.PodSubnet, "pod-network-cidr", "", "", "Pod网段，默认10.244.0.0/16")
+	flags.StringVarP(&clusterFlags.DNSDomain, "dns-domain", "", "", "集群域名，默认cluster.local")
+	flags.StringSliceVarP(&clusterFlags.CertSANs, "cert-sans", "", nil, "APIServer证书额外的IP或域名")
+	flags.StringVarP(&clusterFlags.ControlPlaneEndpoint, "control-plane-endpoint", "", "", "控制面访问地址，如lb.example.com:6443")
+	flags.StringVarP(&clusterFlags.CgroupDriver, "cgroup-driver", "", "", "kubelet cgroup驱动: systemd|cgroupfs，默认systemd")
+	flags.StringVarP(&clusterFlags.ProxyMode, "proxy-mode", "", "", "kube-proxy模式: iptables|ipvs|nftables")
+	flags.StringVarP(&clusterFlags.CNI.Plugin, "cni", "", "", "网络插件: calico|flannel|cilium|none，默认calico")
+	flags.StringVarP(&clusterFlags.CNI.Encapsulation, "cni-encapsulation", "", "", "网络插件封装模式: ipip|vxlan|none，默认calico为ipip，flannel与cilium为vxlan")
+	flags.IntVarP(&clusterFlags.CNI.MTU, "cni-mtu", "", 0, "网络插件MTU，默认自动检测")
+	flags.StringVarP(&clusterFlags.CNI.Interface, "cni-interface", "", "", "节点间通信网卡，默认与--interface相同，未指定时自动检测")
+	flags.StringToStringVarP(&clusterFeatureGates, "feature-gates", "", nil, "特性开关，如A=true,B=false")
+	flags.StringToStringVarP(&clusterFlags.APIServerArgs, "apiserver-extra-args", "", nil, "kube-apiserver额外参数")
+	flags.StringToStringVarP(&clusterFlags.ControllerArgs, "controller-manager-extra-args", "", nil, "kube-controller-manager额外参数")
+	flags.StringToStringVarP(&clusterFlags.SchedulerArgs, "scheduler-extra-args", "", nil, "kube-scheduler额外参数")
+	flags.StringToStringVarP(&clusterFlags.KubeletArgs, "kubelet-extra-args", "", nil, "kubelet额外参数")
+	flags.BoolVarP(&clusterHA, "ha", "", false, "控制面高可用，需通过--vip指定虚拟IP")
+	addHAFlags(initKubernetesClusterCmd)
+}
 
-	serverAddr := k8sServerAddr()
-	var err error
+// clusterSpec 读取集群配置文件并以命令行参数覆盖
+func clusterSpec(cmd *cobra.Command) (ClusterSpec, error) {
+	spec, err := loadClusterSpec(clusterConfigFile)
+	if err != nil {
+		return spec, err
+	}
 
-	// 初始化k8s集群
-	fmt.Println("\n初始化Kubernetes集群...")
-	if err = pkg.ExecCmd(exec.Command("/bin/bash", "-c", fmt.Sprintf(`kubeadm init \
-    --image-repository=registry.aliyuncs.com/google_containers \
-    --apiserver-advertise-address=%s \
-    --kubernetes-version=%s \
-    --service-cidr=10.96.0.0/16 \
-    --pod-network-cidr=10.244.0.0/16`, serverAddr, k8sVersion))); err != nil {
+	flags := cmd.Flags()
+	if spec.KubernetesVersion == "" || flags.Changed("with-version") {
+		spec.KubernetesVersion = withKubernetesVersion
+	}
+	if spec.ImageRepository == "" {
+		spec.ImageRepository = mirror.Current().ImageRepository
+	}
+	if spec.CRISocket == "" || flags.Changed("with-docker") {
+		spec.CRISocket = container.CRISocket(containerWithDocker)
+	}
+	if spec.AdvertiseAddress == "" || flags.Changed("advertise-address") || flags.Changed("interface") {
+		if spec.AdvertiseAddress, err = k8sServerAddr(spec.HA.VIP, haFlags.VIP); err != nil {
+			return spec, err
+		}
+	}
+
+	overrides := map[string]func(){
+		"service-cidr":                  func() { spec.ServiceSubnet = clusterFlags.ServiceSubnet },
+		"pod-network-cidr":              func() { spec.PodSubnet = clusterFlags.PodSubnet },
+		"dns-domain":                    func() { spec.DNSDomain = clusterFlags.DNSDomain },
+		"cert-sans":                     func() { spec.CertSANs = clusterFlags.CertSANs },
+		"control-plane-endpoint":        func() { spec.ControlPlaneEndpoint = clusterFlags.ControlPlaneEndpoint },
+		"cgroup-driver":                 func() { spec.CgroupDriver = clusterFlags.CgroupDriver },
+		"proxy-mode":                    func() { spec.ProxyMode = clusterFlags.ProxyMode },
+		"apiserver-extra-args":          func() { spec.APIServerArgs = clusterFlags.APIServerArgs },
+		"controller-manager-extra-args": func() { spec.ControllerArgs = clusterFlags.ControllerArgs },
+		"scheduler-extra-args":          func() { spec.SchedulerArgs = clusterFlags.SchedulerArgs },
+		"kubelet-extra-args":            func() { spec.KubeletArgs = clusterFlags.KubeletArgs },
+		"cni":                           func() { spec.CNI.Plugin = clusterFlags.CNI.Plugin },
+		"cni-encapsulation":             func() { spec.CNI.Encapsulation = clusterFlags.CNI.Encapsulation },
+		"cni-mtu":                       func() { spec.CNI.MTU = clusterFlags.CNI.MTU },
+		"cni-interface":                 func() { spec.CNI.Interface = clusterFlags.CNI.Interface },
+		"ha-mode":                       func() { spec.HA.Mode = haFlags.Mode },
+		"vip":                           func() { spec.HA.VIP = haFlags.VIP },
+		"vip-interface":                 func() { spec.HA.Interface = haFlags.Interface },
+		"ha-peers":                      func() { spec.HA.Peers = haFlags.Peers },
+		"virtual-router-id":             func() { spec.HA.RouterID = haFlags.RouterID },
+	}
+	for name, override := range overrides {
+		if flags.Changed(name) {
+			override()
+		}
+	}
+	if flags.Changed("feature-gates") {
+		spec.FeatureGates = map[string]bool{}
+		for name, value := range clusterFeatureGates {
+			enabled, err := strconv.ParseBool(value)
+			if err != nil {
+				return spec, fmt.Errorf("特性开关%s的值%s无效", name, value)
+			}
+			spec.FeatureGates[name] = enabled
+		}
+	}
+	if spec.CNI.Interface == "" {
+		spec.CNI.Interface = advertiseInterface
+	}
+	spec.CNI = spec.CNI.withDefaults()
+	if clusterHA && spec.HA.Mode == "" {
+		spec.HA.Mode = HAKubeVIP
+	}
+	if spec, err = spec.withHA(); err != nil {
+		return spec, err
+	}
+	return spec, spec.Validate()
+}
+
+// initKubernetesCluster 初始化k8s集群
+func initKubernetesCluster(spec ClusterSpec) error {
+	release, err := compat.Lookup(spec.KubernetesVersion)
+	if err != nil {
 		return err
 	}
+	if !skipPreflight {
+		if err = preflight.Gate(preflight.Options{
+			Stage:             preflight.StageInit,
+			Role:              preflight.RoleControlPlane,
+			WithDocker:        containerWithDocker,
+			KubernetesVersion: spec.KubernetesVersion,
+		}); err != nil {
+			return err
+		}
+	}
+	if spec.CNI.Plugin == CNICalico {
+		if err = checkCalicoVersion(release); err != nil {
+			log.Printf("警告: %s", err)
+		}
+	}
 
-	// 初始化配置
-	homePath := os.Getenv("HOME")
-	currentUser, _ := user.Current()
-	if err = pkg.ExecCmd(exec.Command("mkdir", "-p", homePath+"/.kube")); err != nil {
+	// 生成kubeadm配置
+	config, err := spec.Render()
+	if err != nil {
 		return err
 	}
-	if err = pkg.ExecCmd(exec.Command("cp", "-i", "/etc/kubernetes/admin.conf", homePath+"/.kube/config")); err != nil {
+	if err = pkg.MkdirAll(filepath.Dir(kubeadmConfigFile), 0755); err != nil {
 		return err
 	}
-	if err = pkg.ExecCmd(
-		exec.Command(
-			"chown",
-			fmt.Sprintf("%s:%s", currentUser.Uid, currentUser.Gid), homePath+"/.kube/config",
-		),
-	); err != nil {
+	if err = pkg.WriteFile(kubeadmConfigFile, config, 0600); err != nil {
+		return err
+	}
+
+	// 部署控制面高可用组件，kube-vip静态Pod由kubelet随APIServer一同启动
+	if spec.HA.Enabled() {
+		if err = setupHA(spec.HA, haNode{
+			AdvertiseAddress:  spec.AdvertiseAddress,
+			BindPort:          spec.BindPort,
+			KubernetesVersion: spec.KubernetesVersion,
+			First:             true,
+		}); err != nil {
+			return err
+		}
+		state := spec.HA
+		state.Peers = append([]string{spec.AdvertiseAddress}, state.Peers...)
+		if err = saveHAState(state, spec.ControlPlaneEndpoint); err != nil {
+			return err
+		}
+	}
+
+	// 初始化k8s集群
+	fmt.Println("\n初始化Kubernetes集群...")
+	if err = pkg.ExecCmd(exec.Command("kubeadm", "init", "--config", kubeadmConfigFile)); err != nil {
+		return err
+	}
+
+	// 初始化配置
+	if err = installAdminKubeconfig(); err != nil {
 		return err
 	}
 
 	// 初始化集群网络
-	if err = pkg.ExecCmd(exec.Command("kubectl", "apply", "-f", "./config/calico.yaml")); err != nil {
+	if err = installCNI(spec); err != nil {
 		return err
 	}
 	if err = pkg.ExecCmd(exec.Command("kubectl", "get", "nodes")); err != nil {
@@ -68,3 +209,22 @@ func initKubernetesCluster(k8sVersion string) error {
 
 	return nil
 }
+
+// installAdminKubeconfig 复制admin.conf到当前用户的~/.kube/config
+func installAdminKubeconfig() error {
+	homePath := os.Getenv("HOME")
+	currentUser, _ := user.Current()
+	adminConfig, err := pkg.ReadFile("/etc/kubernetes/admin.conf")
+	if err != nil && !pkg.IsDryRun() {
+		return err
+	}
+	if err = pkg.WriteFile(homePath+"/.kube/config", adminConfig, 0600); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(
+		exec.Command(
+			"chown",
+			fmt.Sprintf("%s:%s", currentUser.Uid, currentUser.Gid), homePath+"/.kube/config",
+		),
+	)
+}
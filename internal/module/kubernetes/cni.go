@@ -0,0 +1,234 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// CNI插件
+const (
+	CNICalico  = "calico"
+	CNIFlannel = "flannel"
+	CNICilium  = "cilium"
+	CNINone    = "none"
+)
+
+// 封装模式
+const (
+	EncapIPIP  = "ipip"
+	EncapVXLAN = "vxlan"
+	EncapNone  = "none"
+)
+
+// cniManifestDir 渲染后的CNI资源清单目录
+const cniManifestDir = "/etc/kubernetes/cni"
+
+// ciliumVersion 使用cilium命令行安装的Cilium版本
+const ciliumVersion = "1.16.1"
+
+// cniEncapsulations 各CNI插件支持的封装模式，第一个为默认值
+var cniEncapsulations = map[string][]string{
+	CNICalico:  {EncapIPIP, EncapVXLAN, EncapNone},
+	CNIFlannel: {EncapVXLAN, EncapIPIP, EncapNone},
+	CNICilium:  {EncapVXLAN, EncapNone},
+	CNINone:    {EncapNone},
+}
+
+// CNISpec 集群网络插件配置
+type CNISpec struct {
+	Plugin        string `yaml:"plugin,omitempty"`        // calico|flannel|cilium|none
+	Encapsulation string `yaml:"encapsulation,omitempty"` // ipip|vxlan|none，为空时使用插件默认值
+	MTU           int    `yaml:"mtu,omitempty"`           // 为0时由插件自动检测
+	Interface     string `yaml:"interface,omitempty"`     // 节点间通信网卡，为空时自动检测
+}
+
+// withDefaults 补全默认封装模式
+func (c CNISpec) withDefaults() CNISpec {
+	if c.Plugin == "" {
+		c.Plugin = CNICalico
+	}
+	if modes, ok := cniEncapsulations[c.Plugin]; ok && c.Encapsulation == "" {
+		c.Encapsulation = modes[0]
+	}
+	return c
+}
+
+// Validate 校验网络插件配置
+func (c CNISpec) Validate() error {
+	modes, ok := cniEncapsulations[c.Plugin]
+	if !ok {
+		return fmt.Errorf("不支持的CNI插件%s，可选calico、flannel、cilium与none", c.Plugin)
+	}
+	supported := false
+	for _, mode := range modes {
+		supported = supported || mode == c.Encapsulation
+	}
+	if !supported {
+		return fmt.Errorf("%s不支持%s封装模式，可选%s", c.Plugin, c.Encapsulation, strings.Join(modes, "、"))
+	}
+	if c.MTU != 0 && (c.MTU < 576 || c.MTU > 9000) {
+		return fmt.Errorf("MTU %d无效，有效范围为576~9000", c.MTU)
+	}
+	if c.MTU != 0 && c.Plugin == CNIFlannel {
+		return fmt.Errorf("flannel根据网卡MTU自动计算，不支持指定MTU")
+	}
+	if c.Interface != "" {
+		if _, err := net.InterfaceByName(c.Interface); err != nil && !pkg.IsDryRun() {
+			return fmt.Errorf("网卡%s不存在", c.Interface)
+		}
+	}
+	return nil
+}
+
+// cniTemplateData CNI资源清单模板参数
+type cniTemplateData struct {
+	PodSubnet           string // IPv4 Pod网段
+	PodSubnetV6         string // IPv6 Pod网段
+	Encapsulation       string
+	MTU                 int
+	Interface           string
+	AutodetectionMethod string // calico节点地址检测方式
+}
+
+// newCNITemplateData 根据集群配置生成模板参数
+func newCNITemplateData(spec ClusterSpec) cniTemplateData {
+	data := cniTemplateData{
+		Encapsulation: spec.CNI.Encapsulation,
+		MTU:           spec.CNI.MTU,
+		Interface:     spec.CNI.Interface,
+		// 默认使用kubelet上报的节点InternalIP，与kubeadm的advertise地址一致
+		AutodetectionMethod: "kubernetes-internal-ip",
+	}
+	if spec.CNI.Interface != "" {
+		data.AutodetectionMethod = "interface=" + spec.CNI.Interface
+	}
+	for _, cidr := range strings.Split(spec.PodSubnet, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if ip, _, err := net.ParseCIDR(cidr); err == nil && ip.To4() == nil {
+			data.PodSubnetV6 = cidr
+		} else {
+			data.PodSubnet = cidr
+		}
+	}
+	return data
+}
+
+// renderTemplate 渲染资源清单模板
+func renderTemplate(name string, data any) ([]byte, error) {
+	content, err := manifests.Read(name)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s模板解析失败: %w", name, err)
+	}
+	var buf bytes.Buffer
+	if err = tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("%s模板渲染失败: %w", name, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// renderManifest 渲染资源清单模板并将镜像替换为镜像源地址
+func renderManifest(name string, data any) ([]byte, error) {
+	manifest, err := renderTemplate(name, data)
+	if err != nil {
+		return nil, err
+	}
+	return rewriteManifestImages(manifest, nil)
+}
+
+// rewriteManifestImages 按当前镜像源替换资源清单中工作负载的镜像，rules优先于镜像源的规则
+func rewriteManifestImages(data []byte, rules []mirror.ImageRewrite) ([]byte, error) {
+	rules = append(rules, mirror.Current().ImageRules()...)
+	data, _, err := manifests.RewriteImages(data, func(ref string) string {
+		return mirror.RewriteImage(ref, rules)
+	})
+	return data, err
+}
+
+// installCNI 安装集群网络插件
+func installCNI(spec ClusterSpec) error {
+	data := newCNITemplateData(spec)
+	switch spec.CNI.Plugin {
+	case CNINone:
+		fmt.Println("未安装CNI插件，节点在安装网络插件前处于NotReady状态")
+		return nil
+	case CNICilium:
+		return installCilium(data)
+	}
+
+	manifest, err := renderManifest(spec.CNI.Plugin, data)
+	if err != nil {
+		return err
+	}
+	target := path.Join(cniManifestDir, spec.CNI.Plugin+".yaml")
+	if err = pkg.MkdirAll(cniManifestDir, 0755); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile(target, manifest, 0644); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(exec.Command("kubectl", "apply", "-f", target))
+}
+
+// installCilium 使用cilium命令行安装Cilium
+func installCilium(data cniTemplateData) error {
+	if _, err := exec.LookPath("cilium"); err != nil && !pkg.IsDryRun() {
+		return fmt.Errorf("未安装cilium命令行工具，请先从 https://github.com/cilium/cilium-cli/releases 安装")
+	}
+
+	values := []string{"ipam.mode=cluster-pool"}
+	if data.PodSubnet != "" {
+		values = append(values, "ipam.operator.clusterPoolIPv4PodCIDRList={"+data.PodSubnet+"}")
+	} else {
+		values = append(values, "ipv4.enabled=false")
+	}
+	if data.PodSubnetV6 != "" {
+		values = append(values, "ipv6.enabled=true", "ipam.operator.clusterPoolIPv6PodCIDRList={"+data.PodSubnetV6+"}")
+	}
+	if data.Encapsulation == EncapNone {
+		values = append(values, "routingMode=native", "autoDirectNodeRoutes=true")
+		if data.PodSubnet != "" {
+			values = append(values, "ipv4NativeRoutingCIDR="+data.PodSubnet)
+		}
+		if data.PodSubnetV6 != "" {
+			values = append(values, "ipv6NativeRoutingCIDR="+data.PodSubnetV6)
+		}
+	} else {
+		values = append(values, "routingMode=tunnel", "tunnelProtocol="+data.Encapsulation)
+	}
+	if data.MTU != 0 {
+		values = append(values, "MTU="+strconv.Itoa(data.MTU))
+	}
+	if data.Interface != "" {
+		values = append(values, "devices="+data.Interface)
+	}
+	// 镜像源替换了Cilium镜像时关闭摘要校验
+	profile := mirror.Current()
+	for _, image := range [][2]string{
+		{"image", "quay.io/cilium/cilium"},
+		{"operator.image", "quay.io/cilium/operator"},
+	} {
+		if rewritten := profile.RewriteImage(image[1]); rewritten != image[1] {
+			values = append(values, image[0]+".repository="+rewritten, image[0]+".useDigest=false")
+		}
+	}
+
+	args := []string{"install", "--version", ciliumVersion}
+	for _, value := range values {
+		args = append(args, "--set", value)
+	}
+	return pkg.ExecCmd(exec.Command("cilium", args...))
+}
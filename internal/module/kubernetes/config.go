@@ -2,77 +2,84 @@ package kubernetes
 
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"strings"
+	"net"
+	"regexp"
 
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
 	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
 )
 
 func k8sSysctlConfig() error {
-	configFile, e := os.OpenFile("/etc/sysctl.d/k8s.conf", os.O_CREATE|os.O_RDWR, 0644)
-	if e != nil {
-		return e
-	}
-	defer func() {
-		_ = configFile.Close()
-	}()
-
-	if _, err := configFile.Write([]byte(`net.bridge.bridge-nf-call-iptables=1
+	return pkg.WriteFile("/etc/sysctl.d/k8s.conf", []byte(`net.bridge.bridge-nf-call-iptables=1
 net.bridge.bridge-nf-call-ip6tables=1
 net.ipv4.ip_forward=1
-vm.swappiness=0`)); err != nil {
-		return err
-	}
-
-	return nil
+net.ipv6.conf.all.forwarding=1
+vm.swappiness=0`), 0644)
 }
 
 func k8sModuleLoadConfig() error {
-	configFile, e := os.OpenFile("/etc/modules-load.d/k8s.conf", os.O_CREATE|os.O_RDWR, 0644)
-	if e != nil {
-		return e
-	}
-	defer func() {
-		_ = configFile.Close()
-	}()
-
-	if _, err := configFile.Write([]byte(`overlay
+	return pkg.WriteFile("/etc/modules-load.d/k8s.conf", []byte(`overlay
 br_netfilter
 ip_tables
-iptable_filter`)); err != nil {
-		return err
-	}
-
-	return nil
+iptable_filter`), 0644)
 }
 
-func k8sRepoCentosConfig() error {
-	configFile, e := os.OpenFile("/etc/yum.repos.d/kubernetes.repo", os.O_CREATE|os.O_RDWR, 0644)
-	if e != nil {
-		return e
-	}
-	defer func() {
-		_ = configFile.Close()
-	}()
+// k8sRepoConfig 配置k8s软件源
+func k8sRepoConfig(pm system.PackageManager, k8sVersion string) error {
+	profile := mirror.Current()
+	var repo system.Repo
+	switch system.System.LinuxDistroFamily {
+	case system.FamilyDebian:
+		uri, suite, gpgKey, err := profile.KubernetesAptRepo(k8sVersion, system.System.CodeName)
+		if err != nil {
+			return err
+		}
+		repo = system.Repo{Name: "kubernetes", BaseURL: uri, Suite: suite, GPGKey: gpgKey}
 
-	arch := system.ArchMap[system.System.Arch]
+	default:
+		baseURL, gpgKey, err := profile.KubernetesYumRepo(k8sVersion, system.ArchMap[system.System.Arch])
+		if err != nil {
+			return err
+		}
+		repo = system.Repo{Name: "kubernetes", BaseURL: baseURL, GPGKey: gpgKey}
+	}
 
-	if _, err := configFile.Write([]byte(fmt.Sprintf(`[kubernetes]
-name=Kubernetes
-baseurl=https://mirrors.aliyun.com/kubernetes/yum/repos/kubernetes-el7-%s/
-enabled=1
-gpgcheck=0
-repo_gpgcheck=0
-gpgkey=https://mirrors.aliyun.com/kubernetes/yum/doc/yum-key.gpg https://mirrors.aliyun.com/kubernetes/yum/doc/rpm-package-key.gpg`, arch))); err != nil {
-		return err
+	if repo.GPGKey != "" {
+		if err := pm.ImportKey(repo.Name, repo.GPGKey); err != nil {
+			return err
+		}
 	}
+	return pm.AddRepo(repo)
+}
+
+// disableFstabSwap 注释/etc/fstab中的swap挂载项
+func disableFstabSwap() error {
+	return pkg.EditFile("/etc/fstab", func(content string) string {
+		return regexp.MustCompile(`(?m)^([^#\n].*\bswap\b.*)$`).ReplaceAllString(content, "#$1")
+	})
+}
+
+var (
+	advertiseAddress   string
+	advertiseInterface string
+)
 
-	return nil
+// addAdvertiseFlags 添加节点地址参数
+func addAdvertiseFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&advertiseAddress, "advertise-address", "", "", "APIServer对外地址，默认为默认路由网卡的地址")
+	cmd.Flags().StringVarP(&advertiseInterface, "interface", "", "", "使用指定网卡的地址作为APIServer对外地址")
 }
 
-func k8sServerAddr() string {
-	cmd := exec.Command("/bin/bash", "-c", `ifconfig eth0 | grep "inet" | cut -d ':' -f 2 | cut -d '' -f 1 | awk '{print $2}'`)
-	out, _ := cmd.Output()
-	return strings.TrimSpace(string(out))
+// k8sServerAddr 节点对外地址，优先使用--advertise-address，其次为--interface指定网卡或默认路由网卡的地址，
+// vips为高可用虚拟IP，自动检测时忽略
+func k8sServerAddr(vips ...string) (string, error) {
+	if advertiseAddress != "" {
+		if net.ParseIP(advertiseAddress) == nil {
+			return "", fmt.Errorf("--advertise-address %s不是有效的IP地址", advertiseAddress)
+		}
+		return advertiseAddress, nil
+	}
+	return system.AdvertiseAddress(advertiseInterface, vips...)
 }
@@ -0,0 +1,77 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// useMemFS 将全局文件系统替换为内存文件系统，测试结束后恢复
+func useMemFS(t *testing.T) *pkg.MemFS {
+	t.Helper()
+	m := pkg.NewMemFS()
+	prev := pkg.HostFS()
+	pkg.SetFS(m)
+	t.Cleanup(func() { pkg.SetFS(prev) })
+	return m
+}
+
+func TestK8sSysctlConfig(t *testing.T) {
+	m := useMemFS(t)
+	if err := k8sSysctlConfig(); err != nil {
+		t.Fatalf("k8sSysctlConfig() error = %v", err)
+	}
+	data, err := m.ReadFile("/etc/sysctl.d/k8s.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"net.bridge.bridge-nf-call-iptables=1",
+		"net.bridge.bridge-nf-call-ip6tables=1",
+		"net.ipv4.ip_forward=1",
+		"vm.swappiness=0",
+	} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("k8s.conf missing %q", want)
+		}
+	}
+	info, _ := m.Stat("/etc/sysctl.d/k8s.conf")
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want 0644", info.Mode().Perm())
+	}
+}
+
+func TestDisableFstabSwap(t *testing.T) {
+	tests := []struct {
+		name  string
+		fstab string
+		want  string
+	}{
+		{
+			name:  "注释swap挂载项",
+			fstab: "/dev/sda1 / ext4 defaults 0 1\n/swapfile none swap sw 0 0\n",
+			want:  "/dev/sda1 / ext4 defaults 0 1\n#/swapfile none swap sw 0 0\n",
+		},
+		{
+			name:  "已注释的不重复处理",
+			fstab: "#/swapfile none swap sw 0 0\n",
+			want:  "#/swapfile none swap sw 0 0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemFS(t)
+			if err := m.WriteFile("/etc/fstab", []byte(tt.fstab), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := disableFstabSwap(); err != nil {
+				t.Fatalf("disableFstabSwap() error = %v", err)
+			}
+			got, _ := m.ReadFile("/etc/fstab")
+			if string(got) != tt.want {
+				t.Errorf("fstab = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// 高可用模式
+const (
+	HAKubeVIP    = "kube-vip"
+	HAKeepalived = "keepalived"
+)
+
+const (
+	// haStateFile 高可用配置，join-node据此生成控制面节点的配置命令
+	haStateFile = "/etc/kubernetes/ha.yaml"
+	// kubeVIPManifest kube-vip静态Pod
+	kubeVIPManifest = "/etc/kubernetes/manifests/kube-vip.yaml"
+	// haproxyPort keepalived模式下haproxy监听端口，APIServer占用了6443
+	haproxyPort = 8443
+	// defaultRouterID keepalived默认virtual_router_id
+	defaultRouterID = 51
+)
+
+// HASpec 控制面高可用配置
+type HASpec struct {
+	Mode      string   `json:"mode,omitempty" yaml:"mode,omitempty"`           // kube-vip|keepalived，为空时不启用
+	VIP       string   `json:"vip,omitempty" yaml:"vip,omitempty"`             // 控制面虚拟IP
+	Interface string   `json:"interface,omitempty" yaml:"interface,omitempty"` // 虚拟IP绑定的网卡，默认为节点地址所在网卡
+	Peers     []string `json:"peers,omitempty" yaml:"peers,omitempty"`         // keepalived模式下haproxy后端的控制面节点地址
+	RouterID  int      `json:"routerID,omitempty" yaml:"routerID,omitempty"`   // keepalived virtual_router_id，同一网段内不能重复
+}
+
+// Enabled 是否启用高可用
+func (h HASpec) Enabled() bool {
+	return h.Mode != ""
+}
+
+// Port 控制面访问端口，kube-vip与APIServer使用同一端口，keepalived模式经haproxy转发
+func (h HASpec) Port(bindPort int) int {
+	if h.Mode == HAKeepalived {
+		return haproxyPort
+	}
+	return bindPort
+}
+
+// Endpoint 控制面访问地址
+func (h HASpec) Endpoint(bindPort int) string {
+	return net.JoinHostPort(h.VIP, strconv.Itoa(h.Port(bindPort)))
+}
+
+// withDefaults 补全默认网卡与virtual_router_id
+func (h HASpec) withDefaults(advertiseAddress string) (HASpec, error) {
+	if !h.Enabled() {
+		return h, nil
+	}
+	if h.Interface == "" {
+		iface, err := system.InterfaceByAddress(net.ParseIP(advertiseAddress))
+		if err != nil && !pkg.IsDryRun() {
+			return h, fmt.Errorf("%w，请通过--vip-interface指定", err)
+		}
+		h.Interface = iface
+	}
+	if h.Mode == HAKeepalived && h.RouterID == 0 {
+		h.RouterID = defaultRouterID
+	}
+	return h, nil
+}
+
+// Validate 校验高可用配置
+func (h HASpec) Validate(advertiseAddress string) error {
+	if !h.Enabled() {
+		return nil
+	}
+	if h.Mode != HAKubeVIP && h.Mode != HAKeepalived {
+		return fmt.Errorf("不支持的高可用模式%s，可选kube-vip与keepalived", h.Mode)
+	}
+	vip := net.ParseIP(h.VIP)
+	if vip == nil {
+		return fmt.Errorf("高可用需要通过--vip指定有效的虚拟IP")
+	}
+	if node := net.ParseIP(advertiseAddress); node != nil {
+		if vip.Equal(node) {
+			return fmt.Errorf("虚拟IP %s不能与节点地址相同", h.VIP)
+		}
+		if (vip.To4() == nil) != (node.To4() == nil) {
+			return fmt.Errorf("虚拟IP %s与节点地址%s地址族不一致", h.VIP, advertiseAddress)
+		}
+	}
+	for _, peer := range h.Peers {
+		if net.ParseIP(peer) == nil {
+			return fmt.Errorf("控制面节点地址%s不是有效的IP地址", peer)
+		}
+	}
+	if h.Mode == HAKeepalived && (h.RouterID < 1 || h.RouterID > 255) {
+		return fmt.Errorf("virtual_router_id %d无效，有效范围为1~255", h.RouterID)
+	}
+	return nil
+}
+
+// haNode 部署高可用组件的控制面节点
+type haNode struct {
+	AdvertiseAddress  string
+	BindPort          int
+	KubernetesVersion string
+	First             bool // 是否为执行init-cluster的第一个控制面节点
+}
+
+// setupHA 在控制面节点上部署高可用组件
+func setupHA(h HASpec, node haNode) error {
+	log.Printf("部署控制面高可用组件%s，虚拟IP %s", h.Mode, h.VIP)
+	if h.Mode == HAKeepalived {
+		return setupKeepalived(h, node)
+	}
+	return setupKubeVIP(h, node)
+}
+
+// kubeVIPTemplateData kube-vip静态Pod模板参数
+type kubeVIPTemplateData struct {
+	VIP        string
+	Interface  string
+	Port       int
+	CIDR       int
+	KubeConfig string
+}
+
+// newKubeVIPTemplateData 生成kube-vip模板参数
+func newKubeVIPTemplateData(h HASpec, node haNode) kubeVIPTemplateData {
+	data := kubeVIPTemplateData{
+		VIP:        h.VIP,
+		Interface:  h.Interface,
+		Port:       node.BindPort,
+		CIDR:       32,
+		KubeConfig: "/etc/kubernetes/admin.conf",
+	}
+	if ip := net.ParseIP(h.VIP); ip != nil && ip.To4() == nil {
+		data.CIDR = 128
+	}
+	// 1.29起kubeadm init期间admin.conf尚未绑定cluster-admin，第一个节点需使用super-admin.conf
+	if node.First && compat.AtLeast(node.KubernetesVersion, "1.29") {
+		data.KubeConfig = "/etc/kubernetes/super-admin.conf"
+	}
+	return data
+}
+
+// setupKubeVIP 写入kube-vip静态Pod，由kubelet启动并通过ARP宣告虚拟IP
+func setupKubeVIP(h HASpec, node haNode) error {
+	manifest, err := renderManifest(manifests.KubeVIP, newKubeVIPTemplateData(h, node))
+	if err != nil {
+		return err
+	}
+	if err = pkg.MkdirAll(filepath.Dir(kubeVIPManifest), 0755); err != nil {
+		return err
+	}
+	return pkg.WriteFile(kubeVIPManifest, manifest, 0600)
+}
+
+// setupKeepalived 安装keepalived与haproxy，haproxy将虚拟IP上的请求转发到各控制面节点
+func setupKeepalived(h HASpec, node haNode) error {
+	pm, err := system.GetPackageManager()
+	if err != nil {
+		return err
+	}
+	if err = pm.Install(system.Packages("keepalived", "haproxy")...); err != nil {
+		return err
+	}
+
+	backends := []string{node.AdvertiseAddress}
+	for _, peer := range h.Peers {
+		if !net.ParseIP(peer).Equal(net.ParseIP(node.AdvertiseAddress)) {
+			backends = append(backends, peer)
+		}
+	}
+	if err = pkg.BackupFile("/etc/haproxy/haproxy.cfg"); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile("/etc/haproxy/haproxy.cfg", haproxyConfig(h.VIP, backends, node.BindPort), 0644); err != nil {
+		return err
+	}
+
+	priority := 100
+	if node.First {
+		priority = 101
+	}
+	if err = pkg.MkdirAll("/etc/keepalived", 0755); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile("/etc/keepalived/check_apiserver.sh", []byte(fmt.Sprintf(`#!/bin/sh
+# haproxy无法访问APIServer时降低优先级，虚拟IP漂移到其他节点
+curl -sfk --max-time 2 https://localhost:%d/healthz -o /dev/null || exit 1
+`, haproxyPort)), 0755); err != nil {
+		return err
+	}
+	if err = pkg.BackupFile("/etc/keepalived/keepalived.conf"); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile("/etc/keepalived/keepalived.conf", keepalivedConfig(h, priority), 0644); err != nil {
+		return err
+	}
+
+	for _, service := range []string{"haproxy.service", "keepalived.service"} {
+		if err = pkg.ExecCmd(exec.Command("systemctl", "enable", service)); err != nil {
+			return err
+		}
+		if err = pkg.ExecCmd(exec.Command("systemctl", "restart", service)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// haproxyConfig haproxy配置，以TCP模式转发到各控制面节点的APIServer
+func haproxyConfig(vip string, backends []string, bindPort int) []byte {
+	bind := fmt.Sprintf("*:%d", haproxyPort)
+	if ip := net.ParseIP(vip); ip != nil && ip.To4() == nil {
+		bind = fmt.Sprintf(":::%d v4v6", haproxyPort)
+	}
+	var servers strings.Builder
+	for i, backend := range backends {
+		servers.WriteString(fmt.Sprintf("    server master%d %s check inter 3s fall 3 rise 2\n", i+1, net.JoinHostPort(backend, strconv.Itoa(bindPort))))
+	}
+	return []byte(fmt.Sprintf(`global
+    log /dev/log local0
+    daemon
+
+defaults
+    mode tcp
+    log global
+    option tcplog
+    timeout connect 5s
+    timeout client 35s
+    timeout server 35s
+
+frontend kube-apiserver
+    bind %s
+    default_backend kube-apiserver
+
+backend kube-apiserver
+    balance roundrobin
+%s`, bind, servers.String()))
+}
+
+// keepalivedConfig keepalived配置，各节点均为BACKUP状态，由优先级选举持有虚拟IP的节点
+func keepalivedConfig(h HASpec, priority int) []byte {
+	return []byte(fmt.Sprintf(`global_defs {
+    enable_script_security
+    script_user root
+}
+
+vrrp_script check_apiserver {
+    script "/etc/keepalived/check_apiserver.sh"
+    interval 3
+    weight -2
+    fall 10
+    rise 2
+}
+
+vrrp_instance kube_apiserver {
+    state BACKUP
+    interface %s
+    virtual_router_id %d
+    priority %d
+    advert_int 1
+    virtual_ipaddress {
+        %s
+    }
+    track_script {
+        check_apiserver
+    }
+}
+`, h.Interface, h.RouterID, priority, h.VIP))
+}
+
+// haState 保存在控制面节点上的高可用配置
+type haState struct {
+	HASpec   `yaml:",inline"`
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+}
+
+// saveHAState 保存高可用配置
+func saveHAState(h HASpec, endpoint string) error {
+	data, err := yaml.Marshal(haState{HASpec: h, Endpoint: endpoint})
+	if err != nil {
+		return err
+	}
+	return pkg.WriteFile(haStateFile, data, 0600)
+}
+
+// loadHAState 读取高可用配置，未启用高可用时返回nil
+func loadHAState() (*haState, error) {
+	data, err := pkg.ReadFile(haStateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var state haState
+	if err = yaml.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%s解析失败: %w", haStateFile, err)
+	}
+	return &state, nil
+}
+
+// setupHACommand 新控制面节点部署高可用组件的命令
+func setupHACommand(state haState) string {
+	args := []string{"devops", "k8s", "setup-ha", "--ha-mode", state.Mode, "--vip", state.VIP}
+	if state.Mode == HAKeepalived {
+		args = append(args, "--ha-peers", strings.Join(state.Peers, ","), "--virtual-router-id", strconv.Itoa(state.RouterID))
+	}
+	return strings.Join(args, " ")
+}
+
+var (
+	haFlags    HASpec
+	haBindPort int
+)
+
+// addHAFlags 添加高可用参数
+func addHAFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&haFlags.Mode, "ha-mode", "", "", "控制面高可用模式: kube-vip|keepalived，默认kube-vip")
+	flags.StringVarP(&haFlags.VIP, "vip", "", "", "控制面虚拟IP")
+	flags.StringVarP(&haFlags.Interface, "vip-interface", "", "", "虚拟IP绑定的网卡，默认为节点地址所在网卡")
+	flags.StringSliceVarP(&haFlags.Peers, "ha-peers", "", nil, "keepalived模式下其他控制面节点地址，作为haproxy后端")
+	flags.IntVarP(&haFlags.RouterID, "virtual-router-id", "", 0, "keepalived virtual_router_id，默认51")
+}
+
+// setupHACmd 在新控制面节点上部署高可用组件
+var setupHACmd = &cobra.Command{
+	Use:   "setup-ha",
+	Short: "部署控制面高可用组件",
+	Long: "在加入集群的控制面节点上部署kube-vip或keepalived+haproxy，参数与init-cluster --ha一致，" +
+		"kube-vip模式需在kubeadm join完成后执行，join-node --control-plane会输出完整命令",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := setupHANode(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// setupHANode 使用命令行参数在当前节点部署高可用组件
+func setupHANode() error {
+	h := haFlags
+	if h.Mode == "" {
+		h.Mode = HAKubeVIP
+	}
+	addr, err := k8sServerAddr(h.VIP)
+	if err != nil {
+		return err
+	}
+	if h, err = h.withDefaults(addr); err != nil {
+		return err
+	}
+	if err = h.Validate(addr); err != nil {
+		return err
+	}
+	if err = setupHA(h, haNode{AdvertiseAddress: addr, BindPort: haBindPort}); err != nil {
+		return err
+	}
+	return saveHAState(h, h.Endpoint(haBindPort))
+}
+
+func initSetupHACmd() {
+	addHAFlags(setupHACmd)
+	addAdvertiseFlags(setupHACmd)
+	setupHACmd.Flags().IntVarP(&haBindPort, "apiserver-port", "", 6443, "APIServer端口")
+}
@@ -1,71 +1,190 @@
 package kubernetes
 
 import (
-	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
-	"github.com/containerd/containerd"
 	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
 )
 
+// defaultLoadWorkers 默认并发导入数
+const defaultLoadWorkers = 4
+
 // containerWithDocker 使用Docker，否则使用containerd
 var containerWithDocker bool
 
+var (
+	loadImageDir         string
+	loadImageWorkers     int
+	loadImageSnapshotter string
+)
+
 var loadImageCmd = &cobra.Command{
 	Use:   "load-image",
 	Short: "加载容器镜像",
-	Long:  "加载容器镜像",
+	Long:  "加载镜像目录中的tar、tar.gz、tar.zst镜像包与OCI layout目录，镜像目录中存在save-images生成的index.json时跳过已存在的镜像并校验摘要",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := loadImage(containerWithDocker); err != nil {
+		if err := loadImage(containerWithDocker, loadImageDir, loadImageWorkers); err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
 		}
 	},
 }
 
-// loadImages 加载容器镜像
-func loadImage(withDocker bool) error {
-	log.Println("正在加载容器镜像...")
-	var err error
-	if withDocker {
+func initLoadImageCmd() {
+	loadImageCmd.Flags().BoolVarP(&containerWithDocker, "with-docker", "", false, "使用Docker，默认为containerd")
+	loadImageCmd.Flags().StringVarP(&loadImageDir, "dir", "", container.DefaultImageDir(), "镜像包目录")
+	loadImageCmd.Flags().IntVarP(&loadImageWorkers, "parallel", "", defaultLoadWorkers, "并发导入数")
+	loadImageCmd.Flags().StringVarP(&loadImageSnapshotter, "snapshotter", "", "", "解压镜像使用的快照器，默认读取containerd配置")
+}
 
-	} else {
+// loadImage 并发加载镜像目录中的镜像包并输出汇总
+func loadImage(withDocker bool, dir string, workers int) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	tasks, err := imageTasks(dir)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == 0 {
+		log.Printf("%s中没有镜像包", dir)
+		return nil
+	}
+	log.Printf("正在加载容器镜像，共%d个镜像包...", len(tasks))
 
-		client, clientErr := containerd.New(container.ContainerdSockPath, containerd.WithDefaultNamespace("k8s.io"))
-		if clientErr != nil {
-			return clientErr
+	var load func(task container.ImportTask) container.ImportResult
+	if withDocker {
+		load = dockerLoad
+	} else {
+		importer, err := container.NewImporter(container.DefaultNamespace, loadImageSnapshotter, "")
+		if err != nil {
+			return err
 		}
+		defer func() {
+			_ = importer.Close()
+		}()
+		load = importer.Import
+	}
 
-		err = filepath.Walk("./image", func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]container.ImportResult, len(tasks))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = load(tasks[i])
+				log.Printf("%s %s", filepath.Base(results[i].Path), results[i].Status)
 			}
+		}()
+	}
+	for i := range tasks {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-			if filepath.Ext(path) == ".tar" {
-				imageFile, fErr := os.OpenFile(path, os.O_RDONLY, 0)
-				if fErr != nil {
-					return fErr
-				}
-				list, loadError := client.Import(context.Background(), imageFile)
-				if loadError != nil {
-					return loadError
-				}
-				for _, image := range list {
-					log.Printf("loaded image %s", image.Name)
-				}
+	return printLoadSummary(results)
+}
+
+// imageTasks 查找镜像目录中的镜像包，并根据index.json填充期望的镜像与摘要
+func imageTasks(dir string) ([]container.ImportTask, error) {
+	expected := map[string]map[string]string{}
+	if data, err := os.ReadFile(filepath.Join(dir, imageIndexFile)); err == nil {
+		var index ImageIndex
+		if err = json.Unmarshal(data, &index); err != nil {
+			return nil, fmt.Errorf("%s解析失败: %w", imageIndexFile, err)
+		}
+		for _, image := range index.Images {
+			if expected[image.File] == nil {
+				expected[image.File] = map[string]string{}
 			}
+			expected[image.File][image.Name] = image.Digest
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
 
+	var tasks []container.ImportTask
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir || !container.IsImageArchive(path, info) {
 			return nil
-		})
-	}
+		}
+		name, _ := filepath.Rel(dir, path)
+		tasks = append(tasks, container.ImportTask{Path: path, Expected: expected[filepath.ToSlash(name)]})
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	return tasks, err
+}
 
-	if err != nil {
-		return err
+// dockerLoad 使用docker load导入镜像包
+func dockerLoad(task container.ImportTask) container.ImportResult {
+	start := time.Now()
+	result := container.ImportResult{Path: task.Path, Status: container.ImportStatusImported}
+	if info, err := os.Stat(task.Path); err == nil && info.IsDir() {
+		result.Err = errors.New("docker load不支持OCI layout目录")
+	} else {
+		result.Err = pkg.ExecCmd(exec.Command("docker", "load", "-i", task.Path))
+	}
+	if result.Err != nil {
+		result.Status = container.ImportStatusFailed
 	}
+	for name := range task.Expected {
+		result.Images = append(result.Images, name)
+	}
+	result.Duration = time.Since(start)
+	return result
+}
 
+// printLoadSummary 输出导入汇总，存在失败时返回错误
+func printLoadSummary(results []container.ImportResult) error {
+	counts := map[string]int{}
+	var failed []string
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "FILE\tSTATUS\tIMAGES\tDURATION")
+	for _, result := range results {
+		counts[result.Status]++
+		sort.Strings(result.Images)
+		images := strings.Join(result.Images, ",")
+		if images == "" {
+			images = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", filepath.Base(result.Path), result.Status, images, result.Duration.Round(time.Millisecond))
+		if result.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %s", filepath.Base(result.Path), result.Err))
+		}
+	}
+	_ = w.Flush()
+	log.Printf(
+		"导入%d个，跳过%d个，失败%d个",
+		counts[container.ImportStatusImported], counts[container.ImportStatusSkipped], counts[container.ImportStatusFailed],
+	)
+	if len(failed) > 0 {
+		return fmt.Errorf("镜像加载失败:\n%s", strings.Join(failed, "\n"))
+	}
 	return nil
 }
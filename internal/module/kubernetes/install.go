@@ -2,10 +2,15 @@ package kubernetes
 
 import (
 	"fmt"
+	"log"
 	"os"
 	"os/exec"
 	"strings"
 
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/module/preflight"
 	"github.com/dysodeng/devops-tools/internal/module/system"
 	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
@@ -14,11 +19,14 @@ import (
 // withKubernetesVersion k8s版本
 var withKubernetesVersion string
 
+// skipPreflight 跳过主机预检
+var skipPreflight bool
+
 // installKubernetesCmd 安装k8s组件命令
 var installKubernetesCmd = &cobra.Command{
 	Use:   "install",
 	Short: "安装Kubernetes组件",
-	Long:  "安装Kubernetes组件",
+	Long:  "安装Kubernetes组件，使用仅提供旧版Kubernetes软件源的镜像源(如huawei)时只能安装1.28及以下版本",
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := installKubernetes(); err != nil {
 			fmt.Println(err.Error())
@@ -27,287 +35,101 @@ var installKubernetesCmd = &cobra.Command{
 	},
 }
 
+// kubernetesPackages k8s组件软件包
+var kubernetesPackages = []string{"kubelet", "kubeadm", "kubectl"}
+
 // installKubernetes 安装k8s组件
 func installKubernetes() error {
-	switch system.System.LinuxDistro {
-	case "CentOS":
-		// 禁用swap分区
-		_ = pkg.ExecCmd(exec.Command("swapoff", "-a"))
-		_ = pkg.ExecCmd(exec.Command("sed", "-i", "s/.*swap.*/#&/", "/etc/fstab"))
-
-		// k8s sysctl 配置
-		if err := k8sSysctlConfig(); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("sysctl", "--system")); err != nil {
-			return err
-		}
-
-		// 配置ipvsadm
-		if err := pkg.ExecCmd(exec.Command("yum", "install", "-y", "ipset", "ipvsadm")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "overlay")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "br_netfilter")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "ip_tables")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "iptable_filter")); err != nil {
-			return err
-		}
-		if err := k8sModuleLoadConfig(); err != nil {
-			return err
-		}
-
-		// 安装k8s组件
-		if err := k8sRepoCentosConfig(); err != nil {
+	if _, err := compat.Lookup(withKubernetesVersion); err != nil {
+		return err
+	}
+	if err := mirror.Current().CheckKubernetesRepo(withKubernetesVersion); err != nil {
+		return err
+	}
+	if !skipPreflight {
+		if err := preflight.Gate(preflight.Options{
+			Stage:             preflight.StageInstall,
+			Role:              preflight.RoleWorker,
+			WithDocker:        containerWithDocker,
+			KubernetesVersion: withKubernetesVersion,
+		}); err != nil {
 			return err
 		}
+	}
 
-		k8sVersion := strings.Replace(withKubernetesVersion, "v", "", -1)
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"yum",
-				"install",
-				"-y",
-				"kubelet-"+k8sVersion+"-0",
-				"kubeadm-"+k8sVersion+"-0",
-				"kubectl-"+k8sVersion+"-0",
-				"kubernetes-cni",
-				"--disableexcludes=kubernetes",
-				"--nogpgcheck",
-			),
-		); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "enable", "kubelet", "--now")); err != nil {
-			return err
-		}
-		_ = pkg.ExecCmd(exec.Command("systemctl", "status", "kubelet"))
-		break
+	pm, err := system.GetPackageManager()
+	if err != nil {
+		return err
+	}
 
-	case "Ubuntu":
-		// 禁用swap分区
-		_ = pkg.ExecCmd(exec.Command("swapoff", "-a"))
-		_ = pkg.ExecCmd(exec.Command("sed", "-i", "s/.*swap.*/#&/", "/etc/fstab"))
+	// 禁用swap分区
+	_ = pkg.ExecCmd(exec.Command("swapoff", "-a"))
+	_ = disableFstabSwap()
 
-		if err := pkg.ExecCmd(exec.Command("apt", "update")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "install", "-y", "apt-transport-https")); err != nil {
+	if err = pm.Refresh(); err != nil {
+		return err
+	}
+	if system.System.LinuxDistroFamily == system.FamilyDebian {
+		if err = pm.Install(system.Packages("apt-transport-https", "ca-certificates", "curl", "gnupg")...); err != nil {
 			return err
 		}
+	}
 
-		// k8s sysctl 配置
-		if err := k8sSysctlConfig(); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("sysctl", "--system")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "install", "-y", "ipset", "ipvsadm")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "overlay")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "br_netfilter")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "ip_tables")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "iptable_filter")); err != nil {
-			return err
-		}
+	// k8s sysctl 配置
+	if err = k8sSysctlConfig(); err != nil {
+		return err
+	}
+	if err = pkg.ExecCmd(exec.Command("sysctl", "--system")); err != nil {
+		return err
+	}
 
-		// 安装k8s组件
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"/bin/bash",
-				"-c",
-				`curl -fsSL https://mirrors.aliyun.com/kubernetes/apt/doc/apt-key.gpg | apt-key add -`,
-			),
-		); err != nil {
-			return err
-		}
-		if pkg.CheckNetworkFileExists(
-			"https://mirrors.aliyun.com/kubernetes/apt/kubernetes-" + system.System.CodeName + "/Release",
-		) {
-			if err := pkg.ExecCmd(
-				exec.Command(
-					"/bin/bash",
-					"-c",
-					fmt.Sprintf(
-						`add-apt-repository "deb [arch=%s] https://mirrors.aliyun.com/kubernetes/apt/ kubernetes-%s main")`,
-						system.System.Arch,
-						system.System.CodeName,
-					),
-				),
-			); err != nil {
-				return err
-			}
-		} else {
-			if err := pkg.ExecCmd(
-				exec.Command(
-					"/bin/bash",
-					"-c",
-					fmt.Sprintf(
-						`add-apt-repository "deb [arch=%s] https://mirrors.aliyun.com/kubernetes/apt/ kubernetes-xenial main"`,
-						system.System.Arch,
-					),
-				),
-			); err != nil {
-				return err
-			}
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "update")); err != nil {
-			return err
-		}
-		k8sVersion := strings.Replace(withKubernetesVersion, "v", "", -1)
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"apt",
-				"install",
-				"-y",
-				"kubelet="+k8sVersion+"-00",
-				"kubeadm="+k8sVersion+"-00",
-				"kubectl="+k8sVersion+"-00",
-				"kubernetes-cni",
-			),
-		); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "enable", "kubelet", "--now")); err != nil {
+	// 配置ipvsadm
+	if err = pm.Install(system.Packages("ipset", "ipvsadm")...); err != nil {
+		return err
+	}
+	for _, module := range []string{"overlay", "br_netfilter", "ip_tables", "iptable_filter"} {
+		if err = pkg.ExecCmd(exec.Command("modprobe", module)); err != nil {
 			return err
 		}
-		_ = pkg.ExecCmd(exec.Command("systemctl", "status", "kubelet"))
-		break
+	}
+	if err = k8sModuleLoadConfig(); err != nil {
+		return err
+	}
 
-	case "Debian":
-		// 禁用swap分区
-		_ = pkg.ExecCmd(exec.Command("swapoff", "-a"))
-		_ = pkg.ExecCmd(exec.Command("sed", "-i", "s/.*swap.*/#&/", "/etc/fstab"))
+	// 安装k8s组件
+	k8sVersion := strings.TrimPrefix(withKubernetesVersion, "v")
+	if err = k8sRepoConfig(pm, k8sVersion); err != nil {
+		return err
+	}
+	if err = pm.Refresh(); err != nil {
+		return err
+	}
 
-		if err := pkg.ExecCmd(exec.Command("apt", "update")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "install", "-y", "apt-transport-https", "gnupg2", "gnupg1", "gnupg")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"apt",
-				"install",
-				"-y",
-				"software-properties-common",
-				"dirmngr",
-				"ca-certificates",
-			),
-		); err != nil {
-			return err
-		}
+	packages := make([]system.Package, 0, len(kubernetesPackages)+1)
+	for _, name := range kubernetesPackages {
+		packages = append(packages, system.Package{Name: name, Version: system.ResolveVersion(pm, name, k8sVersion)})
+	}
+	packages = append(packages, system.Package{Name: "kubernetes-cni"})
+	if err = pm.Install(packages...); err != nil {
+		return err
+	}
+	if err = pm.Hold(kubernetesPackages...); err != nil {
+		return err
+	}
 
-		// k8s sysctl 配置
-		if err := k8sSysctlConfig(); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("sysctl", "--system")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "install", "-y", "ipset", "ipvsadm")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "overlay")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "br_netfilter")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "ip_tables")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("modprobe", "iptable_filter")); err != nil {
-			return err
-		}
+	if err = pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
+		return err
+	}
+	if err = pkg.ExecCmd(exec.Command("systemctl", "enable", "kubelet", "--now")); err != nil {
+		return err
+	}
+	_ = pkg.ExecCmd(exec.Command("systemctl", "status", "kubelet"))
 
-		// 安装k8s组件
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"/bin/bash",
-				"-c",
-				`curl -fsSL https://mirrors.aliyun.com/kubernetes/apt/doc/apt-key.gpg | apt-key add -`,
-			),
-		); err != nil {
-			return err
-		}
-		if pkg.CheckNetworkFileExists(
-			"https://mirrors.aliyun.com/kubernetes/apt/kubernetes-" + system.System.CodeName + "/Release",
-		) {
-			if err := pkg.ExecCmd(
-				exec.Command(
-					"/bin/bash",
-					"-c",
-					fmt.Sprintf(
-						`add-apt-repository "deb [arch=%s] https://mirrors.aliyun.com/kubernetes/apt/ kubernetes-%s main")`,
-						system.System.Arch,
-						system.System.CodeName,
-					),
-				),
-			); err != nil {
-				return err
-			}
-		} else {
-			if err := pkg.ExecCmd(
-				exec.Command(
-					"/bin/bash",
-					"-c",
-					fmt.Sprintf(
-						`add-apt-repository "deb [arch=%s] https://mirrors.aliyun.com/kubernetes/apt/ kubernetes-xenial main"`,
-						system.System.Arch,
-					),
-				),
-			); err != nil {
-				return err
-			}
-		}
-		if err := pkg.ExecCmd(exec.Command("apt", "update")); err != nil {
-			return err
-		}
-		k8sVersion := strings.Replace(withKubernetesVersion, "v", "", -1)
-		if err := pkg.ExecCmd(
-			exec.Command(
-				"apt",
-				"install",
-				"-y",
-				"kubelet="+k8sVersion+"-00",
-				"kubeadm="+k8sVersion+"-00",
-				"kubectl="+k8sVersion+"-00",
-				"kubernetes-cni",
-			),
-		); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "daemon-reload")); err != nil {
-			return err
-		}
-		if err := pkg.ExecCmd(exec.Command("systemctl", "enable", "kubelet", "--now")); err != nil {
-			return err
-		}
-		_ = pkg.ExecCmd(exec.Command("systemctl", "status", "kubelet"))
-		break
+	// sandbox镜像与Kubernetes版本保持一致
+	if err = container.SyncSandboxImage(containerWithDocker, withKubernetesVersion); err != nil {
+		log.Printf("警告: 更新sandbox镜像失败: %s", err)
 	}
 
 	// 加载容器镜像
-	return loadImage(containerWithDocker)
+	return loadImage(containerWithDocker, container.DefaultImageDir(), defaultLoadWorkers)
 }
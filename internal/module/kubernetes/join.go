@@ -1,25 +1,165 @@
 package kubernetes
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
-	"log"
+	"io"
+	"net"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/preflight"
+	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
-// joinMasterNode 加入master节点
-var joinMasterNode bool
+// caCertFile 集群CA证书
+const caCertFile = "/etc/kubernetes/pki/ca.crt"
+
+// certificateKeyTTL kubeadm上传的控制面证书有效期
+const certificateKeyTTL = 2 * time.Hour
+
+// JoinBundle 新节点加入集群所需的信息，由join-node在控制面节点生成，join --from在新节点使用
+type JoinBundle struct {
+	Endpoint          string            `json:"endpoint" yaml:"endpoint"`
+	Token             string            `json:"token" yaml:"token"`
+	CACertHashes      []string          `json:"caCertHashes" yaml:"caCertHashes"`
+	ControlPlane      bool              `json:"controlPlane,omitempty" yaml:"controlPlane,omitempty"`
+	CertificateKey    string            `json:"certificateKey,omitempty" yaml:"certificateKey,omitempty"` // 仅控制面节点，有效期2小时
+	KubernetesVersion string            `json:"kubernetesVersion,omitempty" yaml:"kubernetesVersion,omitempty"`
+	Labels            map[string]string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Taints            []Taint           `json:"taints,omitempty" yaml:"taints,omitempty"`
+	HA                *haState          `json:"ha,omitempty" yaml:"ha,omitempty"` // 仅控制面节点，集群启用高可用时存在
+	ExpiresAt         *time.Time        `json:"expiresAt,omitempty" yaml:"expiresAt,omitempty"`
+}
+
+// Taint 节点污点
+type Taint struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  string `json:"value,omitempty" yaml:"value,omitempty"`
+	Effect string `json:"effect" yaml:"effect"`
+}
+
+func (t Taint) String() string {
+	if t.Value == "" {
+		return t.Key + ":" + t.Effect
+	}
+	return t.Key + "=" + t.Value + ":" + t.Effect
+}
+
+// ParseTaint 解析key=value:Effect或key:Effect格式的污点
+func ParseTaint(value string) (Taint, error) {
+	var t Taint
+	keyValue, effect, ok := strings.Cut(strings.TrimSpace(value), ":")
+	t.Key, t.Value, _ = strings.Cut(keyValue, "=")
+	t.Effect = effect
+	if !ok || t.Key == "" {
+		return t, fmt.Errorf("污点%s无效，格式为key=value:Effect或key:Effect", value)
+	}
+	switch t.Effect {
+	case "NoSchedule", "PreferNoSchedule", "NoExecute":
+	default:
+		return t, fmt.Errorf("污点%s的效果%s无效，可选值: NoSchedule|PreferNoSchedule|NoExecute", value, t.Effect)
+	}
+	return t, nil
+}
+
+var tokenPattern = regexp.MustCompile(`^[a-z0-9]{6}\.[a-z0-9]{16}$`)
+
+// validateNodeLabels 校验节点标签，kubelet只能设置kubernetes.io与k8s.io下的部分标签，如node-role.kubernetes.io需加入后由管理员设置
+func validateNodeLabels(labels map[string]string) error {
+	for key := range labels {
+		prefix, name, ok := strings.Cut(key, "/")
+		if !ok {
+			prefix, name = "", key
+		}
+		if name == "" {
+			return fmt.Errorf("节点标签%s无效", key)
+		}
+		restricted := prefix == "kubernetes.io" || prefix == "k8s.io" ||
+			strings.HasSuffix(prefix, ".kubernetes.io") || strings.HasSuffix(prefix, ".k8s.io")
+		allowed := prefix == "node.kubernetes.io" || prefix == "kubelet.kubernetes.io" || prefix == "topology.kubernetes.io" ||
+			strings.HasSuffix(prefix, ".node.kubernetes.io") || strings.HasSuffix(prefix, ".kubelet.kubernetes.io")
+		if restricted && !allowed {
+			return fmt.Errorf("kubelet不能设置节点标签%s，请在节点加入后使用kubectl label设置", key)
+		}
+	}
+	return nil
+}
+
+// Validate 校验加入信息
+func (b JoinBundle) Validate() error {
+	if _, _, err := net.SplitHostPort(b.Endpoint); err != nil {
+		return fmt.Errorf("集群地址%s无效: %w", b.Endpoint, err)
+	}
+	if !tokenPattern.MatchString(b.Token) {
+		return fmt.Errorf("令牌%s格式无效", b.Token)
+	}
+	if len(b.CACertHashes) == 0 {
+		return errors.New("缺少CA证书哈希")
+	}
+	for _, hash := range b.CACertHashes {
+		if !strings.HasPrefix(hash, "sha256:") {
+			return fmt.Errorf("CA证书哈希%s无效，格式为sha256:<hex>", hash)
+		}
+	}
+	if b.ControlPlane && b.CertificateKey == "" {
+		return errors.New("控制面节点缺少证书密钥")
+	}
+	if b.ExpiresAt != nil && time.Now().After(*b.ExpiresAt) {
+		return fmt.Errorf("加入信息已于%s过期，请在控制面节点重新执行join-node", b.ExpiresAt.Local().Format(time.DateTime))
+	}
+	if err := validateNodeLabels(b.Labels); err != nil {
+		return err
+	}
+	for _, t := range b.Taints {
+		if _, err := ParseTaint(t.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command 等效的kubeadm join命令，不包含节点标签与污点
+func (b JoinBundle) Command() string {
+	command := fmt.Sprintf(`kubeadm join %s --token %s \
+        --discovery-token-ca-cert-hash %s`, b.Endpoint, b.Token, strings.Join(b.CACertHashes, ","))
+	if b.ControlPlane {
+		command += " --control-plane --certificate-key " + b.CertificateKey
+	}
+	return command
+}
+
+var (
+	// joinMasterNode 加入master节点
+	joinMasterNode bool
+	joinLabels     map[string]string
+	joinTaints     []string
+	joinTokenTTL   time.Duration
+	joinOutput     string
+	joinBundleFile string
+)
 
 // joinKubernetesNodeCmd Kubernetes加入节点命令
 var joinKubernetesNodeCmd = &cobra.Command{
 	Use:   "join-node",
 	Short: "Kubernetes加入节点",
-	Long:  "Kubernetes加入节点",
+	Long: "在控制面节点生成新节点的加入信息，默认输出kubeadm join命令；" +
+		"-o json或--bundle生成包含集群地址、令牌、CA证书哈希、节点标签与污点的加入信息，在新节点执行devops k8s join --from完成加入",
 	Run: func(cmd *cobra.Command, args []string) {
 		if err := joinKubernetesNode(joinMasterNode); err != nil {
 			fmt.Println(err.Error())
@@ -28,82 +168,439 @@ var joinKubernetesNodeCmd = &cobra.Command{
 	},
 }
 
-// joinKubernetesNode 加入k8s节点
+// joinKubernetesNode 生成加入信息
 func joinKubernetesNode(withMaster bool) error {
-	var err error
-	if withMaster {
-		err = joinKubernetesControlPlaneNode()
-	} else {
-		err = joinKubernetesWorkerNode()
+	switch joinOutput {
+	case "text", pkg.OutputJSON, pkg.OutputYAML:
+	default:
+		return fmt.Errorf("不支持的输出格式: %s", joinOutput)
 	}
-	return err
-}
-
-// joinKubernetesControlPlaneNode 添加控制面节点
-func joinKubernetesControlPlaneNode() error {
-	// 生成新证书
-	certCmd := exec.Command("kubeadm", "init", "phase", "upload-certs", "--upload-certs")
-	certOut, err := certCmd.Output()
+	bundle, err := newJoinBundle(withMaster, joinTokenTTL)
 	if err != nil {
 		return err
 	}
-	certOutLineList := strings.Split(strings.TrimSpace(string(certOut)), "\n")
-	var certKey string
-	for _, certOutLine := range certOutLineList {
-		if ok, err := regexp.MatchString("^[a-zA-Z0-9]+$", certOutLine); err != nil {
+	if err = bundle.Validate(); err != nil && !pkg.IsDryRun() {
+		return err
+	}
+
+	if joinBundleFile != "" {
+		data, err := json.MarshalIndent(bundle, "", "  ")
+		if err != nil {
+			return err
+		}
+		file, err := filepath.Abs(joinBundleFile)
+		if err != nil {
 			return err
+		}
+		// 通过pkg写入，dry-run时仅记录不落盘
+		if err = pkg.WriteFile(file, append(data, '\n'), 0600); err != nil {
+			return err
+		}
+		fmt.Printf("加入信息已保存到%s，包含集群令牌，请妥善保管\n复制到新节点后执行: devops k8s join --from %s\n", joinBundleFile, joinBundleFile)
+	} else if joinOutput == "text" {
+		fmt.Println(bundle.Command())
+	} else if err = pkg.PrintStructured(os.Stdout, joinOutput, bundle); err != nil {
+		return err
+	}
+
+	if bundle.HA == nil {
+		return nil
+	}
+	if joinBundleFile == "" && joinOutput == "text" {
+		if bundle.HA.Mode == HAKubeVIP {
+			fmt.Printf("\n新控制面节点执行kubeadm join完成后，部署kube-vip:\n%s\n", setupHACommand(*bundle.HA))
 		} else {
-			if ok {
-				certKey = certOutLine
-				break
-			}
+			fmt.Printf("\n新控制面节点执行kubeadm join前部署keepalived与haproxy，--ha-peers需包含全部控制面节点地址，不在其中的节点需同步更新已有节点的haproxy后端:\n%s\n", setupHACommand(*bundle.HA))
 		}
+	} else if bundle.HA.Mode == HAKeepalived {
+		// 提示写入标准错误，不影响加入信息通过管道传递
+		_, _ = fmt.Fprintln(os.Stderr, "新控制面节点加入后，需将其地址加入已有节点的--ha-peers并重新执行setup-ha更新haproxy后端")
 	}
-	if certKey == "" {
-		return errors.New("证书生成失败")
+	return nil
+}
+
+// newJoinBundle 创建令牌并生成加入信息，控制面节点同时上传证书
+func newJoinBundle(controlPlane bool, ttl time.Duration) (JoinBundle, error) {
+	bundle := JoinBundle{ControlPlane: controlPlane}
+	for _, value := range joinTaints {
+		t, err := ParseTaint(value)
+		if err != nil {
+			return bundle, err
+		}
+		bundle.Taints = append(bundle.Taints, t)
+	}
+	bundle.Labels = joinLabels
+	if err := validateNodeLabels(bundle.Labels); err != nil {
+		return bundle, err
 	}
 
-	command, err := generateKubernetesJoinNodeCommand()
+	tokenOut, err := pkg.CmdOutput(exec.Command("kubeadm", "token", "create", "--ttl", ttl.String()))
 	if err != nil {
-		return err
+		return bundle, err
 	}
+	bundle.Token = strings.TrimSpace(string(tokenOut))
 
-	fmt.Printf("%s --control-plane --certificate-key %s\n", command, certKey)
+	hash, err := caCertHash(caCertFile)
+	if err != nil {
+		return bundle, err
+	}
+	bundle.CACertHashes = []string{hash}
 
-	return nil
+	if bundle.Endpoint, bundle.KubernetesVersion, err = clusterInfo(); err != nil {
+		return bundle, err
+	}
+
+	expires := ttl
+	if controlPlane {
+		if bundle.CertificateKey, err = uploadCerts(); err != nil {
+			return bundle, err
+		}
+		if bundle.HA, err = loadHAState(); err != nil {
+			return bundle, err
+		}
+		if expires == 0 || expires > certificateKeyTTL {
+			expires = certificateKeyTTL
+		}
+	}
+	if expires > 0 {
+		expiresAt := time.Now().Add(expires).UTC().Truncate(time.Second)
+		bundle.ExpiresAt = &expiresAt
+	}
+
+	if pkg.IsDryRun() {
+		bundle.Token = "abcdef.0123456789abcdef"
+		if controlPlane {
+			bundle.CertificateKey = "<certificate-key>"
+		}
+	}
+	return bundle, nil
 }
 
-// joinKubernetesWorkerNode 添加工作节点
-func joinKubernetesWorkerNode() error {
-	command, err := generateKubernetesJoinNodeCommand()
+// uploadCerts 上传控制面证书并返回解密密钥
+func uploadCerts() (string, error) {
+	certOut, err := pkg.CmdOutput(exec.Command("kubeadm", "init", "phase", "upload-certs", "--upload-certs"))
 	if err != nil {
-		return err
+		return "", err
 	}
-	log.Println(command)
-	return nil
+	for _, line := range strings.Split(strings.TrimSpace(string(certOut)), "\n") {
+		if ok, _ := regexp.MatchString("^[a-zA-Z0-9]+$", line); ok {
+			return line, nil
+		}
+	}
+	if pkg.IsDryRun() {
+		return "", nil
+	}
+	return "", errors.New("证书生成失败")
 }
 
-func generateKubernetesJoinNodeCommand() (string, error) {
-	tokenCmd := exec.Command("kubeadm", "token", "create")
-	tokenOut, err := tokenCmd.Output()
+// caCertHash 计算CA证书公钥的sha256哈希，与kubeadm的--discovery-token-ca-cert-hash一致
+func caCertHash(file string) (string, error) {
+	data, err := pkg.ReadFile(file)
 	if err != nil {
+		if pkg.IsDryRun() {
+			return "sha256:<ca-cert-hash>", nil
+		}
 		return "", err
 	}
-	token := strings.TrimSpace(string(tokenOut))
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return "", fmt.Errorf("%s不是有效的PEM证书", file)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s解析失败: %w", file, err)
+	}
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// clusterInfo 集群访问地址与版本，访问地址优先使用kubeadm-config中的controlPlaneEndpoint，高可用集群中为虚拟IP
+func clusterInfo() (endpoint, version string, err error) {
+	out, err := pkg.CmdOutput(exec.Command(
+		"kubectl", "-n", "kube-system", "get", "configmap", "kubeadm-config",
+		"-o", "jsonpath={.data.ClusterConfiguration}",
+	))
+	if err == nil {
+		var config struct {
+			ControlPlaneEndpoint string `yaml:"controlPlaneEndpoint"`
+			KubernetesVersion    string `yaml:"kubernetesVersion"`
+		}
+		if yaml.Unmarshal(out, &config) == nil {
+			endpoint, version = config.ControlPlaneEndpoint, config.KubernetesVersion
+		}
+	}
+	if endpoint != "" {
+		return endpoint, version, nil
+	}
+	if state, err := loadHAState(); err == nil && state != nil && state.Endpoint != "" {
+		return state.Endpoint, version, nil
+	}
 
-	certCmd := exec.Command(
-		"/bin/bash",
-		"-c",
-		`openssl x509 -pubkey -in /etc/kubernetes/pki/ca.crt | openssl rsa -pubin -outform der 2>/dev/null | openssl dgst -sha256 -hex | sed 's/^.* //'`,
-	)
-	certOut, err := certCmd.Output()
+	serverAddr, err := k8sServerAddr()
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+	return net.JoinHostPort(serverAddr, "6443"), version, nil
+}
+
+func initJoinNodeCmd() {
+	flags := joinKubernetesNodeCmd.Flags()
+	flags.BoolVarP(&joinMasterNode, "control-plane", "", false, "加入控制面节点")
+	flags.StringToStringVarP(&joinLabels, "labels", "", nil, "新节点的标签，如disktype=ssd,zone=a，仅写入加入信息")
+	flags.StringSliceVarP(&joinTaints, "taints", "", nil, "新节点的污点，格式为key=value:Effect，仅写入加入信息，控制面节点指定后替换默认污点")
+	flags.DurationVarP(&joinTokenTTL, "ttl", "", 24*time.Hour, "令牌有效期，0为永不过期，控制面节点的证书密钥有效期为2小时")
+	flags.StringVarP(&joinOutput, "output", "o", "text", "输出格式: text|json|yaml，text输出kubeadm join命令")
+	flags.StringVarP(&joinBundleFile, "bundle", "", "", "将加入信息保存到文件(JSON)")
+	addAdvertiseFlags(joinKubernetesNodeCmd)
+}
+
+// kubeadmJoinConfigFile 新节点的kubeadm join配置
+const kubeadmJoinConfigFile = "/etc/kubernetes/kubeadm-join.yaml"
+
+var (
+	joinFrom         string
+	joinNodeName     string
+	joinBindPort     int
+	joinVIPInterface string
+	joinWaitTimeout  time.Duration
+)
+
+// joinClusterCmd 在新节点上根据加入信息加入集群
+var joinClusterCmd = &cobra.Command{
+	Use:   "join",
+	Short: "根据加入信息将当前节点加入集群",
+	Long: "读取控制面节点join-node -o json或--bundle生成的加入信息，执行预检、生成" + kubeadmJoinConfigFile +
+		"并执行kubeadm join，等待节点就绪；控制面节点在集群启用高可用时同时部署高可用组件。\n" +
+		"可通过管道直接传递: ssh master devops k8s join-node -o json | devops k8s join --from -",
+	Run: func(cmd *cobra.Command, args []string) {
+		bundle, err := loadJoinBundle(joinFrom)
+		if err == nil {
+			err = joinCluster(bundle)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// loadJoinBundle 读取加入信息，-为标准输入
+func loadJoinBundle(file string) (JoinBundle, error) {
+	var bundle JoinBundle
+	if file == "" {
+		return bundle, errors.New("请通过--from指定加入信息文件")
+	}
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return bundle, err
+	}
+	// JSON是YAML的子集，两种格式均可解析
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&bundle); err != nil {
+		return bundle, fmt.Errorf("加入信息解析失败: %w", err)
+	}
+	return bundle, bundle.Validate()
+}
+
+// joinCluster 将当前节点加入集群
+func joinCluster(bundle JoinBundle) error {
+	role := preflight.RoleWorker
+	if bundle.ControlPlane {
+		role = preflight.RoleControlPlane
+	}
+	if !skipPreflight {
+		if err := preflight.Gate(preflight.Options{
+			Stage:             preflight.StageJoin,
+			Role:              role,
+			WithDocker:        containerWithDocker,
+			KubernetesVersion: bundle.KubernetesVersion,
+		}); err != nil {
+			return err
+		}
+	}
+
+	nodeName := joinNodeName
+	if nodeName == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return err
+		}
+		nodeName = strings.ToLower(hostname)
+	}
+
+	var addr string
+	var ha *HASpec
+	if bundle.ControlPlane {
+		var vip string
+		if bundle.HA != nil {
+			vip = bundle.HA.VIP
+		}
+		var err error
+		if addr, err = k8sServerAddr(vip); err != nil {
+			return err
+		}
+		if bundle.HA != nil {
+			h := bundle.HA.HASpec
+			// 网卡名称因节点而异，未指定时按当前节点地址重新检测
+			h.Interface = joinVIPInterface
+			if !slices.ContainsFunc(h.Peers, func(peer string) bool { return net.ParseIP(peer).Equal(net.ParseIP(addr)) }) {
+				h.Peers = append(h.Peers, addr)
+			}
+			if h, err = h.withDefaults(addr); err != nil {
+				return err
+			}
+			if err = h.Validate(addr); err != nil {
+				return err
+			}
+			ha = &h
+		}
+	}
+
+	config, err := renderJoinConfig(bundle, nodeName, addr)
+	if err != nil {
+		return err
+	}
+	if err = pkg.MkdirAll(filepath.Dir(kubeadmJoinConfigFile), 0755); err != nil {
+		return err
+	}
+	if err = pkg.WriteFile(kubeadmJoinConfigFile, config, 0600); err != nil {
+		return err
+	}
+
+	node := haNode{AdvertiseAddress: addr, BindPort: joinBindPort, KubernetesVersion: bundle.KubernetesVersion}
+	// keepalived需在join前部署，本节点的haproxy同样转发到虚拟IP所在节点
+	if ha != nil && ha.Mode == HAKeepalived {
+		if err = setupHA(*ha, node); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\n节点%s加入集群%s...\n", nodeName, bundle.Endpoint)
+	if err = pkg.ExecCmd(exec.Command("kubeadm", "join", "--config", kubeadmJoinConfigFile)); err != nil {
+		return err
+	}
+
+	if bundle.ControlPlane {
+		// kube-vip静态Pod依赖join生成的admin.conf
+		if ha != nil {
+			if ha.Mode == HAKubeVIP {
+				if err = setupHA(*ha, node); err != nil {
+					return err
+				}
+			}
+			if err = saveHAState(*ha, bundle.HA.Endpoint); err != nil {
+				return err
+			}
+		}
+		if err = installAdminKubeconfig(); err != nil {
+			return err
+		}
+	}
+
+	if joinWaitTimeout > 0 {
+		if err = waitNodeReady(nodeName, joinWaitTimeout); err != nil {
+			return err
+		}
+	}
+	if ha != nil && ha.Mode == HAKeepalived {
+		fmt.Printf("\n请在已有控制面节点将%s加入--ha-peers后重新执行setup-ha，更新haproxy后端\n", addr)
+	}
+	return nil
+}
+
+// renderJoinConfig 生成JoinConfiguration，配置版本按本机kubeadm版本选择
+func renderJoinConfig(bundle JoinBundle, nodeName, advertiseAddress string) ([]byte, error) {
+	version := bundle.KubernetesVersion
+	if out, err := pkg.CmdOutput(exec.Command("kubeadm", "version", "-o", "short")); err == nil && len(out) > 0 {
+		version = strings.TrimSpace(string(out))
+	}
+	apiVersion := kubeadmAPIVersion(version)
+
+	var kubeletArgs map[string]string
+	if len(bundle.Labels) > 0 {
+		pairs := make([]string, 0, len(bundle.Labels))
+		for key, value := range bundle.Labels {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		kubeletArgs = map[string]string{"node-labels": strings.Join(pairs, ",")}
+	}
+
+	config := joinConfiguration{
+		typeMeta: typeMeta{APIVersion: apiVersion, Kind: "JoinConfiguration"},
+		Discovery: discovery{BootstrapToken: bootstrapTokenDiscovery{
+			APIServerEndpoint: bundle.Endpoint,
+			Token:             bundle.Token,
+			CACertHashes:      bundle.CACertHashes,
+		}},
+		NodeRegistration: nodeRegistration{
+			Name:             nodeName,
+			CRISocket:        container.CRISocket(containerWithDocker),
+			Taints:           bundle.Taints,
+			KubeletExtraArgs: extraArgs(apiVersion, kubeletArgs, nil),
+		},
+	}
+	if bundle.ControlPlane {
+		config.ControlPlane = &joinControlPlaneNode{
+			LocalAPIEndpoint: apiEndpoint{AdvertiseAddress: advertiseAddress, BindPort: joinBindPort},
+			CertificateKey:   bundle.CertificateKey,
+		}
 	}
-	certKey := strings.TrimSpace(string(certOut))
 
-	serverAddr := k8sServerAddr()
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(config); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// waitNodeReady 使用kubelet凭据等待节点就绪
+func waitNodeReady(nodeName string, timeout time.Duration) error {
+	fmt.Printf("\n等待节点%s就绪...\n", nodeName)
+	cmd := func() *exec.Cmd {
+		return exec.Command(
+			"kubectl", "--kubeconfig", "/etc/kubernetes/kubelet.conf", "get", "node", nodeName,
+			"-o", `jsonpath={.status.conditions[?(@.type=="Ready")].status}`,
+		)
+	}
+	if pkg.IsDryRun() {
+		_, err := pkg.CmdOutput(cmd())
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		out, err := pkg.CmdOutput(cmd())
+		if err == nil && strings.TrimSpace(string(out)) == "True" {
+			fmt.Printf("节点%s已就绪\n", nodeName)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("节点%s在%s内未就绪，请检查kubelet日志: journalctl -u kubelet，以及网络插件Pod是否运行", nodeName, timeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
 
-	return fmt.Sprintf(`kubeadm join %s:6443 --token %s \
-        --discovery-token-ca-cert-hash sha256:%s`, serverAddr, token, certKey), nil
+func initJoinClusterCmd() {
+	flags := joinClusterCmd.Flags()
+	flags.StringVarP(&joinFrom, "from", "", "", "加入信息文件，-为标准输入")
+	flags.StringVarP(&joinNodeName, "node-name", "", "", "节点名称，默认为主机名")
+	flags.BoolVarP(&containerWithDocker, "with-docker", "", false, "使用Docker(cri-dockerd)，默认为containerd")
+	flags.IntVarP(&joinBindPort, "apiserver-port", "", 6443, "控制面节点的APIServer端口")
+	flags.StringVarP(&joinVIPInterface, "vip-interface", "", "", "高可用集群中虚拟IP绑定的网卡，默认为节点地址所在网卡")
+	flags.DurationVarP(&joinWaitTimeout, "wait", "", 5*time.Minute, "等待节点就绪的超时时间，0为不等待")
+	preflight.AddFlags(joinClusterCmd, &skipPreflight)
+	addAdvertiseFlags(joinClusterCmd)
 }
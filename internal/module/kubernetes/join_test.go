@@ -0,0 +1,304 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// fakeRunner 按命令行返回预设输出，未预设的命令返回错误
+type fakeRunner map[string]string
+
+func (r fakeRunner) Run(*exec.Cmd) error {
+	return nil
+}
+
+func (r fakeRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	out, ok := r[pkg.CommandLine(cmd)]
+	if !ok {
+		return nil, errors.New("command not found")
+	}
+	return []byte(out), nil
+}
+
+// useRunner 替换命令执行器，测试结束后恢复
+func useRunner(t *testing.T, r pkg.Runner) {
+	t.Helper()
+	prev := pkg.GetRunner()
+	pkg.SetRunner(r)
+	t.Cleanup(func() { pkg.SetRunner(prev) })
+}
+
+// testJoinBundle 测试用加入信息
+func testJoinBundle() JoinBundle {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	return JoinBundle{
+		Endpoint:          "192.168.1.100:6443",
+		Token:             "abcdef.0123456789abcdef",
+		CACertHashes:      []string{"sha256:" + strings.Repeat("ab", 32)},
+		KubernetesVersion: "v1.30.4",
+		Labels:            map[string]string{"env": "prod", "node.kubernetes.io/pool": "web"},
+		Taints:            []Taint{{Key: "dedicated", Value: "web", Effect: "NoSchedule"}},
+		ExpiresAt:         &expiresAt,
+	}
+}
+
+func TestLoadJoinBundle(t *testing.T) {
+	controlPlane := testJoinBundle()
+	controlPlane.ControlPlane = true
+	controlPlane.CertificateKey = strings.Repeat("0f", 32)
+	controlPlane.HA = &haState{
+		HASpec:   HASpec{Mode: HAKeepalived, VIP: "192.168.1.100", Peers: []string{"192.168.1.10"}, RouterID: 51},
+		Endpoint: "192.168.1.100:8443",
+	}
+
+	tests := []struct {
+		name    string
+		bundle  JoinBundle
+		marshal func(v any) ([]byte, error)
+	}{
+		{name: "工作节点JSON", bundle: testJoinBundle(), marshal: func(v any) ([]byte, error) { return json.MarshalIndent(v, "", "  ") }},
+		{name: "控制面节点JSON", bundle: controlPlane, marshal: func(v any) ([]byte, error) { return json.MarshalIndent(v, "", "  ") }},
+		{name: "控制面节点YAML", bundle: controlPlane, marshal: yaml.Marshal},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.marshal(tt.bundle)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file := filepath.Join(t.TempDir(), "join.json")
+			if err = os.WriteFile(file, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadJoinBundle(file)
+			if err != nil {
+				t.Fatalf("loadJoinBundle() error = %v", err)
+			}
+			if !got.ExpiresAt.Equal(*tt.bundle.ExpiresAt) {
+				t.Errorf("ExpiresAt = %v, want %v", got.ExpiresAt, tt.bundle.ExpiresAt)
+			}
+			got.ExpiresAt = tt.bundle.ExpiresAt
+			if !reflect.DeepEqual(got, tt.bundle) {
+				t.Errorf("loadJoinBundle() = %+v, want %+v", got, tt.bundle)
+			}
+		})
+	}
+}
+
+func TestLoadJoinBundleInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "未知字段", data: `{"endpoint": "192.168.1.100:6443", "tokens": "x"}`, wantErr: "加入信息解析失败"},
+		{name: "格式错误", data: `{"endpoint": `, wantErr: "加入信息解析失败"},
+		{name: "校验失败", data: `{"endpoint": "192.168.1.100:6443", "token": "abc"}`, wantErr: "令牌abc格式无效"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "join.json")
+			if err := os.WriteFile(file, []byte(tt.data), 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := loadJoinBundle(file)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadJoinBundle() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := loadJoinBundle(""); err == nil {
+		t.Error("loadJoinBundle(\"\") should fail")
+	}
+}
+
+func TestJoinBundleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(b *JoinBundle)
+		wantErr string
+	}{
+		{name: "有效", modify: func(b *JoinBundle) {}},
+		{
+			name:    "集群地址缺少端口",
+			modify:  func(b *JoinBundle) { b.Endpoint = "192.168.1.100" },
+			wantErr: "集群地址192.168.1.100无效",
+		},
+		{
+			name:    "令牌格式错误",
+			modify:  func(b *JoinBundle) { b.Token = "ABCDEF.0123456789abcdef" },
+			wantErr: "格式无效",
+		},
+		{
+			name:    "缺少CA证书哈希",
+			modify:  func(b *JoinBundle) { b.CACertHashes = nil },
+			wantErr: "缺少CA证书哈希",
+		},
+		{
+			name:    "CA证书哈希格式错误",
+			modify:  func(b *JoinBundle) { b.CACertHashes = []string{"md5:abc"} },
+			wantErr: "格式为sha256:<hex>",
+		},
+		{
+			name:    "控制面节点缺少证书密钥",
+			modify:  func(b *JoinBundle) { b.ControlPlane = true },
+			wantErr: "缺少证书密钥",
+		},
+		{
+			name: "已过期",
+			modify: func(b *JoinBundle) {
+				expiresAt := time.Now().Add(-time.Minute)
+				b.ExpiresAt = &expiresAt
+			},
+			wantErr: "过期",
+		},
+		{
+			name:    "受限节点标签",
+			modify:  func(b *JoinBundle) { b.Labels = map[string]string{"node-role.kubernetes.io/worker": ""} },
+			wantErr: "kubelet不能设置节点标签node-role.kubernetes.io/worker",
+		},
+		{
+			name:    "空节点标签",
+			modify:  func(b *JoinBundle) { b.Labels = map[string]string{"example.com/": "x"} },
+			wantErr: "节点标签example.com/无效",
+		},
+		{
+			name:    "污点效果无效",
+			modify:  func(b *JoinBundle) { b.Taints = []Taint{{Key: "dedicated", Effect: "NoRun"}} },
+			wantErr: "效果NoRun无效",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := testJoinBundle()
+			tt.modify(&bundle)
+			err := bundle.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseTaint(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Taint
+		wantErr bool
+	}{
+		{value: "dedicated=web:NoSchedule", want: Taint{Key: "dedicated", Value: "web", Effect: "NoSchedule"}},
+		{value: "gpu:NoExecute", want: Taint{Key: "gpu", Effect: "NoExecute"}},
+		{value: " spot=true:PreferNoSchedule ", want: Taint{Key: "spot", Value: "true", Effect: "PreferNoSchedule"}},
+		{value: "dedicated=web", wantErr: true},
+		{value: ":NoSchedule", wantErr: true},
+		{value: "dedicated=web:NoRun", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseTaint(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTaint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("ParseTaint() = %+v, want %+v", got, tt.want)
+			}
+			if again, _ := ParseTaint(got.String()); again != got {
+				t.Errorf("ParseTaint(%q) = %+v, want %+v", got.String(), again, got)
+			}
+		})
+	}
+}
+
+func TestRenderJoinConfig(t *testing.T) {
+	tests := []struct {
+		name           string
+		kubeadmVersion string
+		controlPlane   bool
+		wantAPIVersion string
+		wantLabels     any
+	}{
+		{
+			name:           "kubeadm不可用时按加入信息版本",
+			wantAPIVersion: "kubeadm.k8s.io/v1beta3",
+			wantLabels:     map[string]any{"node-labels": "env=prod,node.kubernetes.io/pool=web"},
+		},
+		{
+			name:           "按本机kubeadm版本使用v1beta4",
+			kubeadmVersion: "v1.31.1\n",
+			controlPlane:   true,
+			wantAPIVersion: "kubeadm.k8s.io/v1beta4",
+			wantLabels:     []any{map[string]any{"name": "node-labels", "value": "env=prod,node.kubernetes.io/pool=web"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := fakeRunner{}
+			if tt.kubeadmVersion != "" {
+				runner["kubeadm version -o short"] = tt.kubeadmVersion
+			}
+			useRunner(t, runner)
+			bundle := testJoinBundle()
+			if tt.controlPlane {
+				bundle.ControlPlane = true
+				bundle.CertificateKey = strings.Repeat("0f", 32)
+			}
+
+			data, err := renderJoinConfig(bundle, "node1", "192.168.1.11")
+			if err != nil {
+				t.Fatalf("renderJoinConfig() error = %v", err)
+			}
+			var config map[string]any
+			if err = yaml.Unmarshal(data, &config); err != nil {
+				t.Fatal(err)
+			}
+			if config["apiVersion"] != tt.wantAPIVersion || config["kind"] != "JoinConfiguration" {
+				t.Errorf("apiVersion = %v, kind = %v", config["apiVersion"], config["kind"])
+			}
+			discovery := config["discovery"].(map[string]any)["bootstrapToken"].(map[string]any)
+			if discovery["apiServerEndpoint"] != bundle.Endpoint || discovery["token"] != bundle.Token {
+				t.Errorf("discovery.bootstrapToken = %v", discovery)
+			}
+			registration := config["nodeRegistration"].(map[string]any)
+			if registration["name"] != "node1" {
+				t.Errorf("nodeRegistration.name = %v", registration["name"])
+			}
+			if !reflect.DeepEqual(registration["kubeletExtraArgs"], tt.wantLabels) {
+				t.Errorf("kubeletExtraArgs = %#v, want %#v", registration["kubeletExtraArgs"], tt.wantLabels)
+			}
+			wantTaints := []any{map[string]any{"key": "dedicated", "value": "web", "effect": "NoSchedule"}}
+			if !reflect.DeepEqual(registration["taints"], wantTaints) {
+				t.Errorf("taints = %#v", registration["taints"])
+			}
+
+			controlPlane, ok := config["controlPlane"].(map[string]any)
+			if ok != tt.controlPlane {
+				t.Fatalf("controlPlane = %v, want present %v", config["controlPlane"], tt.controlPlane)
+			}
+			if ok {
+				endpoint := controlPlane["localAPIEndpoint"].(map[string]any)
+				if endpoint["advertiseAddress"] != "192.168.1.11" || controlPlane["certificateKey"] != bundle.CertificateKey {
+					t.Errorf("controlPlane = %v", controlPlane)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"gopkg.in/yaml.v3"
+)
+
+// kubeadmConfigFile kubeadm配置文件
+const kubeadmConfigFile = "/etc/kubernetes/kubeadm-config.yaml"
+
+// ClusterSpec 集群配置，可通过--config指定的YAML文件或命令行参数设置
+type ClusterSpec struct {
+	KubernetesVersion    string            `yaml:"kubernetesVersion,omitempty"`
+	ImageRepository      string            `yaml:"imageRepository,omitempty"`
+	AdvertiseAddress     string            `yaml:"advertiseAddress,omitempty"`
+	BindPort             int               `yaml:"bindPort,omitempty"`
+	ControlPlaneEndpoint string            `yaml:"controlPlaneEndpoint,omitempty"`
+	ServiceSubnet        string            `yaml:"serviceSubnet,omitempty"`
+	PodSubnet            string            `yaml:"podSubnet,omitempty"`
+	DNSDomain            string            `yaml:"dnsDomain,omitempty"`
+	CertSANs             []string          `yaml:"certSANs,omitempty"`
+	CRISocket            string            `yaml:"criSocket,omitempty"`
+	CgroupDriver         string            `yaml:"cgroupDriver,omitempty"`
+	ProxyMode            string            `yaml:"proxyMode,omitempty"`
+	FeatureGates         map[string]bool   `yaml:"featureGates,omitempty"`
+	APIServerArgs        map[string]string `yaml:"apiServerExtraArgs,omitempty"`
+	ControllerArgs       map[string]string `yaml:"controllerManagerExtraArgs,omitempty"`
+	SchedulerArgs        map[string]string `yaml:"schedulerExtraArgs,omitempty"`
+	KubeletArgs          map[string]string `yaml:"kubeletExtraArgs,omitempty"`
+	CNI                  CNISpec           `yaml:"cni,omitempty"`
+	HA                   HASpec            `yaml:"ha,omitempty"`
+}
+
+// defaultClusterSpec 默认集群配置
+func defaultClusterSpec() ClusterSpec {
+	return ClusterSpec{
+		BindPort:      6443,
+		ServiceSubnet: "10.96.0.0/16",
+		PodSubnet:     "10.244.0.0/16",
+		DNSDomain:     "cluster.local",
+		CgroupDriver:  "systemd",
+		CNI:           CNISpec{Plugin: CNICalico},
+	}
+}
+
+// loadClusterSpec 读取集群配置文件，未配置的字段使用默认值
+func loadClusterSpec(file string) (ClusterSpec, error) {
+	spec := defaultClusterSpec()
+	if file == "" {
+		return spec, nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return spec, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err = decoder.Decode(&spec); err != nil {
+		return spec, fmt.Errorf("%s解析失败: %w", file, err)
+	}
+	return spec, nil
+}
+
+// Validate 校验集群配置
+func (s ClusterSpec) Validate() error {
+	if s.KubernetesVersion == "" {
+		return fmt.Errorf("未指定Kubernetes版本")
+	}
+	if s.AdvertiseAddress != "" && net.ParseIP(s.AdvertiseAddress) == nil {
+		return fmt.Errorf("advertiseAddress %s不是有效的IP地址", s.AdvertiseAddress)
+	}
+	serviceNets, err := parseCIDRs("serviceSubnet", s.ServiceSubnet)
+	if err != nil {
+		return err
+	}
+	podNets, err := parseCIDRs("podSubnet", s.PodSubnet)
+	if err != nil {
+		return err
+	}
+	for _, serviceNet := range serviceNets {
+		for _, podNet := range podNets {
+			if serviceNet.Contains(podNet.IP) || podNet.Contains(serviceNet.IP) {
+				return fmt.Errorf("serviceSubnet %s与podSubnet %s重叠", serviceNet, podNet)
+			}
+		}
+	}
+	// 单栈集群的网段需与节点地址同族，双栈时各族均需配置网段
+	if ip := net.ParseIP(s.AdvertiseAddress); ip != nil {
+		for _, nets := range [][]*net.IPNet{serviceNets, podNets} {
+			if !sameFamily(ip, nets) {
+				return fmt.Errorf("节点地址%s与网段%s地址族不一致，IPv6集群需同时指定--service-cidr与--pod-network-cidr", ip, nets[0])
+			}
+		}
+	}
+	switch s.CgroupDriver {
+	case "systemd", "cgroupfs":
+	default:
+		return fmt.Errorf("cgroupDriver仅支持systemd与cgroupfs")
+	}
+	switch s.ProxyMode {
+	case "", "iptables", "ipvs", "nftables":
+	default:
+		return fmt.Errorf("proxyMode仅支持iptables、ipvs与nftables")
+	}
+	if err = s.CNI.Validate(); err != nil {
+		return err
+	}
+	for _, san := range s.CertSANs {
+		if net.ParseIP(san) == nil && !validDNSName(san) {
+			return fmt.Errorf("certSANs中的%s不是有效的IP地址或域名", san)
+		}
+	}
+	if err = s.HA.Validate(s.AdvertiseAddress); err != nil {
+		return err
+	}
+	if s.HA.Enabled() {
+		// 使用域名时由用户保证解析到虚拟IP
+		host, _, err := net.SplitHostPort(s.ControlPlaneEndpoint)
+		if ip := net.ParseIP(host); err != nil || ip != nil && !ip.Equal(net.ParseIP(s.HA.VIP)) {
+			return fmt.Errorf("启用高可用时controlPlaneEndpoint %s需指向虚拟IP %s", s.ControlPlaneEndpoint, s.HA.VIP)
+		}
+	}
+	return nil
+}
+
+// withHA 启用高可用时补全controlPlaneEndpoint并将虚拟IP加入APIServer证书
+func (s ClusterSpec) withHA() (ClusterSpec, error) {
+	if !s.HA.Enabled() || net.ParseIP(s.HA.VIP) == nil {
+		return s, nil
+	}
+	var err error
+	if s.HA, err = s.HA.withDefaults(s.AdvertiseAddress); err != nil {
+		return s, err
+	}
+	if s.ControlPlaneEndpoint == "" {
+		s.ControlPlaneEndpoint = s.HA.Endpoint(s.BindPort)
+	}
+	for _, san := range s.CertSANs {
+		if san == s.HA.VIP {
+			return s, nil
+		}
+	}
+	s.CertSANs = append(s.CertSANs, s.HA.VIP)
+	return s, nil
+}
+
+// parseCIDRs 解析逗号分隔的网段，双栈集群可同时指定IPv4与IPv6网段
+func parseCIDRs(field, value string) ([]*net.IPNet, error) {
+	var list []*net.IPNet
+	for _, item := range strings.Split(value, ",") {
+		_, ipNet, err := net.ParseCIDR(strings.TrimSpace(item))
+		if err != nil {
+			return nil, fmt.Errorf("%s %s无效: %w", field, value, err)
+		}
+		list = append(list, ipNet)
+	}
+	if len(list) > 2 || len(list) == 2 && sameFamily(list[0].IP, list[1:]) {
+		return nil, fmt.Errorf("%s %s无效，双栈网段需为一个IPv4与一个IPv6网段", field, value)
+	}
+	return list, nil
+}
+
+// sameFamily nets中是否存在与ip同族的网段
+func sameFamily(ip net.IP, nets []*net.IPNet) bool {
+	for _, ipNet := range nets {
+		if (ip.To4() != nil) == (ipNet.IP.To4() != nil) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDNSName 是否为合法的域名，允许通配符前缀
+func validDNSName(name string) bool {
+	name = strings.TrimPrefix(name, "*.")
+	if name == "" || len(name) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// kubeadmAPIVersion Kubernetes 1.31起使用v1beta4，extraArgs改为name/value列表
+func kubeadmAPIVersion(k8sVersion string) string {
+	if compat.AtLeast(k8sVersion, "1.31") {
+		return "kubeadm.k8s.io/v1beta4"
+	}
+	return "kubeadm.k8s.io/v1beta3"
+}
+
+type typeMeta struct {
+	APIVersion string `yaml:"apiVersion"`
+	Kind       string `yaml:"kind"`
+}
+
+type initConfiguration struct {
+	typeMeta         `yaml:",inline"`
+	LocalAPIEndpoint apiEndpoint      `yaml:"localAPIEndpoint"`
+	NodeRegistration nodeRegistration `yaml:"nodeRegistration"`
+}
+
+type apiEndpoint struct {
+	AdvertiseAddress string `yaml:"advertiseAddress,omitempty"`
+	BindPort         int    `yaml:"bindPort,omitempty"`
+}
+
+type nodeRegistration struct {
+	Name             string  `yaml:"name,omitempty"`
+	CRISocket        string  `yaml:"criSocket,omitempty"`
+	Taints           []Taint `yaml:"taints,omitempty"`
+	KubeletExtraArgs any     `yaml:"kubeletExtraArgs,omitempty"`
+}
+
+type joinConfiguration struct {
+	typeMeta         `yaml:",inline"`
+	Discovery        discovery             `yaml:"discovery"`
+	NodeRegistration nodeRegistration      `yaml:"nodeRegistration"`
+	ControlPlane     *joinControlPlaneNode `yaml:"controlPlane,omitempty"`
+}
+
+type discovery struct {
+	BootstrapToken bootstrapTokenDiscovery `yaml:"bootstrapToken"`
+}
+
+type bootstrapTokenDiscovery struct {
+	APIServerEndpoint string   `yaml:"apiServerEndpoint"`
+	Token             string   `yaml:"token"`
+	CACertHashes      []string `yaml:"caCertHashes"`
+}
+
+type joinControlPlaneNode struct {
+	LocalAPIEndpoint apiEndpoint `yaml:"localAPIEndpoint"`
+	CertificateKey   string      `yaml:"certificateKey,omitempty"`
+}
+
+type clusterConfiguration struct {
+	typeMeta             `yaml:",inline"`
+	KubernetesVersion    string           `yaml:"kubernetesVersion"`
+	ImageRepository      string           `yaml:"imageRepository,omitempty"`
+	ControlPlaneEndpoint string           `yaml:"controlPlaneEndpoint,omitempty"`
+	Networking           networking       `yaml:"networking"`
+	APIServer            apiServer        `yaml:"apiServer,omitempty"`
+	ControllerManager    controlComponent `yaml:"controllerManager,omitempty"`
+	Scheduler            controlComponent `yaml:"scheduler,omitempty"`
+}
+
+type networking struct {
+	ServiceSubnet string `yaml:"serviceSubnet,omitempty"`
+	PodSubnet     string `yaml:"podSubnet,omitempty"`
+	DNSDomain     string `yaml:"dnsDomain,omitempty"`
+}
+
+type apiServer struct {
+	CertSANs  []string `yaml:"certSANs,omitempty"`
+	ExtraArgs any      `yaml:"extraArgs,omitempty"`
+}
+
+type controlComponent struct {
+	ExtraArgs any `yaml:"extraArgs,omitempty"`
+}
+
+type kubeletConfiguration struct {
+	typeMeta     `yaml:",inline"`
+	CgroupDriver string          `yaml:"cgroupDriver"`
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+}
+
+type kubeProxyConfiguration struct {
+	typeMeta     `yaml:",inline"`
+	Mode         string          `yaml:"mode,omitempty"`
+	ClusterCIDR  string          `yaml:"clusterCIDR,omitempty"`
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+}
+
+// extraArg v1beta4中的extraArgs元素
+type extraArg struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// extraArgs 按kubeadm配置版本生成extraArgs，featureGates合并为feature-gates参数
+func extraArgs(apiVersion string, args map[string]string, featureGates map[string]bool) any {
+	merged := map[string]string{}
+	for key, value := range args {
+		merged[key] = value
+	}
+	if gates := featureGatesArg(featureGates); gates != "" {
+		if _, ok := merged["feature-gates"]; !ok {
+			merged["feature-gates"] = gates
+		}
+	}
+	if len(merged) == 0 {
+		return nil
+	}
+	if !strings.HasSuffix(apiVersion, "v1beta4") {
+		return merged
+	}
+	keys := make([]string, 0, len(merged))
+	for key := range merged {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	list := make([]extraArg, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, extraArg{Name: key, Value: merged[key]})
+	}
+	return list
+}
+
+// featureGatesArg 生成feature-gates参数值，如A=true,B=false
+func featureGatesArg(featureGates map[string]bool) string {
+	var gates []string
+	for name, enabled := range featureGates {
+		gates = append(gates, fmt.Sprintf("%s=%t", name, enabled))
+	}
+	sort.Strings(gates)
+	return strings.Join(gates, ",")
+}
+
+// Render 生成kubeadm配置，包含InitConfiguration、ClusterConfiguration、KubeletConfiguration与KubeProxyConfiguration
+func (s ClusterSpec) Render() ([]byte, error) {
+	apiVersion := kubeadmAPIVersion(s.KubernetesVersion)
+	documents := []any{
+		initConfiguration{
+			typeMeta:         typeMeta{APIVersion: apiVersion, Kind: "InitConfiguration"},
+			LocalAPIEndpoint: apiEndpoint{AdvertiseAddress: s.AdvertiseAddress, BindPort: s.BindPort},
+			NodeRegistration: nodeRegistration{
+				CRISocket:        s.CRISocket,
+				KubeletExtraArgs: extraArgs(apiVersion, s.KubeletArgs, nil),
+			},
+		},
+		clusterConfiguration{
+			typeMeta:             typeMeta{APIVersion: apiVersion, Kind: "ClusterConfiguration"},
+			KubernetesVersion:    compat.NormalizeVersion(s.KubernetesVersion),
+			ImageRepository:      s.ImageRepository,
+			ControlPlaneEndpoint: s.ControlPlaneEndpoint,
+			Networking:           networking{ServiceSubnet: s.ServiceSubnet, PodSubnet: s.PodSubnet, DNSDomain: s.DNSDomain},
+			APIServer:            apiServer{CertSANs: s.CertSANs, ExtraArgs: extraArgs(apiVersion, s.APIServerArgs, s.FeatureGates)},
+			ControllerManager:    controlComponent{ExtraArgs: extraArgs(apiVersion, s.ControllerArgs, s.FeatureGates)},
+			Scheduler:            controlComponent{ExtraArgs: extraArgs(apiVersion, s.SchedulerArgs, s.FeatureGates)},
+		},
+		kubeletConfiguration{
+			typeMeta:     typeMeta{APIVersion: "kubelet.config.k8s.io/v1beta1", Kind: "KubeletConfiguration"},
+			CgroupDriver: s.CgroupDriver,
+			FeatureGates: s.FeatureGates,
+		},
+		kubeProxyConfiguration{
+			typeMeta:     typeMeta{APIVersion: "kubeproxy.config.k8s.io/v1alpha1", Kind: "KubeProxyConfiguration"},
+			Mode:         s.ProxyMode,
+			ClusterCIDR:  s.PodSubnet,
+			FeatureGates: s.FeatureGates,
+		},
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,282 @@
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// testClusterSpec 测试用集群配置
+func testClusterSpec(version string) ClusterSpec {
+	spec := defaultClusterSpec()
+	spec.KubernetesVersion = version
+	spec.AdvertiseAddress = "192.168.1.10"
+	spec.CNI = spec.CNI.withDefaults()
+	return spec
+}
+
+func TestClusterSpecValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(s *ClusterSpec)
+		wantErr string
+	}{
+		{name: "默认配置", modify: func(s *ClusterSpec) {}},
+		{
+			name:    "未指定版本",
+			modify:  func(s *ClusterSpec) { s.KubernetesVersion = "" },
+			wantErr: "未指定Kubernetes版本",
+		},
+		{
+			name:    "节点地址无效",
+			modify:  func(s *ClusterSpec) { s.AdvertiseAddress = "192.168.1" },
+			wantErr: "不是有效的IP地址",
+		},
+		{
+			name:    "serviceSubnet无效",
+			modify:  func(s *ClusterSpec) { s.ServiceSubnet = "10.96.0.0/33" },
+			wantErr: "serviceSubnet 10.96.0.0/33无效",
+		},
+		{
+			name:    "podSubnet无效",
+			modify:  func(s *ClusterSpec) { s.PodSubnet = "10.244.0.0" },
+			wantErr: "podSubnet 10.244.0.0无效",
+		},
+		{
+			name:    "网段重叠",
+			modify:  func(s *ClusterSpec) { s.PodSubnet = "10.96.128.0/17" },
+			wantErr: "重叠",
+		},
+		{
+			name: "双栈网段",
+			modify: func(s *ClusterSpec) {
+				s.ServiceSubnet = "10.96.0.0/16,fd00:10:96::/112"
+				s.PodSubnet = "10.244.0.0/16,fd00:10:244::/56"
+			},
+		},
+		{
+			name:    "双栈网段同族",
+			modify:  func(s *ClusterSpec) { s.PodSubnet = "10.244.0.0/16,10.245.0.0/16" },
+			wantErr: "双栈网段需为一个IPv4与一个IPv6网段",
+		},
+		{
+			name:    "IPv6节点使用IPv4网段",
+			modify:  func(s *ClusterSpec) { s.AdvertiseAddress = "fd00::10" },
+			wantErr: "地址族不一致",
+		},
+		{
+			name:    "cgroupDriver无效",
+			modify:  func(s *ClusterSpec) { s.CgroupDriver = "none" },
+			wantErr: "cgroupDriver仅支持systemd与cgroupfs",
+		},
+		{
+			name:    "proxyMode无效",
+			modify:  func(s *ClusterSpec) { s.ProxyMode = "userspace" },
+			wantErr: "proxyMode仅支持",
+		},
+		{
+			name:    "certSANs无效",
+			modify:  func(s *ClusterSpec) { s.CertSANs = []string{"api.example.com", "bad_name"} },
+			wantErr: "certSANs中的bad_name",
+		},
+		{
+			name: "高可用endpoint指向虚拟IP",
+			modify: func(s *ClusterSpec) {
+				s.HA = HASpec{Mode: HAKubeVIP, VIP: "192.168.1.100"}
+				s.ControlPlaneEndpoint = "192.168.1.100:6443"
+			},
+		},
+		{
+			name: "高可用endpoint使用域名",
+			modify: func(s *ClusterSpec) {
+				s.HA = HASpec{Mode: HAKubeVIP, VIP: "192.168.1.100"}
+				s.ControlPlaneEndpoint = "k8s.example.com:6443"
+			},
+		},
+		{
+			name: "高可用endpoint未指向虚拟IP",
+			modify: func(s *ClusterSpec) {
+				s.HA = HASpec{Mode: HAKubeVIP, VIP: "192.168.1.100"}
+				s.ControlPlaneEndpoint = "192.168.1.10:6443"
+			},
+			wantErr: "需指向虚拟IP",
+		},
+		{
+			name: "高可用endpoint缺少端口",
+			modify: func(s *ClusterSpec) {
+				s.HA = HASpec{Mode: HAKubeVIP, VIP: "192.168.1.100"}
+				s.ControlPlaneEndpoint = "192.168.1.100"
+			},
+			wantErr: "需指向虚拟IP",
+		},
+		{
+			name: "虚拟IP与节点地址相同",
+			modify: func(s *ClusterSpec) {
+				s.HA = HASpec{Mode: HAKubeVIP, VIP: "192.168.1.10"}
+				s.ControlPlaneEndpoint = "192.168.1.10:6443"
+			},
+			wantErr: "不能与节点地址相同",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := testClusterSpec("1.30.4")
+			tt.modify(&spec)
+			err := spec.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate() error = %v, want containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClusterSpecWithHA(t *testing.T) {
+	tests := []struct {
+		name         string
+		ha           HASpec
+		wantEndpoint string
+	}{
+		{name: "kube-vip", ha: HASpec{Mode: HAKubeVIP, VIP: "192.168.1.100", Interface: "eth0"}, wantEndpoint: "192.168.1.100:6443"},
+		{name: "keepalived", ha: HASpec{Mode: HAKeepalived, VIP: "192.168.1.100", Interface: "eth0"}, wantEndpoint: "192.168.1.100:8443"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := testClusterSpec("1.31.0")
+			spec.HA = tt.ha
+			spec.CertSANs = []string{"api.example.com"}
+			spec, err := spec.withHA()
+			if err != nil {
+				t.Fatalf("withHA() error = %v", err)
+			}
+			if spec.ControlPlaneEndpoint != tt.wantEndpoint {
+				t.Errorf("ControlPlaneEndpoint = %s, want %s", spec.ControlPlaneEndpoint, tt.wantEndpoint)
+			}
+			if want := []string{"api.example.com", "192.168.1.100"}; !reflect.DeepEqual(spec.CertSANs, want) {
+				t.Errorf("CertSANs = %v, want %v", spec.CertSANs, want)
+			}
+			if err = spec.Validate(); err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			// 重复补全不重复添加虚拟IP
+			if spec, _ = spec.withHA(); len(spec.CertSANs) != 2 {
+				t.Errorf("CertSANs = %v, want 2 entries", spec.CertSANs)
+			}
+		})
+	}
+}
+
+// renderDocuments 渲染kubeadm配置并按kind拆分
+func renderDocuments(t *testing.T, spec ClusterSpec) map[string]map[string]any {
+	t.Helper()
+	data, err := spec.Render()
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+	documents := map[string]map[string]any{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var document map[string]any
+		if err = decoder.Decode(&document); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("decode rendered config: %v", err)
+		}
+		documents[document["kind"].(string)] = document
+	}
+	return documents
+}
+
+func TestClusterSpecRender(t *testing.T) {
+	tests := []struct {
+		name           string
+		version        string
+		wantAPIVersion string
+		wantArgs       any
+		wantGates      any
+	}{
+		{
+			name:           "v1beta3使用map",
+			version:        "1.30.4",
+			wantAPIVersion: "kubeadm.k8s.io/v1beta3",
+			wantArgs: map[string]any{
+				"audit-log-maxage": "7",
+				"feature-gates":    "A=true,B=false",
+			},
+			wantGates: map[string]any{"feature-gates": "A=true,B=false"},
+		},
+		{
+			name:           "v1beta4使用name/value列表",
+			version:        "v1.31.0",
+			wantAPIVersion: "kubeadm.k8s.io/v1beta4",
+			wantArgs: []any{
+				map[string]any{"name": "audit-log-maxage", "value": "7"},
+				map[string]any{"name": "feature-gates", "value": "A=true,B=false"},
+			},
+			wantGates: []any{map[string]any{"name": "feature-gates", "value": "A=true,B=false"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := testClusterSpec(tt.version)
+			spec.ImageRepository = "registry.aliyuncs.com/google_containers"
+			spec.ProxyMode = "ipvs"
+			spec.FeatureGates = map[string]bool{"A": true, "B": false}
+			spec.APIServerArgs = map[string]string{"audit-log-maxage": "7"}
+			documents := renderDocuments(t, spec)
+
+			for _, kind := range []string{"InitConfiguration", "ClusterConfiguration"} {
+				if got := documents[kind]["apiVersion"]; got != tt.wantAPIVersion {
+					t.Errorf("%s apiVersion = %v, want %s", kind, got, tt.wantAPIVersion)
+				}
+			}
+			cluster := documents["ClusterConfiguration"]
+			if got := cluster["kubernetesVersion"]; got != "v"+strings.TrimPrefix(tt.version, "v") {
+				t.Errorf("kubernetesVersion = %v", got)
+			}
+			networking := cluster["networking"].(map[string]any)
+			if networking["serviceSubnet"] != spec.ServiceSubnet || networking["podSubnet"] != spec.PodSubnet {
+				t.Errorf("networking = %v", networking)
+			}
+			apiServer := cluster["apiServer"].(map[string]any)
+			if !reflect.DeepEqual(apiServer["extraArgs"], tt.wantArgs) {
+				t.Errorf("apiServer.extraArgs = %#v, want %#v", apiServer["extraArgs"], tt.wantArgs)
+			}
+			// 未指定参数的组件仅包含feature-gates
+			scheduler := cluster["scheduler"].(map[string]any)
+			if !reflect.DeepEqual(scheduler["extraArgs"], tt.wantGates) {
+				t.Errorf("scheduler.extraArgs = %#v, want %#v", scheduler["extraArgs"], tt.wantGates)
+			}
+
+			kubelet := documents["KubeletConfiguration"]
+			if kubelet["cgroupDriver"] != "systemd" {
+				t.Errorf("cgroupDriver = %v", kubelet["cgroupDriver"])
+			}
+			proxy := documents["KubeProxyConfiguration"]
+			if proxy["mode"] != "ipvs" || proxy["clusterCIDR"] != spec.PodSubnet {
+				t.Errorf("KubeProxyConfiguration = %v", proxy)
+			}
+		})
+	}
+}
+
+func TestClusterSpecRenderWithoutExtraArgs(t *testing.T) {
+	documents := renderDocuments(t, testClusterSpec("1.31.0"))
+	init := documents["InitConfiguration"]["nodeRegistration"]
+	if _, ok := init.(map[string]any)["kubeletExtraArgs"]; ok {
+		t.Errorf("nodeRegistration = %v, want no kubeletExtraArgs", init)
+	}
+	if _, ok := documents["ClusterConfiguration"]["controlPlaneEndpoint"]; ok {
+		t.Error("controlPlaneEndpoint should be omitted")
+	}
+}
@@ -1,6 +1,11 @@
 package kubernetes
 
-import "github.com/spf13/cobra"
+import (
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/preflight"
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/spf13/cobra"
+)
 
 // Cmd k8s配置命令
 var Cmd = &cobra.Command{
@@ -13,10 +18,27 @@ var Cmd = &cobra.Command{
 }
 
 func InitKubernetesCmd() {
-	loadImageCmd.Flags().BoolVarP(&containerWithDocker, "with-docker", "", false, "使用Docker，默认为containerd")
+	system.Require(loadImageCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(installKubernetesCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(initKubernetesClusterCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(joinKubernetesNodeCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(saveImagesCmd, system.RequireLinux, system.RequireRoot)
+	system.Require(setupHACmd, system.RequireLinux, system.RequireRoot)
+	system.Require(joinClusterCmd, system.RequireLinux, system.RequireRoot)
 	installKubernetesCmd.Flags().BoolVarP(&containerWithDocker, "with-docker", "", false, "使用Docker，默认为containerd")
-	installKubernetesCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", "v1.27.6", "指定Kubernetes版本")
-	initKubernetesClusterCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", "v1.27.6", "指定Kubernetes版本")
-	joinKubernetesNodeCmd.Flags().BoolVarP(&joinMasterNode, "control-plane", "", false, "加入控制面节点")
-	Cmd.AddCommand(loadImageCmd, installKubernetesCmd, initKubernetesClusterCmd, joinKubernetesNodeCmd)
+	initKubernetesClusterCmd.Flags().BoolVarP(&containerWithDocker, "with-docker", "", false, "使用Docker(cri-dockerd)，默认为containerd")
+	installKubernetesCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", compat.DefaultKubernetesVersion, "指定Kubernetes版本")
+	initKubernetesClusterCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", compat.DefaultKubernetesVersion, "指定Kubernetes版本")
+	preflight.AddFlags(installKubernetesCmd, &skipPreflight)
+	preflight.AddFlags(initKubernetesClusterCmd, &skipPreflight)
+	addAdvertiseFlags(initKubernetesClusterCmd)
+	initClusterFlags()
+	initLoadImageCmd()
+	initSaveImagesCmd()
+	initVersionsCmd()
+	initAddonCmd()
+	initSetupHACmd()
+	initJoinNodeCmd()
+	initJoinClusterCmd()
+	Cmd.AddCommand(loadImageCmd, saveImagesCmd, versionsCmd, addonCmd, installKubernetesCmd, initKubernetesClusterCmd, joinKubernetesNodeCmd, joinClusterCmd, setupHACmd)
 }
@@ -0,0 +1,136 @@
+package kubernetes
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+)
+
+var (
+	versionsOutput string
+	versionsCheck  bool
+)
+
+// versionsCmd 版本兼容矩阵
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "查看版本兼容矩阵",
+	Long:  "查看各Kubernetes版本对应的pause、etcd、coredns版本(etcd与coredns为各次版本最新补丁版本内置的版本)与支持的containerd、calico版本，--check检查本机组件是否兼容--with-version指定的版本",
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		if versionsCheck {
+			err = checkVersions(withKubernetesVersion)
+		} else {
+			err = printVersions(versionsOutput)
+		}
+		if err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+func initVersionsCmd() {
+	versionsCmd.Flags().StringVarP(&versionsOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	versionsCmd.Flags().BoolVarP(&versionsCheck, "check", "", false, "检查本机containerd、sandbox镜像与Calico资源清单")
+	versionsCmd.Flags().StringVarP(&withKubernetesVersion, "with-version", "", compat.DefaultKubernetesVersion, "指定Kubernetes版本")
+}
+
+// printVersions 输出版本兼容矩阵
+func printVersions(format string) error {
+	releases := compat.Releases()
+	if format != pkg.OutputTable {
+		return pkg.PrintStructured(os.Stdout, format, releases)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KUBERNETES\tPAUSE\tETCD\tCOREDNS\tCONTAINERD\tCALICO")
+	for _, r := range releases {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Kubernetes, r.Pause, r.Etcd, r.CoreDNS, r.Containerd, r.Calico)
+	}
+	return w.Flush()
+}
+
+// checkVersions 检查本机组件与Kubernetes版本的兼容性
+func checkVersions(k8sVersion string) error {
+	release, err := compat.Lookup(k8sVersion)
+	if err != nil {
+		return err
+	}
+	pauseImage, _ := container.PauseImage(k8sVersion)
+
+	var failed bool
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "COMPONENT\tEXPECTED\tACTUAL\tSTATUS\n")
+	row := func(component, expected, actual string, ok bool) {
+		status := "ok"
+		switch {
+		case actual == "-":
+			status = "missing"
+			failed = true
+		case !ok:
+			status = "mismatch"
+			failed = true
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", component, expected, actual, status)
+	}
+
+	containerdVersion, err := container.ContainerdVersion()
+	if err != nil {
+		containerdVersion = "-"
+	}
+	row("containerd", release.Containerd.String(), containerdVersion, release.Containerd.Contains(containerdVersion))
+
+	sandboxImage, err := container.SandboxImage()
+	if err != nil {
+		sandboxImage = "-"
+	}
+	row("sandbox_image", pauseImage, sandboxImage, sandboxImage == pauseImage)
+
+	calicoVersion, err := manifestCalicoVersion()
+	if err != nil {
+		calicoVersion = "-"
+	}
+	row("calico", release.Calico.String(), calicoVersion, release.Calico.Contains(calicoVersion))
+
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if failed {
+		return fmt.Errorf("本机组件与Kubernetes %s不兼容", release.Kubernetes)
+	}
+	return nil
+}
+
+// manifestCalicoVersion Calico资源清单中calico/node镜像的版本
+func manifestCalicoVersion() (string, error) {
+	refs, err := manifestImages(manifests.Calico)
+	if err != nil {
+		return "", err
+	}
+	for _, ref := range refs {
+		i := strings.LastIndex(ref, ":")
+		if i > 0 && strings.HasSuffix(ref[:i], "calico/node") {
+			return ref[i+1:], nil
+		}
+	}
+	return "", fmt.Errorf("%s资源清单中未找到calico/node镜像", manifests.Calico)
+}
+
+// checkCalicoVersion 检查Calico资源清单版本是否在Kubernetes版本支持范围内
+func checkCalicoVersion(release compat.Release) error {
+	version, err := manifestCalicoVersion()
+	if err != nil {
+		return err
+	}
+	if !release.Calico.Contains(version) {
+		return fmt.Errorf("Calico %s不在Kubernetes %s支持的范围%s内", version, release.Kubernetes, release.Calico)
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+package manifests
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed files/*.yaml
+var files embed.FS
+
+// 内置资源清单名称
+const (
+	Calico        = "calico"
+	Flannel       = "flannel"
+	MetricsServer = "metrics-server"
+	IngressNginx  = "ingress-nginx"
+	LocalPath     = "local-path-provisioner"
+	MetalLB       = "metallb"
+	Dashboard     = "dashboard"
+	KubeVIP       = "kube-vip"
+)
+
+// Manifest 内置资源清单
+type Manifest struct {
+	Name     string `json:"name" yaml:"name"`
+	File     string `json:"file" yaml:"file"`
+	Version  string `json:"version" yaml:"version"`
+	Source   string `json:"source" yaml:"source"`     // 上游地址
+	Template bool   `json:"template" yaml:"template"` // 是否为text/template模板，安装前需渲染
+	Embedded bool   `json:"embedded" yaml:"embedded"` // 是否内置，未内置的资源清单使用时从上游下载
+}
+
+// manifests 内置资源清单及其上游版本
+var manifests = map[string]Manifest{
+	Calico: {
+		Name:     Calico,
+		File:     "calico.yaml",
+		Version:  "v3.27.0",
+		Source:   "https://raw.githubusercontent.com/projectcalico/calico/v3.27.0/manifests/calico.yaml",
+		Template: true,
+		Embedded: true,
+	},
+	Flannel: {
+		Name:     Flannel,
+		File:     "flannel.yaml",
+		Version:  "v0.25.6",
+		Source:   "https://github.com/flannel-io/flannel/releases/download/v0.25.6/kube-flannel.yml",
+		Template: true,
+		Embedded: true,
+	},
+	MetricsServer: {
+		Name:     MetricsServer,
+		File:     "metrics-server.yaml",
+		Version:  "v0.6.1",
+		Source:   "https://github.com/kubernetes-sigs/metrics-server/releases/download/v0.6.1/components.yaml",
+		Embedded: true,
+	},
+	KubeVIP: {
+		Name:     KubeVIP,
+		File:     "kube-vip.yaml",
+		Version:  "v0.8.3",
+		Source:   "https://kube-vip.io/docs/installation/static/",
+		Template: true,
+		Embedded: true,
+	},
+	IngressNginx: {
+		Name:    IngressNginx,
+		File:    "ingress-nginx.yaml",
+		Version: "v1.11.2",
+		Source:  "https://raw.githubusercontent.com/kubernetes/ingress-nginx/controller-v1.11.2/deploy/static/provider/baremetal/deploy.yaml",
+	},
+	LocalPath: {
+		Name:    LocalPath,
+		File:    "local-path-provisioner.yaml",
+		Version: "v0.0.30",
+		Source:  "https://raw.githubusercontent.com/rancher/local-path-provisioner/v0.0.30/deploy/local-path-storage.yaml",
+	},
+	MetalLB: {
+		Name:    MetalLB,
+		File:    "metallb.yaml",
+		Version: "v0.14.8",
+		Source:  "https://raw.githubusercontent.com/metallb/metallb/v0.14.8/config/manifests/metallb-native.yaml",
+	},
+	Dashboard: {
+		Name:    Dashboard,
+		File:    "dashboard.yaml",
+		Version: "v2.7.0",
+		Source:  "https://raw.githubusercontent.com/kubernetes/dashboard/v2.7.0/aio/deploy/recommended.yaml",
+	},
+}
+
+// overrideDir 资源清单覆盖目录，其中的同名文件优先于内置资源清单
+var overrideDir string
+
+// SetOverrideDir 设置资源清单覆盖目录
+func SetOverrideDir(dir string) {
+	overrideDir = dir
+}
+
+// List 全部内置资源清单
+func List() []Manifest {
+	list := make([]Manifest, 0, len(manifests))
+	for _, m := range manifests {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Names 全部内置资源清单名称
+func Names() []string {
+	var names []string
+	for _, m := range List() {
+		names = append(names, m.Name)
+	}
+	return names
+}
+
+// Get 获取资源清单信息
+func Get(name string) (Manifest, error) {
+	m, ok := manifests[name]
+	if !ok {
+		return Manifest{}, fmt.Errorf("资源清单%s不存在", name)
+	}
+	return m, nil
+}
+
+// Read 读取资源清单内容，覆盖目录中存在同名文件时使用覆盖文件，
+// 未内置的资源清单从上游下载，离线环境可先export后通过覆盖目录使用
+func Read(name string) ([]byte, error) {
+	m, err := Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if path := Overridden(m); path != "" {
+		return os.ReadFile(path)
+	}
+	if !m.Embedded {
+		data, err := pkg.Download(mirror.Current().GitHubURL(m.Source))
+		if err != nil {
+			return nil, fmt.Errorf("%w\n资源清单%s未内置，离线环境请在可访问上游的机器执行devops manifests export %s --dir <目录>，"+
+				"将目录复制到本机后通过--manifest-dir <目录>指定", err, m.Name, m.Name)
+		}
+		return data, nil
+	}
+	return files.ReadFile("files/" + m.File)
+}
+
+// Overridden 覆盖目录中的资源清单文件，不存在时返回空
+func Overridden(m Manifest) string {
+	if overrideDir == "" {
+		return ""
+	}
+	path := filepath.Join(overrideDir, m.File)
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return ""
+	}
+	return path
+}
+
+// metadataFile 导出目录中的版本信息文件
+const metadataFile = "manifests.meta.yaml"
+
+// Export 导出资源清单与版本信息到dir，names为空时导出全部
+func Export(dir string, names ...string) error {
+	if len(names) == 0 {
+		names = Names()
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if err = pkg.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	var exported []Manifest
+	for _, name := range names {
+		m, err := Get(name)
+		if err != nil {
+			return err
+		}
+		data, err := Read(name)
+		if err != nil {
+			return err
+		}
+		if err = pkg.WriteFile(filepath.Join(dir, m.File), data, 0644); err != nil {
+			return err
+		}
+		exported = append(exported, m)
+	}
+	data, err := yaml.Marshal(exported)
+	if err != nil {
+		return err
+	}
+	return pkg.WriteFile(filepath.Join(dir, metadataFile), data, 0644)
+}
+
+// Cmd 资源清单命令
+var Cmd = &cobra.Command{
+	Use:   "manifests",
+	Short: "内置资源清单",
+	Long:  "查看与导出内置的Kubernetes资源清单，可通过--manifest-dir指定覆盖目录",
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var (
+	listOutput     string
+	exportDir      string
+	rewriteMaps    []string
+	rewriteFlatten bool
+	rewriteMirror  bool
+	rewriteWrite   bool
+)
+
+// listCmd 查看资源清单
+var listCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "查看内置资源清单及版本",
+	Long:  "查看内置资源清单及版本",
+	Run: func(cmd *cobra.Command, args []string) {
+		list := List()
+		if listOutput != pkg.OutputTable {
+			if err := pkg.PrintStructured(os.Stdout, listOutput, list); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tVERSION\tEMBEDDED\tTEMPLATE\tOVERRIDE\tSOURCE")
+		for _, m := range list {
+			override := Overridden(m)
+			if override == "" {
+				override = "-"
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%s\t%s\n", m.Name, m.Version, m.Embedded, m.Template, override, m.Source)
+		}
+		_ = w.Flush()
+	},
+}
+
+// exportCmd 导出资源清单
+var exportCmd = &cobra.Command{
+	Use:   "export [name...]",
+	Short: "导出内置资源清单",
+	Long:  "导出资源清单与版本信息，未内置的资源清单从上游下载，修改后可通过--manifest-dir使用，模板中的{{ }}占位符在安装时渲染",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := Export(exportDir, args...); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// rewriteImagesCmd 替换资源清单中的镜像
+var rewriteImagesCmd = &cobra.Command{
+	Use:   "rewrite-images [file...]",
+	Short: "替换资源清单中的镜像仓库",
+	Long: "替换Deployment、DaemonSet、StatefulSet、Job、CronJob等工作负载中containers与initContainers的镜像，" +
+		"默认使用当前镜像源的替换规则，--map指定的规则优先，未指定文件或文件为-时读取标准输入，替换记录输出到标准错误",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := rewriteImages(args); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+	},
+}
+
+// rewriteRules 命令行指定的替换规则与镜像源规则
+func rewriteRules() ([]mirror.ImageRewrite, error) {
+	var rules []mirror.ImageRewrite
+	for _, value := range rewriteMaps {
+		rule, err := mirror.ParseImageRewrite(value)
+		if err != nil {
+			return nil, err
+		}
+		rule.Flatten = rewriteFlatten
+		rules = append(rules, rule)
+	}
+	if rewriteMirror {
+		rules = append(rules, mirror.Current().ImageRules()...)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("没有可用的替换规则，请通过--map指定")
+	}
+	return rules, nil
+}
+
+// rewriteImages 替换文件或标准输入中的镜像，--write时写回文件，否则输出到标准输出
+func rewriteImages(files []string) error {
+	rules, err := rewriteRules()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	rewrite := func(ref string) string {
+		return mirror.RewriteImage(ref, rules)
+	}
+	for _, file := range files {
+		var data []byte
+		var path string
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else if path, err = filepath.Abs(file); err == nil {
+			// 与写回使用同一文件系统，--root时读写的是同一文件
+			data, err = pkg.ReadFile(path)
+		}
+		if err != nil {
+			return err
+		}
+		data, changes, err := RewriteImages(data, rewrite)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		for _, change := range changes {
+			_, _ = fmt.Fprintf(os.Stderr, "%s: %s/%s %s: %s -> %s\n", file, change.Kind, change.Name, change.Container, change.From, change.To)
+		}
+		if rewriteWrite && file != "-" {
+			if len(changes) > 0 {
+				mode := os.FileMode(0644)
+				if info, err := pkg.HostFS().Stat(path); err == nil {
+					mode = info.Mode().Perm()
+				}
+				if err = pkg.WriteFile(path, data, mode); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if _, err = os.Stdout.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func InitManifestsCmd() {
+	listCmd.Flags().StringVarP(&listOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	exportCmd.Flags().StringVarP(&exportDir, "dir", "", "./manifests", "导出目录")
+	rewriteImagesCmd.Flags().StringArrayVarP(&rewriteMaps, "map", "", nil, "替换规则from=to，可指定多次，如k8s.gcr.io=registry.aliyuncs.com/google_containers")
+	rewriteImagesCmd.Flags().BoolVarP(&rewriteFlatten, "flatten", "", false, "--map的目标仓库为扁平结构，仅保留镜像名称的最后一级")
+	rewriteImagesCmd.Flags().BoolVarP(&rewriteMirror, "mirror-rules", "", true, "同时使用当前镜像源的替换规则")
+	rewriteImagesCmd.Flags().BoolVarP(&rewriteWrite, "write", "w", false, "将结果写回文件")
+	Cmd.AddCommand(listCmd, exportCmd, rewriteImagesCmd)
+}
@@ -0,0 +1,174 @@
+package manifests
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// podSpecPaths 各工作负载类型中Pod模板的路径
+var podSpecPaths = map[string][]string{
+	"Pod":         {"spec"},
+	"Deployment":  {"spec", "template", "spec"},
+	"DaemonSet":   {"spec", "template", "spec"},
+	"StatefulSet": {"spec", "template", "spec"},
+	"ReplicaSet":  {"spec", "template", "spec"},
+	"Job":         {"spec", "template", "spec"},
+	"CronJob":     {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// ContainerImage 工作负载中容器引用的镜像
+type ContainerImage struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Container string `json:"container" yaml:"container"`
+	Image     string `json:"image" yaml:"image"`
+
+	node *yaml.Node
+}
+
+// ImageChange 镜像替换记录
+type ImageChange struct {
+	Kind      string `json:"kind" yaml:"kind"`
+	Name      string `json:"name" yaml:"name"`
+	Container string `json:"container" yaml:"container"`
+	From      string `json:"from" yaml:"from"`
+	To        string `json:"to" yaml:"to"`
+}
+
+// Images 解析多文档YAML，返回Deployment、DaemonSet、StatefulSet、Job、CronJob等工作负载中
+// containers与initContainers引用的镜像
+func Images(data []byte) ([]ContainerImage, error) {
+	var images []ContainerImage
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc yaml.Node
+		if err := decoder.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("资源清单解析失败: %w", err)
+		}
+		if len(doc.Content) > 0 {
+			images = append(images, objectImages(doc.Content[0])...)
+		}
+	}
+	return images, nil
+}
+
+// objectImages 单个资源中的镜像，List类型递归处理items
+func objectImages(object *yaml.Node) []ContainerImage {
+	kind := scalar(lookup(object, "kind"))
+	if strings.HasSuffix(kind, "List") {
+		var images []ContainerImage
+		if items := lookup(object, "items"); items != nil {
+			for _, item := range items.Content {
+				images = append(images, objectImages(item)...)
+			}
+		}
+		return images
+	}
+	path, ok := podSpecPaths[kind]
+	if !ok {
+		return nil
+	}
+	name := scalar(lookup(object, "metadata", "name"))
+	podSpec := lookup(object, path...)
+	var images []ContainerImage
+	for _, field := range []string{"initContainers", "containers"} {
+		containers := lookup(podSpec, field)
+		if containers == nil || containers.Kind != yaml.SequenceNode {
+			continue
+		}
+		for _, c := range containers.Content {
+			image := lookup(c, "image")
+			if image == nil || image.Kind != yaml.ScalarNode {
+				continue
+			}
+			images = append(images, ContainerImage{
+				Kind:      kind,
+				Name:      name,
+				Container: scalar(lookup(c, "name")),
+				Image:     image.Value,
+				node:      image,
+			})
+		}
+	}
+	return images
+}
+
+// RewriteImages 替换工作负载中的镜像，仅修改镜像所在位置，保留原有格式与注释
+func RewriteImages(data []byte, rewrite func(ref string) string) ([]byte, []ImageChange, error) {
+	images, err := Images(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+	var changes []ImageChange
+	for _, image := range images {
+		to := rewrite(image.Image)
+		if to == image.Image {
+			continue
+		}
+		if err = replaceAt(lines, image.node, to); err != nil {
+			return nil, nil, fmt.Errorf("%s/%s容器%s: %w", image.Kind, image.Name, image.Container, err)
+		}
+		changes = append(changes, ImageChange{
+			Kind:      image.Kind,
+			Name:      image.Name,
+			Container: image.Container,
+			From:      image.Image,
+			To:        to,
+		})
+	}
+	return []byte(strings.Join(lines, "")), changes, nil
+}
+
+// replaceAt 替换节点所在行中的标量值
+func replaceAt(lines []string, node *yaml.Node, value string) error {
+	if node.Line < 1 || node.Line > len(lines) {
+		return fmt.Errorf("镜像%s的位置无效", node.Value)
+	}
+	line := []rune(lines[node.Line-1])
+	column := node.Column - 1
+	if column < 0 || column > len(line) {
+		return fmt.Errorf("镜像%s的位置无效", node.Value)
+	}
+	head, tail := string(line[:column]), string(line[column:])
+	i := strings.Index(tail, node.Value)
+	if i < 0 || strings.TrimLeft(tail[:i], `"'`) != "" {
+		// 多行或含转义的标量无法原位替换
+		return fmt.Errorf("镜像%s不是单行标量，无法替换", node.Value)
+	}
+	lines[node.Line-1] = head + tail[:i] + value + tail[i+len(node.Value):]
+	return nil
+}
+
+// lookup 按键路径查找映射节点中的值
+func lookup(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	return node
+}
+
+// scalar 标量节点的值
+func scalar(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
@@ -0,0 +1,116 @@
+package manifests
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
+)
+
+const workloads = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: "busybox:1.36" # 初始化
+      containers:
+      - {name: app, image: 'registry.k8s.io/coredns/coredns:v1.11.1'}
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: helper
+data:
+  pod.yaml: |
+    image: busybox
+---
+apiVersion: v1
+kind: List
+items:
+- apiVersion: batch/v1
+  kind: CronJob
+  metadata:
+    name: backup
+  spec:
+    jobTemplate:
+      spec:
+        template:
+          spec:
+            containers:
+            - name: backup
+              image: quay.io/example/backup:v2
+`
+
+func TestImages(t *testing.T) {
+	images, err := Images([]byte(workloads))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []ContainerImage
+	for _, image := range images {
+		image.node = nil
+		got = append(got, image)
+	}
+	want := []ContainerImage{
+		{Kind: "Deployment", Name: "web", Container: "init", Image: "busybox:1.36"},
+		{Kind: "Deployment", Name: "web", Container: "app", Image: "registry.k8s.io/coredns/coredns:v1.11.1"},
+		{Kind: "CronJob", Name: "backup", Container: "backup", Image: "quay.io/example/backup:v2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Images() = %+v, want %+v", got, want)
+	}
+
+	if _, err = Images([]byte("kind: [")); err == nil {
+		t.Error("Images() with invalid YAML should fail")
+	}
+}
+
+func TestRewriteImages(t *testing.T) {
+	rules := []mirror.ImageRewrite{
+		{From: "docker.io", To: "hub.example.com"},
+		{From: "registry.k8s.io", To: "r.example.com/k8s", Flatten: true},
+	}
+	out, changes, err := RewriteImages([]byte(workloads), func(ref string) string {
+		return mirror.RewriteImage(ref, rules)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 仅替换工作负载中的镜像，保留引号、注释与流式写法，ConfigMap中的内容不变
+	want := strings.NewReplacer(
+		`image: "busybox:1.36" # 初始化`, `image: "hub.example.com/library/busybox:1.36" # 初始化`,
+		`image: 'registry.k8s.io/coredns/coredns:v1.11.1'}`, `image: 'r.example.com/k8s/coredns:v1.11.1'}`,
+	).Replace(workloads)
+	if string(out) != want {
+		t.Errorf("RewriteImages() =\n%s\nwant\n%s", out, want)
+	}
+	wantChanges := []ImageChange{
+		{Kind: "Deployment", Name: "web", Container: "init", From: "busybox:1.36", To: "hub.example.com/library/busybox:1.36"},
+		{Kind: "Deployment", Name: "web", Container: "app", From: "registry.k8s.io/coredns/coredns:v1.11.1", To: "r.example.com/k8s/coredns:v1.11.1"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("changes = %+v, want %+v", changes, wantChanges)
+	}
+}
+
+func TestRewriteImagesMultiline(t *testing.T) {
+	data := `kind: Pod
+metadata:
+  name: p
+spec:
+  containers:
+  - name: c
+    image: >-
+      busybox
+`
+	_, _, err := RewriteImages([]byte(data), func(string) string { return "hub.example.com/library/busybox" })
+	if err == nil {
+		t.Error("RewriteImages() with folded scalar should fail")
+	}
+}
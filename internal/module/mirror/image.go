@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ImageRewrite 镜像仓库替换规则，From为仓库地址前缀，如k8s.gcr.io或registry.k8s.io/ingress-nginx/controller
+type ImageRewrite struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+	// Flatten 目标仓库为扁平结构时仅保留最后一级名称，如coredns/coredns -> coredns
+	Flatten bool `yaml:"flatten"`
+}
+
+func (r ImageRewrite) String() string {
+	if r.Flatten {
+		return r.From + "=" + r.To + " (flatten)"
+	}
+	return r.From + "=" + r.To
+}
+
+// ParseImageRewrite 解析from=to格式的替换规则
+func ParseImageRewrite(value string) (ImageRewrite, error) {
+	from, to, ok := strings.Cut(value, "=")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return ImageRewrite{}, fmt.Errorf("替换规则%s无效，格式为from=to，如k8s.gcr.io=registry.aliyuncs.com/google_containers", value)
+	}
+	return ImageRewrite{From: from, To: to}, nil
+}
+
+// ImageRules 镜像源的全部替换规则：配置的规则、docker.io替换为DockerHub，
+// registry.k8s.io与k8s.gcr.io替换为ImageRepository
+func (p Profile) ImageRules() []ImageRewrite {
+	rules := append([]ImageRewrite(nil), p.ImageRewrites...)
+	if p.DockerHub != "" && p.DockerHub != "docker.io" {
+		rules = append(rules, ImageRewrite{From: "docker.io", To: p.DockerHub})
+	}
+	switch p.ImageRepository {
+	case "":
+	case "registry.k8s.io":
+		// k8s.gcr.io已停止更新，迁移到registry.k8s.io并保留路径
+		rules = append(rules, ImageRewrite{From: "k8s.gcr.io", To: p.ImageRepository})
+	default:
+		rules = append(rules,
+			ImageRewrite{From: "registry.k8s.io", To: p.ImageRepository, Flatten: true},
+			ImageRewrite{From: "k8s.gcr.io", To: p.ImageRepository, Flatten: true},
+		)
+	}
+	return rules
+}
+
+// RewriteImage 按当前镜像源的替换规则替换镜像地址
+func (p Profile) RewriteImage(ref string) string {
+	return RewriteImage(ref, p.ImageRules())
+}
+
+// RewriteImage 按规则替换镜像地址，多条规则匹配时使用最长的From，未匹配时原样返回。
+// 镜像源中的摘要可能与上游不一致，替换后存在标签时去除摘要
+func RewriteImage(ref string, rules []ImageRewrite) string {
+	repo, tag, digest := splitImage(ref)
+	name := normalizeRepository(repo)
+
+	var matched *ImageRewrite
+	for i, rule := range rules {
+		from := normalizeRegistry(strings.TrimSuffix(rule.From, "/"))
+		if (name == from || strings.HasPrefix(name, from+"/")) &&
+			(matched == nil || len(from) > len(normalizeRegistry(strings.TrimSuffix(matched.From, "/")))) {
+			matched = &rules[i]
+		}
+	}
+	if matched == nil {
+		return ref
+	}
+
+	from := normalizeRegistry(strings.TrimSuffix(matched.From, "/"))
+	remainder := strings.TrimPrefix(strings.TrimPrefix(name, from), "/")
+	if matched.Flatten && remainder != "" {
+		remainder = remainder[strings.LastIndex(remainder, "/")+1:]
+	}
+	target := strings.TrimSuffix(matched.To, "/")
+	if remainder != "" {
+		target += "/" + remainder
+	}
+	if target == name {
+		return ref
+	}
+	if tag != "" {
+		return target + ":" + tag
+	}
+	if digest != "" {
+		return target + "@" + digest
+	}
+	return target
+}
+
+// splitImage 拆分镜像地址为仓库、标签与摘要
+func splitImage(ref string) (repo, tag, digest string) {
+	repo, digest, _ = strings.Cut(ref, "@")
+	if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+		repo, tag = repo[:i], repo[i+1:]
+	}
+	return repo, tag, digest
+}
+
+// normalizeRepository 补全仓库地址，如calico/node补全为docker.io/calico/node，busybox补全为docker.io/library/busybox
+func normalizeRepository(repo string) string {
+	domain, remainder := "docker.io", repo
+	if i := strings.Index(repo, "/"); i > 0 && (strings.ContainsAny(repo[:i], ".:") || repo[:i] == "localhost") {
+		domain, remainder = repo[:i], repo[i+1:]
+	}
+	domain = normalizeRegistry(domain)
+	if domain == "docker.io" && !strings.Contains(remainder, "/") {
+		remainder = "library/" + remainder
+	}
+	return domain + "/" + remainder
+}
+
+// normalizeRegistry 统一Docker Hub的多个地址
+func normalizeRegistry(name string) string {
+	for _, alias := range []string{"index.docker.io", "registry-1.docker.io"} {
+		if name == alias || strings.HasPrefix(name, alias+"/") {
+			return "docker.io" + strings.TrimPrefix(name, alias)
+		}
+	}
+	return name
+}
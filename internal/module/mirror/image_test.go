@@ -0,0 +1,110 @@
+package mirror
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRewriteImage(t *testing.T) {
+	aliyun := profiles[Aliyun].ImageRules()
+	official := profiles[Official].ImageRules()
+	tests := []struct {
+		name  string
+		ref   string
+		rules []ImageRewrite
+		want  string
+	}{
+		{name: "registry.k8s.io扁平化", ref: "registry.k8s.io/coredns/coredns:v1.11.1", rules: aliyun, want: "registry.aliyuncs.com/google_containers/coredns:v1.11.1"},
+		{name: "k8s.gcr.io扁平化", ref: "k8s.gcr.io/metrics-server/metrics-server:v0.6.1", rules: aliyun, want: "registry.aliyuncs.com/google_containers/metrics-server:v0.6.1"},
+		{name: "官方源迁移k8s.gcr.io并保留路径", ref: "k8s.gcr.io/metrics-server/metrics-server:v0.6.1", rules: official, want: "registry.k8s.io/metrics-server/metrics-server:v0.6.1"},
+		{name: "官方源不修改registry.k8s.io", ref: "registry.k8s.io/pause:3.9", rules: official, want: "registry.k8s.io/pause:3.9"},
+		{name: "DockerHub为docker.io时不修改", ref: "calico/node:v3.27.0", rules: aliyun, want: "calico/node:v3.27.0"},
+		{
+			name:  "Docker Hub短名称补全library",
+			ref:   "busybox",
+			rules: []ImageRewrite{{From: "docker.io", To: "hub.example.com"}},
+			want:  "hub.example.com/library/busybox",
+		},
+		{
+			name:  "index.docker.io视为docker.io",
+			ref:   "index.docker.io/calico/node:v3.27.0",
+			rules: []ImageRewrite{{From: "docker.io", To: "hub.example.com/"}},
+			want:  "hub.example.com/calico/node:v3.27.0",
+		},
+		{
+			name: "最长前缀优先",
+			ref:  "registry.k8s.io/ingress-nginx/controller:v1.11.2@sha256:abc",
+			rules: []ImageRewrite{
+				{From: "registry.k8s.io", To: "r.example.com", Flatten: true},
+				{From: "registry.k8s.io/ingress-nginx/controller", To: "r.example.com/nginx-ingress-controller"},
+			},
+			want: "r.example.com/nginx-ingress-controller:v1.11.2",
+		},
+		{
+			name:  "仅有摘要时保留摘要",
+			ref:   "quay.io/metallb/speaker@sha256:abc",
+			rules: []ImageRewrite{{From: "quay.io", To: "q.example.com"}},
+			want:  "q.example.com/metallb/speaker@sha256:abc",
+		},
+		{
+			name:  "带端口的私有仓库",
+			ref:   "localhost:5000/app:v1",
+			rules: []ImageRewrite{{From: "docker.io", To: "hub.example.com"}},
+			want:  "localhost:5000/app:v1",
+		},
+		{
+			name:  "前缀需匹配完整路径段",
+			ref:   "quay.io/metallb-extra/speaker:v1",
+			rules: []ImageRewrite{{From: "quay.io/metallb", To: "q.example.com"}},
+			want:  "quay.io/metallb-extra/speaker:v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RewriteImage(tt.ref, tt.rules); got != tt.want {
+				t.Errorf("RewriteImage(%s) = %s, want %s", tt.ref, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageRules(t *testing.T) {
+	profile := Profile{
+		ImageRepository: "r.example.com/k8s",
+		DockerHub:       "hub.example.com",
+		ImageRewrites:   []ImageRewrite{{From: "quay.io", To: "q.example.com"}},
+	}
+	want := []ImageRewrite{
+		{From: "quay.io", To: "q.example.com"},
+		{From: "docker.io", To: "hub.example.com"},
+		{From: "registry.k8s.io", To: "r.example.com/k8s", Flatten: true},
+		{From: "k8s.gcr.io", To: "r.example.com/k8s", Flatten: true},
+	}
+	if got := profile.ImageRules(); !reflect.DeepEqual(got, want) {
+		t.Errorf("ImageRules() = %v, want %v", got, want)
+	}
+}
+
+func TestParseImageRewrite(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ImageRewrite
+		wantErr bool
+	}{
+		{value: "k8s.gcr.io=registry.aliyuncs.com/google_containers", want: ImageRewrite{From: "k8s.gcr.io", To: "registry.aliyuncs.com/google_containers"}},
+		{value: " quay.io = q.example.com ", want: ImageRewrite{From: "quay.io", To: "q.example.com"}},
+		{value: "quay.io", wantErr: true},
+		{value: "=q.example.com", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseImageRewrite(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseImageRewrite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseImageRewrite() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
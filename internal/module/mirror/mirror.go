@@ -0,0 +1,338 @@
+package mirror
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"gopkg.in/yaml.v3"
+)
+
+// 镜像源名称
+const (
+	Aliyun   = "aliyun"
+	Tsinghua = "tsinghua"
+	USTC     = "ustc"
+	Huawei   = "huawei"
+	Official = "official"
+	Custom   = "custom"
+)
+
+// Profile 镜像源配置，所有软件仓库、镜像仓库与下载地址都从这里解析
+type Profile struct {
+	Name string `yaml:"name"`
+
+	CentOS      string `yaml:"centos"`       // CentOS软件源，如https://mirrors.aliyun.com/centos-vault/
+	Ubuntu      string `yaml:"ubuntu"`       // Ubuntu软件源(amd64)
+	UbuntuPorts string `yaml:"ubuntu_ports"` // Ubuntu软件源(arm64等)
+	Debian      string `yaml:"debian"`       // Debian软件源
+	ELRepo      string `yaml:"elrepo"`       // ELRepo内核源，不含el版本与架构
+	DockerCE    string `yaml:"docker_ce"`    // docker-ce软件源
+
+	// Kubernetes 旧版Kubernetes软件源(yum/repos、apt)，仅提供1.28及以下版本
+	Kubernetes string `yaml:"kubernetes"`
+	// KubernetesNew pkgs.k8s.io布局的Kubernetes软件源，不含版本号
+	KubernetesNew string `yaml:"kubernetes_new"`
+
+	ImageRepository string `yaml:"image_repository"` // Kubernetes组件镜像仓库，替代registry.k8s.io
+	DockerHub       string `yaml:"docker_hub"`       // Docker Hub镜像仓库，替代docker.io
+	GitHub          string `yaml:"github"`           // GitHub Release下载加速前缀，为空时直接下载
+
+	// ImageRewrites 镜像仓库替换规则，优先于由ImageRepository与DockerHub生成的默认规则
+	ImageRewrites []ImageRewrite `yaml:"image_rewrites"`
+}
+
+// profiles 内置镜像源
+var profiles = map[string]Profile{
+	Aliyun: {
+		Name:            Aliyun,
+		CentOS:          "https://mirrors.aliyun.com/centos-vault/",
+		Ubuntu:          "https://mirrors.aliyun.com/ubuntu/",
+		UbuntuPorts:     "https://mirrors.aliyun.com/ubuntu-ports/",
+		Debian:          "https://mirrors.aliyun.com/debian/",
+		ELRepo:          "https://mirrors.aliyun.com/elrepo/archive/kernel/",
+		DockerCE:        "https://mirrors.aliyun.com/docker-ce/",
+		Kubernetes:      "https://mirrors.aliyun.com/kubernetes/",
+		KubernetesNew:   "https://mirrors.aliyun.com/kubernetes-new/core/stable/",
+		ImageRepository: "registry.aliyuncs.com/google_containers",
+		DockerHub:       "docker.io",
+	},
+	Tsinghua: {
+		Name:            Tsinghua,
+		CentOS:          "https://mirrors.tuna.tsinghua.edu.cn/centos-vault/",
+		Ubuntu:          "https://mirrors.tuna.tsinghua.edu.cn/ubuntu/",
+		UbuntuPorts:     "https://mirrors.tuna.tsinghua.edu.cn/ubuntu-ports/",
+		Debian:          "https://mirrors.tuna.tsinghua.edu.cn/debian/",
+		ELRepo:          "https://mirrors.tuna.tsinghua.edu.cn/elrepo/kernel/",
+		DockerCE:        "https://mirrors.tuna.tsinghua.edu.cn/docker-ce/",
+		Kubernetes:      "https://mirrors.tuna.tsinghua.edu.cn/kubernetes/",
+		KubernetesNew:   "https://mirrors.tuna.tsinghua.edu.cn/kubernetes/core:/stable:/",
+		ImageRepository: "registry.aliyuncs.com/google_containers",
+		DockerHub:       "docker.io",
+	},
+	USTC: {
+		Name:            USTC,
+		CentOS:          "https://mirrors.ustc.edu.cn/centos-vault/",
+		Ubuntu:          "https://mirrors.ustc.edu.cn/ubuntu/",
+		UbuntuPorts:     "https://mirrors.ustc.edu.cn/ubuntu-ports/",
+		Debian:          "https://mirrors.ustc.edu.cn/debian/",
+		ELRepo:          "https://mirrors.ustc.edu.cn/elrepo/kernel/",
+		DockerCE:        "https://mirrors.ustc.edu.cn/docker-ce/",
+		Kubernetes:      "https://mirrors.ustc.edu.cn/kubernetes/",
+		KubernetesNew:   "https://mirrors.ustc.edu.cn/kubernetes/core:/stable:/",
+		ImageRepository: "registry.aliyuncs.com/google_containers",
+		DockerHub:       "docker.io",
+	},
+	// 华为云未提供pkgs.k8s.io布局的Kubernetes软件源，仅能安装1.28及以下版本
+	Huawei: {
+		Name:            Huawei,
+		CentOS:          "https://mirrors.huaweicloud.com/centos-vault/",
+		Ubuntu:          "https://mirrors.huaweicloud.com/ubuntu/",
+		UbuntuPorts:     "https://mirrors.huaweicloud.com/ubuntu-ports/",
+		Debian:          "https://mirrors.huaweicloud.com/debian/",
+		ELRepo:          "https://mirrors.huaweicloud.com/elrepo/kernel/",
+		DockerCE:        "https://mirrors.huaweicloud.com/docker-ce/",
+		Kubernetes:      "https://mirrors.huaweicloud.com/kubernetes/",
+		ImageRepository: "registry.aliyuncs.com/google_containers",
+		DockerHub:       "docker.io",
+	},
+	Official: {
+		Name:            Official,
+		CentOS:          "https://vault.centos.org/",
+		Ubuntu:          "http://archive.ubuntu.com/ubuntu/",
+		UbuntuPorts:     "http://ports.ubuntu.com/ubuntu-ports/",
+		Debian:          "https://deb.debian.org/debian/",
+		ELRepo:          "https://elrepo.org/linux/kernel/",
+		DockerCE:        "https://download.docker.com/",
+		KubernetesNew:   "https://pkgs.k8s.io/core:/stable:/",
+		ImageRepository: "registry.k8s.io",
+		DockerHub:       "docker.io",
+	},
+}
+
+var current = profiles[Aliyun]
+
+// Names 内置镜像源名称
+func Names() []string {
+	names := make([]string, 0, len(profiles)+1)
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, Custom)
+}
+
+// Usage 镜像源名称列表，注明仅提供旧版Kubernetes软件源的镜像源，用于参数说明
+func Usage() string {
+	names := Names()
+	for i, name := range names {
+		if p, ok := profiles[name]; ok && p.KubernetesNew == "" {
+			names[i] = fmt.Sprintf("%s(Kubernetes仅支持1.%d及以下)", name, legacyKubernetesMaxMinor)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// newRepoProfiles 提供pkgs.k8s.io布局Kubernetes软件源的内置镜像源
+func newRepoProfiles() []string {
+	var names []string
+	for _, name := range Names() {
+		if p, ok := profiles[name]; ok && p.KubernetesNew != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Get 按名称获取内置镜像源
+func Get(name string) (Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("未知的镜像源%s，可选: %s", name, strings.Join(Names(), "|"))
+	}
+	return profile, nil
+}
+
+// Setup 选择镜像源，configFile不为空时从配置文件加载并覆盖所选镜像源中的对应项
+func Setup(name, configFile string) error {
+	var profile Profile
+	if name != Custom {
+		p, err := Get(name)
+		if err != nil {
+			return err
+		}
+		profile = p
+	} else if configFile == "" {
+		return fmt.Errorf("使用%s镜像源时需要通过--mirror-config指定配置文件", Custom)
+	}
+
+	if configFile != "" {
+		data, err := os.ReadFile(configFile)
+		if err != nil {
+			return err
+		}
+		var override Profile
+		if err = yaml.Unmarshal(data, &override); err != nil {
+			return fmt.Errorf("镜像源配置文件%s解析失败: %w", configFile, err)
+		}
+		profile = profile.merge(override)
+		if override.Name == "" {
+			profile.Name = Custom
+		}
+	}
+
+	current = profile
+	return nil
+}
+
+// merge 以override中的非空项覆盖p
+func (p Profile) merge(override Profile) Profile {
+	set := func(dst *string, src string) {
+		if src != "" {
+			*dst = src
+		}
+	}
+	set(&p.Name, override.Name)
+	set(&p.CentOS, override.CentOS)
+	set(&p.Ubuntu, override.Ubuntu)
+	set(&p.UbuntuPorts, override.UbuntuPorts)
+	set(&p.Debian, override.Debian)
+	set(&p.ELRepo, override.ELRepo)
+	set(&p.DockerCE, override.DockerCE)
+	set(&p.Kubernetes, override.Kubernetes)
+	set(&p.KubernetesNew, override.KubernetesNew)
+	set(&p.ImageRepository, override.ImageRepository)
+	set(&p.DockerHub, override.DockerHub)
+	set(&p.GitHub, override.GitHub)
+	p.ImageRewrites = append(append([]ImageRewrite(nil), override.ImageRewrites...), p.ImageRewrites...)
+	return p
+}
+
+// Current 当前镜像源
+func Current() Profile {
+	return current
+}
+
+// join 拼接地址
+func join(base string, elem ...string) string {
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(elem, "/")
+}
+
+// UbuntuMirror Ubuntu软件源，arm64等架构使用ubuntu-ports
+func (p Profile) UbuntuMirror(arch string) string {
+	if arch != "amd64" && arch != "386" {
+		return p.UbuntuPorts
+	}
+	return p.Ubuntu
+}
+
+// centOSRelease CentOS 7已停止维护，各镜像站仅在vault中保留最终版本
+const centOSRelease = "7.9.2009"
+
+// CentOSRepo CentOS-Base.repo 内容
+func (p Profile) CentOSRepo() []byte {
+	var sections []string
+	for _, repo := range [][2]string{{"base", "os"}, {"updates", "updates"}, {"extras", "extras"}} {
+		sections = append(sections, fmt.Sprintf(`[%s]
+name=CentOS-%s - %s
+baseurl=%s
+gpgcheck=1
+gpgkey=%s
+`, repo[0], centOSRelease, repo[0], join(p.CentOS, centOSRelease, repo[1], "$basearch/"), join(p.CentOS, centOSRelease, "os", "$basearch", "RPM-GPG-KEY-CentOS-7")))
+	}
+	return []byte(strings.Join(sections, "\n"))
+}
+
+// ELRepoKernel ELRepo内核源地址
+func (p Profile) ELRepoKernel(elVersion int, arch string) string {
+	return join(p.ELRepo, fmt.Sprintf("el%d", elVersion), arch)
+}
+
+// DockerCERepo docker-ce rpm源地址与签名公钥
+func (p Profile) DockerCERepo(elVersion int) (baseURL, gpgKey string) {
+	return join(p.DockerCE, "linux", "centos", strconv.Itoa(elVersion), "$basearch", "stable"),
+		join(p.DockerCE, "linux", "centos", "gpg")
+}
+
+// DockerCEApt docker-ce apt源地址与签名公钥，distro为ubuntu或debian
+func (p Profile) DockerCEApt(distro string) (uri, gpgKey string) {
+	return join(p.DockerCE, "linux", distro), join(p.DockerCE, "linux", distro, "gpg")
+}
+
+// minorVersion Kubernetes次版本号，如v1.27.6返回27
+func minorVersion(version string) int {
+	parts := strings.Split(strings.TrimPrefix(version, "v"), ".")
+	if len(parts) < 2 {
+		return 0
+	}
+	minor, _ := strconv.Atoi(parts[1])
+	return minor
+}
+
+// legacyKubernetesMaxMinor 旧版Kubernetes软件源提供的最高次版本号
+const legacyKubernetesMaxMinor = 28
+
+// useNewKubernetesRepo 是否使用pkgs.k8s.io布局的软件源，旧版软件源不提供所需版本且未配置新版软件源时返回错误
+func (p Profile) useNewKubernetesRepo(version string) (bool, error) {
+	if p.KubernetesNew != "" && (p.Kubernetes == "" || minorVersion(version) > legacyKubernetesMaxMinor) {
+		return true, nil
+	}
+	if p.Kubernetes == "" || minorVersion(version) > legacyKubernetesMaxMinor {
+		return false, fmt.Errorf("镜像源%s未提供Kubernetes %s软件源(旧版软件源仅提供1.%d及以下版本)，请通过--mirror选择%s，或在镜像源配置中指定kubernetes_new",
+			p.Name, version, legacyKubernetesMaxMinor, strings.Join(newRepoProfiles(), "、"))
+	}
+	return false, nil
+}
+
+// CheckKubernetesRepo 检查镜像源是否提供指定版本的Kubernetes软件源
+func (p Profile) CheckKubernetesRepo(version string) error {
+	_, err := p.useNewKubernetesRepo(version)
+	return err
+}
+
+// KubernetesYumRepo Kubernetes rpm源地址与签名公钥，legacy源不校验签名
+func (p Profile) KubernetesYumRepo(version, arch string) (baseURL, gpgKey string, err error) {
+	useNew, err := p.useNewKubernetesRepo(version)
+	if err != nil {
+		return "", "", err
+	}
+	if useNew {
+		base := join(p.KubernetesNew, fmt.Sprintf("v1.%d", minorVersion(version)), "rpm/")
+		return base, base + "repodata/repomd.xml.key", nil
+	}
+	return join(p.Kubernetes, "yum", "repos", "kubernetes-el7-"+arch+"/"), "", nil
+}
+
+// KubernetesAptRepo Kubernetes apt源地址、发行版代号与签名公钥
+func (p Profile) KubernetesAptRepo(version, codename string) (uri, suite, gpgKey string, err error) {
+	useNew, err := p.useNewKubernetesRepo(version)
+	if err != nil {
+		return "", "", "", err
+	}
+	if useNew {
+		base := join(p.KubernetesNew, fmt.Sprintf("v1.%d", minorVersion(version)), "deb/")
+		return base, "/", base + "Release.key", nil
+	}
+	uri = join(p.Kubernetes, "apt/")
+	suite = "kubernetes-xenial"
+	if codename != "" && pkg.CheckNetworkFileExists(join(p.Kubernetes, "apt", "dists", "kubernetes-"+codename, "Release")) {
+		suite = "kubernetes-" + codename
+	}
+	return uri, suite, join(p.Kubernetes, "apt", "doc", "apt-key.gpg"), nil
+}
+
+// Image Kubernetes组件镜像地址，如Image("pause:3.9")
+func (p Profile) Image(name string) string {
+	return join(p.ImageRepository, name)
+}
+
+// GitHubURL GitHub下载地址，配置了加速前缀时添加前缀
+func (p Profile) GitHubURL(url string) string {
+	if p.GitHub == "" {
+		return url
+	}
+	return join(p.GitHub, url)
+}
@@ -0,0 +1,133 @@
+package mirror
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKubernetesYumRepo(t *testing.T) {
+	tests := []struct {
+		name     string
+		profile  Profile
+		version  string
+		wantBase string
+		wantKey  string
+		wantErr  bool
+	}{
+		{
+			name:     "1.28使用旧版软件源",
+			profile:  profiles[Aliyun],
+			version:  "v1.28.2",
+			wantBase: "https://mirrors.aliyun.com/kubernetes/yum/repos/kubernetes-el7-x86_64/",
+		},
+		{
+			name:     "1.29起使用新版软件源",
+			profile:  profiles[Aliyun],
+			version:  "1.30.4",
+			wantBase: "https://mirrors.aliyun.com/kubernetes-new/core/stable/v1.30/rpm/",
+			wantKey:  "https://mirrors.aliyun.com/kubernetes-new/core/stable/v1.30/rpm/repodata/repomd.xml.key",
+		},
+		{
+			name:     "官方源仅有新版软件源",
+			profile:  profiles[Official],
+			version:  "1.27.6",
+			wantBase: "https://pkgs.k8s.io/core:/stable:/v1.27/rpm/",
+			wantKey:  "https://pkgs.k8s.io/core:/stable:/v1.27/rpm/repodata/repomd.xml.key",
+		},
+		{
+			name:     "华为源1.28",
+			profile:  profiles[Huawei],
+			version:  "1.28.2",
+			wantBase: "https://mirrors.huaweicloud.com/kubernetes/yum/repos/kubernetes-el7-x86_64/",
+		},
+		{
+			name:    "华为源不提供1.29及以上版本",
+			profile: profiles[Huawei],
+			version: "1.29.0",
+			wantErr: true,
+		},
+		{
+			name:    "未配置Kubernetes软件源",
+			profile: Profile{Name: Custom},
+			version: "1.28.2",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base, key, err := tt.profile.KubernetesYumRepo(tt.version, "x86_64")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("KubernetesYumRepo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if base != tt.wantBase || key != tt.wantKey {
+				t.Errorf("KubernetesYumRepo() = %s, %s, want %s, %s", base, key, tt.wantBase, tt.wantKey)
+			}
+			if err := tt.profile.CheckKubernetesRepo(tt.version); (err != nil) != tt.wantErr {
+				t.Errorf("CheckKubernetesRepo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKubernetesAptRepo(t *testing.T) {
+	uri, suite, key, err := profiles[Tsinghua].KubernetesAptRepo("1.31.0", "jammy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	base := "https://mirrors.tuna.tsinghua.edu.cn/kubernetes/core:/stable:/v1.31/deb/"
+	if uri != base || suite != "/" || key != base+"Release.key" {
+		t.Errorf("KubernetesAptRepo() = %s, %s, %s", uri, suite, key)
+	}
+
+	_, _, _, err = profiles[Huawei].KubernetesAptRepo("1.31.0", "jammy")
+	if err == nil || !strings.Contains(err.Error(), "kubernetes_new") {
+		t.Errorf("KubernetesAptRepo() error = %v, want hint for kubernetes_new", err)
+	}
+}
+
+func TestSetup(t *testing.T) {
+	prev := current
+	t.Cleanup(func() { current = prev })
+
+	file := filepath.Join(t.TempDir(), "mirror.yaml")
+	if err := os.WriteFile(file, []byte("image_repository: harbor.example.com/k8s\ngithub: https://ghproxy.example.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		profile    string
+		configFile string
+		wantName   string
+		wantRepo   string
+		wantErr    bool
+	}{
+		{name: "内置镜像源", profile: Tsinghua, wantName: Tsinghua, wantRepo: profiles[Tsinghua].ImageRepository},
+		{name: "配置文件覆盖内置镜像源", profile: Aliyun, configFile: file, wantName: Custom, wantRepo: "harbor.example.com/k8s"},
+		{name: "自定义镜像源", profile: Custom, configFile: file, wantName: Custom, wantRepo: "harbor.example.com/k8s"},
+		{name: "自定义镜像源缺少配置文件", profile: Custom, wantErr: true},
+		{name: "未知镜像源", profile: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Setup(tt.profile, tt.configFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Setup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := Current(); got.Name != tt.wantName || got.ImageRepository != tt.wantRepo {
+				t.Errorf("Current() = %s, %s, want %s, %s", got.Name, got.ImageRepository, tt.wantName, tt.wantRepo)
+			}
+		})
+	}
+}
+
+func TestUsage(t *testing.T) {
+	want := "aliyun|huawei(Kubernetes仅支持1.28及以下)|official|tsinghua|ustc|custom"
+	if got := Usage(); got != want {
+		t.Errorf("Usage() = %s, want %s", got, want)
+	}
+}
@@ -3,11 +3,15 @@ package module
 import (
 	"github.com/dysodeng/devops-tools/internal/module/container"
 	"github.com/dysodeng/devops-tools/internal/module/kubernetes"
+	"github.com/dysodeng/devops-tools/internal/module/manifests"
+	"github.com/dysodeng/devops-tools/internal/module/preflight"
 	"github.com/dysodeng/devops-tools/internal/module/system"
 )
 
 func init() {
 	system.InitSystemCmd()
+	preflight.InitPreflightCmd()
 	container.InitContainerCmd()
 	kubernetes.InitKubernetesCmd()
+	manifests.InitManifestsCmd()
 }
@@ -0,0 +1,339 @@
+package preflight
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/module/compat"
+	"github.com/dysodeng/devops-tools/internal/module/container"
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// 容器运行时默认数据目录
+const (
+	DefaultDataDir       = "/var/lib/containerd"
+	DefaultDockerDataDir = "/var/lib/docker"
+)
+
+// checkFunc 以函数实现的检查项
+type checkFunc struct {
+	name   string
+	stages []Stage // 适用阶段，为空时适用于所有阶段
+	roles  []Role  // 适用角色，为空时适用于所有角色
+	run    func(opts Options) Result
+}
+
+func (c checkFunc) Name() string {
+	return c.name
+}
+
+func (c checkFunc) Applies(opts Options) bool {
+	stageMatched := len(c.stages) == 0
+	for _, stage := range c.stages {
+		stageMatched = stageMatched || stage == opts.Stage
+	}
+	roleMatched := len(c.roles) == 0
+	for _, role := range c.roles {
+		roleMatched = roleMatched || role == opts.Role
+	}
+	return stageMatched && roleMatched
+}
+
+func (c checkFunc) Run(opts Options) Result {
+	return c.run(opts)
+}
+
+func pass(format string, args ...any) Result {
+	return Result{Status: StatusPass, Message: fmt.Sprintf(format, args...)}
+}
+
+func warn(remediation, format string, args ...any) Result {
+	return Result{Status: StatusWarn, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
+
+func fail(remediation, format string, args ...any) Result {
+	return Result{Status: StatusFail, Message: fmt.Sprintf(format, args...), Remediation: remediation}
+}
+
+// kubeadm对控制面节点的最低要求
+const (
+	minControlPlaneCPU    = 2
+	minControlPlaneMemory = 1700 << 20
+	minWorkerMemory       = 1 << 30
+	minDataDirSpace       = 10 << 30
+	recommendDataDirSpace = 20 << 30
+)
+
+// requiredModules Kubernetes依赖的内核模块
+var requiredModules = []string{"overlay", "br_netfilter"}
+
+// controlPlanePorts 控制面节点需要占用的端口
+var controlPlanePorts = []int{6443, 2379, 2380, 10250, 10257, 10259}
+
+// workerPorts 工作节点需要占用的端口
+var workerPorts = []int{10250}
+
+// hostnamePattern RFC 1123 主机名
+var hostnamePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+func init() {
+	Register(
+		checkFunc{name: "cpu", run: checkCPU},
+		checkFunc{name: "memory", run: checkMemory},
+		checkFunc{name: "swap", run: checkSwap},
+		checkFunc{name: "kernel-modules", run: checkKernelModules},
+		checkFunc{name: "ports", stages: []Stage{StageInit, StageJoin}, run: checkPorts},
+		checkFunc{name: "hostname", run: checkHostname},
+		checkFunc{name: "mac-address", run: checkMACAddress},
+		checkFunc{name: "product-uuid", run: checkProductUUID},
+		checkFunc{name: "cgroup-driver", run: checkCgroupDriver},
+		checkFunc{name: "container-runtime", run: checkContainerRuntime},
+		checkFunc{name: "version-compat", run: checkVersionCompat},
+		checkFunc{name: "disk-space", run: checkDiskSpace},
+		checkFunc{name: "kubeadm", stages: []Stage{StageInit, StageJoin}, run: checkKubeadm},
+	)
+}
+
+func checkCPU(opts Options) Result {
+	cpus := system.System.CpuCores
+	if opts.Role == RoleControlPlane && cpus < minControlPlaneCPU {
+		return fail("控制面节点至少需要2个CPU核心", "CPU核心数%d，低于最低要求%d", cpus, minControlPlaneCPU)
+	}
+	return pass("CPU核心数%d", cpus)
+}
+
+func checkMemory(opts Options) Result {
+	facts := opts.facts
+	minimum := uint64(minWorkerMemory)
+	if opts.Role == RoleControlPlane {
+		minimum = minControlPlaneMemory
+	}
+	if facts.Memory.Total < minimum {
+		return fail(
+			fmt.Sprintf("%s节点内存至少需要%s", opts.Role, pkg.HumanSize(minimum)),
+			"内存%s，低于最低要求%s", pkg.HumanSize(facts.Memory.Total), pkg.HumanSize(minimum),
+		)
+	}
+	return pass("内存%s", pkg.HumanSize(facts.Memory.Total))
+}
+
+func checkSwap(opts Options) Result {
+	facts := opts.facts
+	if !facts.Memory.SwapOn {
+		return pass("swap已关闭")
+	}
+	remediation := "执行 swapoff -a 并注释/etc/fstab中的swap挂载项"
+	if opts.Stage == StageInstall {
+		return warn(remediation, "swap已开启，安装过程中将自动关闭")
+	}
+	return fail(remediation, "swap已开启，kubelet要求关闭swap")
+}
+
+func checkKernelModules(_ Options) Result {
+	var missing []string
+	for _, module := range requiredModules {
+		if _, err := os.Stat(filepath.Join("/sys/module", module)); err == nil {
+			continue
+		}
+		if _, err := pkg.CmdOutput(exec.Command("modprobe", "--dry-run", module)); err != nil {
+			missing = append(missing, module)
+		}
+	}
+	if len(missing) > 0 {
+		return fail(
+			"安装对应的内核模块包(如kernel-modules-extra)或升级内核",
+			"内核模块无法加载: %s", strings.Join(missing, ", "),
+		)
+	}
+	return pass("内核模块可加载: %s", strings.Join(requiredModules, ", "))
+}
+
+func checkPorts(opts Options) Result {
+	ports := workerPorts
+	if opts.Role == RoleControlPlane {
+		ports = controlPlanePorts
+	}
+	var used []string
+	for _, port := range ports {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+		if err != nil {
+			used = append(used, fmt.Sprint(port))
+			continue
+		}
+		_ = listener.Close()
+	}
+	if len(used) > 0 {
+		return fail(
+			"停止占用端口的进程，若为旧集群残留可执行 kubeadm reset",
+			"端口已被占用: %s", strings.Join(used, ", "),
+		)
+	}
+	return pass("端口可用")
+}
+
+func checkHostname(_ Options) Result {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return fail("检查/etc/hostname", "无法获取主机名: %v", err)
+	}
+	remediation := "使用 hostnamectl set-hostname <name> 为每个节点设置唯一且符合RFC 1123的主机名"
+	if hostname == "localhost" || strings.HasPrefix(hostname, "localhost.") {
+		return fail(remediation, "主机名为%s，无法在集群中唯一标识节点", hostname)
+	}
+	if !hostnamePattern.MatchString(hostname) {
+		return fail(remediation, "主机名%s不符合RFC 1123(仅允许小写字母、数字、-和.)", hostname)
+	}
+	return pass("主机名%s(请确保集群内唯一)", hostname)
+}
+
+func checkMACAddress(_ Options) Result {
+	route, err := system.DefaultRoute()
+	if err != nil {
+		return warn("配置默认路由", "无法确定默认网卡: %v", err)
+	}
+	iface, err := net.InterfaceByName(route.Interface)
+	if err != nil || len(iface.HardwareAddr) == 0 {
+		return warn("检查默认网卡配置", "无法获取网卡%s的MAC地址", route.Interface)
+	}
+	return pass("%s MAC地址%s(请确保集群内唯一，克隆虚拟机需重新生成)", route.Interface, iface.HardwareAddr)
+}
+
+func checkProductUUID(opts Options) Result {
+	facts := opts.facts
+	if facts.ProductUUID == "" {
+		return warn("确保以root执行，或检查/sys/class/dmi/id/product_uuid", "无法读取product_uuid")
+	}
+	if strings.Trim(facts.ProductUUID, "0-") == "" {
+		return fail("在虚拟化平台中为虚拟机重新生成UUID", "product_uuid无效: %s", facts.ProductUUID)
+	}
+	return pass("product_uuid %s(请确保集群内唯一)", facts.ProductUUID)
+}
+
+func checkCgroupDriver(opts Options) Result {
+	cgroup := fmt.Sprintf("cgroup v%d", system.CgroupVersion())
+	if opts.WithDocker {
+		return checkDockerCgroupDriver(opts, cgroup)
+	}
+	config, err := container.LoadContainerdConfig(filepath.Join(container.ContainerdConfigPath, "config.toml"))
+	if err != nil {
+		if opts.Stage == StageInstall {
+			return warn("执行 devops container install", "%s，未找到containerd配置: %v", cgroup, err)
+		}
+		return fail("执行 devops container install", "%s，未找到containerd配置: %v", cgroup, err)
+	}
+	if systemdCgroup, _ := config.Get("systemd_cgroup"); systemdCgroup != true {
+		return fail(
+			"执行 devops container config set systemd_cgroup true --restart",
+			"%s，containerd未使用systemd cgroup驱动，与kubelet不一致", cgroup,
+		)
+	}
+	return pass("%s，containerd使用systemd cgroup驱动", cgroup)
+}
+
+// checkDockerCgroupDriver 检查daemon.json中的cgroup驱动，kubelet默认使用systemd
+func checkDockerCgroupDriver(opts Options, cgroup string) Result {
+	driver, err := container.DockerCgroupDriver()
+	if err != nil {
+		if opts.Stage == StageInstall {
+			return warn("执行 devops container install --with-docker", "%s，未找到Docker配置: %v", cgroup, err)
+		}
+		return fail("执行 devops container install --with-docker", "%s，未找到Docker配置: %v", cgroup, err)
+	}
+	if driver != "systemd" {
+		return fail(
+			"在"+container.DockerConfigPath+"/daemon.json中设置\"exec-opts\": [\"native.cgroupdriver=systemd\"]并重启docker",
+			"%s，Docker使用%s cgroup驱动，与kubelet不一致", cgroup, driver,
+		)
+	}
+	return pass("%s，Docker使用systemd cgroup驱动", cgroup)
+}
+
+func checkContainerRuntime(opts Options) Result {
+	sock, remediation := container.ContainerdSockPath, "执行 devops container install 并确认containerd服务已启动"
+	if opts.WithDocker {
+		// kubelet通过cri-dockerd访问Docker
+		sock, remediation = container.CriDockerdSockPath, "执行 devops container install --with-docker 并确认docker与cri-docker服务已启动"
+	}
+	info, err := os.Stat(sock)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return fail(remediation, "容器运行时socket不存在: %s", sock)
+	}
+	return pass("容器运行时socket %s", sock)
+}
+
+func checkVersionCompat(opts Options) Result {
+	if opts.KubernetesVersion == "" {
+		return pass("未指定Kubernetes版本，跳过")
+	}
+	release, err := compat.Lookup(opts.KubernetesVersion)
+	if err != nil {
+		return fail("执行 devops k8s versions 查看支持的版本", "%v", err)
+	}
+	if opts.WithDocker {
+		// cri-dockerd自行管理pause镜像，不检查containerd配置
+		return pass("Kubernetes %s", release.Kubernetes)
+	}
+	if err = container.CheckContainerdVersion(opts.KubernetesVersion); err != nil {
+		return warn(
+			fmt.Sprintf("安装containerd %s版本", release.Containerd),
+			"%v", err,
+		)
+	}
+	pauseImage, _ := container.PauseImage(opts.KubernetesVersion)
+	if sandboxImage, err := container.SandboxImage(); err == nil && sandboxImage != pauseImage {
+		return warn(
+			"执行 devops container config set sandbox_image "+pauseImage+" --restart",
+			"containerd sandbox镜像%s与Kubernetes %s的pause镜像%s不一致", sandboxImage, release.Kubernetes, pauseImage,
+		)
+	}
+	return pass("containerd版本与sandbox镜像兼容Kubernetes %s", release.Kubernetes)
+}
+
+func checkDiskSpace(opts Options) Result {
+	dir := opts.DataDir
+	if dir == "" && opts.WithDocker {
+		dir = DefaultDockerDataDir
+	} else if dir == "" {
+		dir = DefaultDataDir
+	}
+
+	// 目录不存在时检查最近的上级目录
+	path := dir
+	for {
+		if _, err := os.Stat(path); err == nil || path == "/" {
+			break
+		}
+		path = filepath.Dir(path)
+	}
+	_, available, err := system.DiskUsage(path)
+	if err != nil {
+		return warn("检查数据目录所在磁盘", "无法获取%s的磁盘空间: %v", dir, err)
+	}
+	remediation := "扩容磁盘或通过 devops container install --with-data 指定更大的数据目录"
+	if available < minDataDirSpace {
+		return fail(remediation, "%s可用空间%s，低于最低要求%s", dir, pkg.HumanSize(available), pkg.HumanSize(minDataDirSpace))
+	}
+	if available < recommendDataDirSpace {
+		return warn(remediation, "%s可用空间%s，建议至少%s", dir, pkg.HumanSize(available), pkg.HumanSize(recommendDataDirSpace))
+	}
+	return pass("%s可用空间%s", dir, pkg.HumanSize(available))
+}
+
+func checkKubeadm(_ Options) Result {
+	var missing []string
+	for _, bin := range []string{"kubeadm", "kubelet", "kubectl"} {
+		if _, err := exec.LookPath(bin); err != nil {
+			missing = append(missing, bin)
+		}
+	}
+	if len(missing) > 0 {
+		return fail("执行 devops k8s install", "未安装: %s", strings.Join(missing, ", "))
+	}
+	return pass("kubeadm、kubelet、kubectl已安装")
+}
@@ -0,0 +1,200 @@
+package preflight
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/dysodeng/devops-tools/internal/module/system"
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+)
+
+// Status 检查结果状态
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+)
+
+// Stage 检查阶段
+type Stage string
+
+const (
+	StageInstall Stage = "install" // k8s install 之前
+	StageInit    Stage = "init"    // k8s init-cluster 之前
+	StageJoin    Stage = "join"    // 加入集群之前
+)
+
+// Role 节点角色
+type Role string
+
+const (
+	RoleControlPlane Role = "control-plane"
+	RoleWorker       Role = "worker"
+)
+
+// Options 检查参数
+type Options struct {
+	Stage   Stage  // 检查阶段
+	Role    Role   // 节点角色
+	DataDir string // 容器运行时数据目录
+
+	WithDocker bool // 使用Docker(cri-dockerd)，否则为containerd
+
+	KubernetesVersion string // Kubernetes版本，为空时不检查版本兼容性
+
+	facts system.Facts
+}
+
+// Result 检查结果
+type Result struct {
+	Name        string `json:"name"`
+	Status      Status `json:"status"`
+	Message     string `json:"message"`
+	Remediation string `json:"remediation,omitempty"`
+}
+
+// Check 检查项
+type Check interface {
+	// Name 检查项名称
+	Name() string
+	// Applies 是否适用于当前阶段与角色
+	Applies(opts Options) bool
+	// Run 执行检查
+	Run(opts Options) Result
+}
+
+// Report 检查报告
+type Report struct {
+	Stage   Stage    `json:"stage"`
+	Role    Role     `json:"role"`
+	Passed  bool     `json:"passed"`
+	Results []Result `json:"results"`
+}
+
+var checks []Check
+
+// Register 注册检查项
+func Register(check ...Check) {
+	checks = append(checks, check...)
+}
+
+// Run 执行所有适用的检查项
+func Run(opts Options) Report {
+	opts.facts = system.CollectFacts()
+	report := Report{Stage: opts.Stage, Role: opts.Role, Passed: true}
+	for _, check := range checks {
+		if !check.Applies(opts) {
+			continue
+		}
+		result := check.Run(opts)
+		result.Name = check.Name()
+		if result.Status == StatusFail {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+	return report
+}
+
+// Print 以表格形式输出检查报告
+func (r Report) Print(out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintf(w, "---------- 预检(%s/%s) ----------\n", r.Stage, r.Role)
+	for _, result := range r.Results {
+		_, _ = fmt.Fprintf(w, "[%s]\t%s\t%s\n", result.Status, result.Name, result.Message)
+		if result.Status != StatusPass && result.Remediation != "" {
+			_, _ = fmt.Fprintf(w, "\t\t修复: %s\n", result.Remediation)
+		}
+	}
+	_ = w.Flush()
+}
+
+// Validate 校验检查阶段与节点角色，未知取值会跳过所有限定阶段或角色的检查项
+func (o Options) Validate() error {
+	switch o.Stage {
+	case StageInstall, StageInit, StageJoin:
+	default:
+		return fmt.Errorf("检查阶段%s无效，可选值: install|init|join", o.Stage)
+	}
+	switch o.Role {
+	case RoleControlPlane, RoleWorker:
+	default:
+		return fmt.Errorf("节点角色%s无效，可选值: control-plane|worker", o.Role)
+	}
+	return nil
+}
+
+// Gate 执行预检并在存在失败项时返回错误，预演模式下仅输出报告
+func Gate(opts Options) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	report := Run(opts)
+	report.Print(os.Stdout)
+	if report.Passed || pkg.IsDryRun() {
+		return nil
+	}
+	return errors.New("预检未通过，请根据修复建议处理后重试，或使用--skip-preflight跳过")
+}
+
+var (
+	preflightStage   string
+	preflightRole    string
+	preflightDataDir string
+	preflightOutput  string
+	preflightVersion string
+	preflightDocker  bool
+)
+
+// Cmd 主机预检命令
+var Cmd = &cobra.Command{
+	Use:   "preflight",
+	Short: "主机就绪检查",
+	Long:  "检查主机是否满足安装与初始化Kubernetes的要求",
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := Options{
+			Stage:      Stage(preflightStage),
+			Role:       Role(preflightRole),
+			DataDir:    preflightDataDir,
+			WithDocker: preflightDocker,
+
+			KubernetesVersion: preflightVersion,
+		}
+		if err := opts.Validate(); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		report := Run(opts)
+		if preflightOutput == pkg.OutputTable {
+			report.Print(os.Stdout)
+		} else if err := pkg.PrintStructured(os.Stdout, preflightOutput, report); err != nil {
+			fmt.Println(err.Error())
+			os.Exit(1)
+		}
+		if !report.Passed {
+			os.Exit(1)
+		}
+	},
+}
+
+// AddFlags 为需要预检的命令添加预检参数
+func AddFlags(cmd *cobra.Command, skip *bool) {
+	cmd.Flags().BoolVarP(skip, "skip-preflight", "", false, "跳过主机预检")
+}
+
+func InitPreflightCmd() {
+	system.Require(Cmd, system.RequireLinux)
+	Cmd.Flags().StringVarP(&preflightStage, "stage", "", string(StageInit), "检查阶段: install|init|join")
+	Cmd.Flags().StringVarP(&preflightRole, "role", "", string(RoleControlPlane), "节点角色: control-plane|worker")
+	Cmd.Flags().StringVarP(&preflightDataDir, "data-dir", "", "", "容器运行时数据目录，默认containerd为"+DefaultDataDir+"，Docker为"+DefaultDockerDataDir)
+	Cmd.Flags().BoolVarP(&preflightDocker, "with-docker", "", false, "检查Docker(cri-dockerd)，默认为containerd")
+	Cmd.Flags().StringVarP(&preflightVersion, "kubernetes-version", "", "", "检查containerd与sandbox镜像是否兼容该Kubernetes版本")
+	Cmd.Flags().StringVarP(&preflightOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	system.Cmd.AddCommand(Cmd)
+}
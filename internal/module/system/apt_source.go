@@ -0,0 +1,174 @@
+package system
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+const (
+	aptSourcesList = "/etc/apt/sources.list"
+	aptSourcesDir  = "/etc/apt/sources.list.d"
+)
+
+// aptSource 一组apt软件源
+type aptSource struct {
+	URI        string
+	Suites     []string
+	Components []string
+}
+
+// line 单行格式(sources.list)
+func (s aptSource) line() string {
+	var lines []string
+	for _, suite := range s.Suites {
+		lines = append(lines, fmt.Sprintf("deb %s %s %s", s.URI, suite, strings.Join(s.Components, " ")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// deb822 deb822格式(*.sources)
+func (s aptSource) deb822(signedBy string) string {
+	content := fmt.Sprintf(
+		"Types: deb\nURIs: %s\nSuites: %s\nComponents: %s\n",
+		s.URI,
+		strings.Join(s.Suites, " "),
+		strings.Join(s.Components, " "),
+	)
+	if signedBy != "" {
+		content += "Signed-By: " + signedBy + "\n"
+	}
+	return content
+}
+
+// aptSources 根据发行版与镜像地址生成软件源列表
+func aptSources(distro, codename string, majorVersion int, mirror string) ([]aptSource, error) {
+	if codename == "" {
+		return nil, fmt.Errorf("无法获取%s版本代号", distro)
+	}
+	mirror = strings.TrimSuffix(mirror, "/") + "/"
+
+	switch distro {
+	case DistroUbuntu:
+		components := []string{"main", "restricted", "universe", "multiverse"}
+		return []aptSource{
+			{
+				URI:        mirror,
+				Suites:     []string{codename, codename + "-updates", codename + "-backports"},
+				Components: components,
+			},
+			{
+				URI:        mirror,
+				Suites:     []string{codename + "-security"},
+				Components: components,
+			},
+		}, nil
+
+	case DistroDebian:
+		components := []string{"main", "contrib", "non-free"}
+		if majorVersion >= 12 || majorVersion == 0 {
+			components = append(components, "non-free-firmware")
+		}
+		securitySuite := codename + "-security"
+		if majorVersion > 0 && majorVersion < 11 {
+			securitySuite = codename + "/updates"
+		}
+		securityMirror := strings.TrimSuffix(mirror, "debian/") + "debian-security/"
+		if !strings.HasSuffix(mirror, "debian/") {
+			securityMirror = mirror
+		}
+		return []aptSource{
+			{
+				URI:        mirror,
+				Suites:     []string{codename, codename + "-updates", codename + "-backports"},
+				Components: components,
+			},
+			{
+				URI:        securityMirror,
+				Suites:     []string{securitySuite},
+				Components: components,
+			},
+		}, nil
+	}
+
+	return nil, fmt.Errorf("暂不支持更换%s软件源", distro)
+}
+
+// deb822SourceFiles 发行版自带的deb822格式软件源文件，如ubuntu.sources
+func deb822SourceFiles() []string {
+	entries, err := pkg.HostFS().ReadDir(aptSourcesDir)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == "ubuntu.sources" || name == "debian.sources" {
+			files = append(files, path.Join(aptSourcesDir, name))
+		}
+	}
+	return files
+}
+
+// deb822SignedBy 读取deb822文件中的Signed-By
+func deb822SignedBy(file string) string {
+	data, err := pkg.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "Signed-By:"); ok {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// changeAptSource 更换apt软件源，原有文件备份为*.bak
+func changeAptSource(mirror string) error {
+	sources, err := aptSources(System.LinuxDistro, System.CodeName, System.LinuxDistroMajorNum, mirror)
+	if err != nil {
+		return err
+	}
+
+	header := fmt.Sprintf("# Generated by devops system init, mirror: %s\n", mirror)
+
+	// 新版本使用deb822格式，sources.list仅保留注释
+	if files := deb822SourceFiles(); len(files) > 0 {
+		for _, file := range files {
+			signedBy := deb822SignedBy(file)
+			var blocks []string
+			for _, source := range sources {
+				blocks = append(blocks, source.deb822(signedBy))
+			}
+			if err = pkg.BackupFile(file); err != nil {
+				return err
+			}
+			if err = pkg.WriteFile(file, []byte(header+strings.Join(blocks, "\n")), 0644); err != nil {
+				return err
+			}
+		}
+		if pkg.FileExists(aptSourcesList) {
+			if err = pkg.BackupFile(aptSourcesList); err != nil {
+				return err
+			}
+			return pkg.WriteFile(
+				aptSourcesList,
+				[]byte(header+"# 软件源已迁移至 "+aptSourcesDir+" 中的deb822格式文件\n"),
+				0644,
+			)
+		}
+		return nil
+	}
+
+	var lines []string
+	for _, source := range sources {
+		lines = append(lines, source.line())
+	}
+	if err = pkg.BackupFile(aptSourcesList); err != nil {
+		return err
+	}
+	return pkg.WriteFile(aptSourcesList, []byte(header+strings.Join(lines, "\n")+"\n"), 0644)
+}
@@ -0,0 +1,137 @@
+package system
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAptSources(t *testing.T) {
+	tests := []struct {
+		name     string
+		distro   string
+		codename string
+		major    int
+		mirror   string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "ubuntu",
+			distro:   DistroUbuntu,
+			codename: "jammy",
+			major:    22,
+			mirror:   "https://mirrors.aliyun.com/ubuntu",
+			want: []string{
+				"deb https://mirrors.aliyun.com/ubuntu/ jammy main restricted universe multiverse",
+				"deb https://mirrors.aliyun.com/ubuntu/ jammy-updates main restricted universe multiverse",
+				"deb https://mirrors.aliyun.com/ubuntu/ jammy-backports main restricted universe multiverse",
+				"deb https://mirrors.aliyun.com/ubuntu/ jammy-security main restricted universe multiverse",
+			},
+		},
+		{
+			name:     "debian 12包含non-free-firmware",
+			distro:   DistroDebian,
+			codename: "bookworm",
+			major:    12,
+			mirror:   "https://mirrors.aliyun.com/debian/",
+			want: []string{
+				"deb https://mirrors.aliyun.com/debian/ bookworm main contrib non-free non-free-firmware",
+				"deb https://mirrors.aliyun.com/debian/ bookworm-updates main contrib non-free non-free-firmware",
+				"deb https://mirrors.aliyun.com/debian/ bookworm-backports main contrib non-free non-free-firmware",
+				"deb https://mirrors.aliyun.com/debian-security/ bookworm-security main contrib non-free non-free-firmware",
+			},
+		},
+		{
+			name:     "debian 10使用旧的安全更新路径",
+			distro:   DistroDebian,
+			codename: "buster",
+			major:    10,
+			mirror:   "https://mirrors.aliyun.com/debian",
+			want: []string{
+				"deb https://mirrors.aliyun.com/debian/ buster main contrib non-free",
+				"deb https://mirrors.aliyun.com/debian/ buster-updates main contrib non-free",
+				"deb https://mirrors.aliyun.com/debian/ buster-backports main contrib non-free",
+				"deb https://mirrors.aliyun.com/debian-security/ buster/updates main contrib non-free",
+			},
+		},
+		{name: "缺少版本代号", distro: DistroUbuntu, mirror: "https://mirrors.aliyun.com/ubuntu", wantErr: true},
+		{name: "不支持的发行版", distro: "alpine", codename: "v3", mirror: "https://mirrors.aliyun.com/alpine", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sources, err := aptSources(tt.distro, tt.codename, tt.major, tt.mirror)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("aptSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var lines []string
+			for _, source := range sources {
+				lines = append(lines, strings.Split(source.line(), "\n")...)
+			}
+			if strings.Join(lines, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("aptSources() =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestChangeAptSource(t *testing.T) {
+	const mirror = "https://mirrors.aliyun.com/ubuntu/"
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  map[string][]string // 文件应包含的内容
+	}{
+		{
+			name:  "sources.list格式",
+			files: map[string]string{aptSourcesList: "deb http://archive.ubuntu.com/ubuntu jammy main\n"},
+			want: map[string][]string{
+				aptSourcesList:          {"deb " + mirror + " jammy main restricted universe multiverse", "deb " + mirror + " jammy-security"},
+				aptSourcesList + ".bak": {"deb http://archive.ubuntu.com/ubuntu jammy main"},
+			},
+		},
+		{
+			name: "deb822格式保留Signed-By",
+			files: map[string]string{
+				aptSourcesList: "# Ubuntu sources have moved\n",
+				aptSourcesDir + "/ubuntu.sources": "Types: deb\nURIs: http://archive.ubuntu.com/ubuntu/\nSuites: noble\n" +
+					"Components: main\nSigned-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg\n",
+			},
+			want: map[string][]string{
+				aptSourcesDir + "/ubuntu.sources": {
+					"URIs: " + mirror + "\nSuites: jammy jammy-updates jammy-backports\n",
+					"Signed-By: /usr/share/keyrings/ubuntu-archive-keyring.gpg",
+				},
+				aptSourcesDir + "/ubuntu.sources.bak": {"URIs: http://archive.ubuntu.com/ubuntu/"},
+				aptSourcesList:                        {"deb822"},
+			},
+		},
+	}
+	prev := System
+	defer func() { System = prev }()
+	System.LinuxDistro, System.CodeName, System.LinuxDistroMajorNum = DistroUbuntu, "jammy", 22
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := useMemFS(t)
+			for name, data := range tt.files {
+				if err := m.WriteFile(name, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := changeAptSource(mirror); err != nil {
+				t.Fatalf("changeAptSource() error = %v", err)
+			}
+			for name, wants := range tt.want {
+				data, err := m.ReadFile(name)
+				if err != nil {
+					t.Fatalf("%s: %v", name, err)
+				}
+				for _, want := range wants {
+					if !strings.Contains(string(data), want) {
+						t.Errorf("%s missing %q:\n%s", name, want, data)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !unix
+
+package system
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// DiskUsage 路径所在文件系统的总空间与可用空间，当前平台不支持
+func DiskUsage(path string) (size, available uint64, err error) {
+	return 0, 0, fmt.Errorf("%s平台不支持获取%s的磁盘空间", runtime.GOOS, path)
+}
@@ -0,0 +1,191 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// Family Linux发行版家族，安装逻辑按家族区分
+type Family string
+
+const (
+	FamilyUnknown Family = ""
+	FamilyRHEL    Family = "rhel"   // CentOS/RHEL/Rocky/AlmaLinux/openEuler/Anolis/Fedora等rpm系
+	FamilyDebian  Family = "debian" // Debian/Ubuntu等deb系
+	FamilySUSE    Family = "suse"   // openSUSE/SLES
+)
+
+// Linux发行版名称
+const (
+	DistroCentOS      = "CentOS"
+	DistroRHEL        = "RHEL"
+	DistroRocky       = "Rocky"
+	DistroAlmaLinux   = "AlmaLinux"
+	DistroOracleLinux = "OracleLinux"
+	DistroOpenEuler   = "openEuler"
+	DistroAnolis      = "Anolis"
+	DistroKylin       = "Kylin"
+	DistroUOS         = "UOS"
+	DistroFedora      = "Fedora"
+	DistroOpenSUSE    = "openSUSE"
+	DistroSLES        = "SLES"
+	DistroUbuntu      = "Ubuntu"
+	DistroDebian      = "Debian"
+)
+
+// distro 已知发行版
+type distro struct {
+	name   string
+	family Family
+}
+
+// knownDistros os-release ID与发行版的对应关系，家族为空表示需要根据ID_LIKE判断
+var knownDistros = map[string]distro{
+	"centos":              {DistroCentOS, FamilyRHEL},
+	"rhel":                {DistroRHEL, FamilyRHEL},
+	"rocky":               {DistroRocky, FamilyRHEL},
+	"almalinux":           {DistroAlmaLinux, FamilyRHEL},
+	"ol":                  {DistroOracleLinux, FamilyRHEL},
+	"openeuler":           {DistroOpenEuler, FamilyRHEL},
+	"anolis":              {DistroAnolis, FamilyRHEL},
+	"fedora":              {DistroFedora, FamilyRHEL},
+	"kylin":               {DistroKylin, FamilyUnknown},
+	"uos":                 {DistroUOS, FamilyUnknown},
+	"opensuse":            {DistroOpenSUSE, FamilySUSE},
+	"opensuse-leap":       {DistroOpenSUSE, FamilySUSE},
+	"opensuse-tumbleweed": {DistroOpenSUSE, FamilySUSE},
+	"sles":                {DistroSLES, FamilySUSE},
+	"ubuntu":              {DistroUbuntu, FamilyDebian},
+	"debian":              {DistroDebian, FamilyDebian},
+}
+
+// likeFamilies os-release ID_LIKE与家族的对应关系
+var likeFamilies = map[string]Family{
+	"rhel":      FamilyRHEL,
+	"centos":    FamilyRHEL,
+	"fedora":    FamilyRHEL,
+	"openeuler": FamilyRHEL,
+	"debian":    FamilyDebian,
+	"ubuntu":    FamilyDebian,
+	"suse":      FamilySUSE,
+	"opensuse":  FamilySUSE,
+}
+
+// OSRelease /etc/os-release 内容
+type OSRelease struct {
+	ID              string   // 发行版ID，如rocky
+	IDLike          []string // 相近的发行版ID
+	Name            string   // 发行版名称
+	PrettyName      string   // 发行版完整名称
+	VersionID       string   // 版本号，如9.3
+	VersionCodename string   // 版本代号，如jammy
+}
+
+// ParseOSRelease 解析os-release文件内容
+func ParseOSRelease(data []byte) OSRelease {
+	values := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `"'`)
+		}
+		values[strings.TrimSpace(key)] = value
+	}
+
+	release := OSRelease{
+		ID:              strings.ToLower(values["ID"]),
+		IDLike:          strings.Fields(strings.ToLower(values["ID_LIKE"])),
+		Name:            values["NAME"],
+		PrettyName:      values["PRETTY_NAME"],
+		VersionID:       values["VERSION_ID"],
+		VersionCodename: values["VERSION_CODENAME"],
+	}
+	if release.VersionCodename == "" {
+		release.VersionCodename = values["UBUNTU_CODENAME"]
+	}
+	if release.PrettyName == "" {
+		release.PrettyName = strings.TrimSpace(release.Name + " " + release.VersionID)
+	}
+	return release
+}
+
+// Distro 发行版名称
+func (r OSRelease) Distro() string {
+	if d, ok := knownDistros[r.ID]; ok {
+		return d.name
+	}
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.ID
+}
+
+// Family 发行版家族
+func (r OSRelease) Family() Family {
+	if d, ok := knownDistros[r.ID]; ok && d.family != FamilyUnknown {
+		return d.family
+	}
+	for _, like := range r.IDLike {
+		if family, ok := likeFamilies[like]; ok {
+			return family
+		}
+	}
+
+	// 麒麟、统信等同时存在rpm系与deb系版本，且ID_LIKE可能缺失
+	switch {
+	case pkg.FileExists("/etc/redhat-release"), pkg.FileExists("/etc/openEuler-release"):
+		return FamilyRHEL
+	case pkg.FileExists("/etc/debian_version"):
+		return FamilyDebian
+	case pkg.FileExists("/etc/SuSE-release"):
+		return FamilySUSE
+	}
+	return FamilyUnknown
+}
+
+// MajorVersion 主版本号
+func (r OSRelease) MajorVersion() int {
+	major, _, _ := strings.Cut(r.VersionID, ".")
+	num, err := strconv.Atoi(major)
+	if err != nil {
+		return 0
+	}
+	return num
+}
+
+// readOSRelease 读取os-release
+func readOSRelease() (OSRelease, error) {
+	data, err := pkg.ReadFile("/etc/os-release")
+	if err != nil {
+		var e error
+		if data, e = pkg.ReadFile("/usr/lib/os-release"); e != nil {
+			return OSRelease{}, err
+		}
+	}
+	return ParseOSRelease(data), nil
+}
+
+// ELVersion 兼容的el版本，用于选择docker-ce等第三方rpm源，非RHEL系克隆版默认为8
+func ELVersion() int {
+	switch System.LinuxDistro {
+	case DistroCentOS, DistroRHEL, DistroRocky, DistroAlmaLinux, DistroOracleLinux:
+		if System.LinuxDistroMajorNum >= 7 {
+			return System.LinuxDistroMajorNum
+		}
+	}
+	return 8
+}
@@ -0,0 +1,130 @@
+package system
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// useMemFS 将全局文件系统替换为内存文件系统，测试结束后恢复
+func useMemFS(t *testing.T) *pkg.MemFS {
+	t.Helper()
+	m := pkg.NewMemFS()
+	prev := pkg.HostFS()
+	pkg.SetFS(m)
+	t.Cleanup(func() { pkg.SetFS(prev) })
+	return m
+}
+
+func TestParseOSRelease(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		want       OSRelease
+		wantDistro string
+		wantFamily Family
+		wantMajor  int
+	}{
+		{
+			name: "rocky",
+			data: `NAME="Rocky Linux"
+VERSION="9.3 (Blue Onyx)"
+ID="rocky"
+ID_LIKE="rhel centos fedora"
+VERSION_ID="9.3"
+PRETTY_NAME="Rocky Linux 9.3 (Blue Onyx)"
+`,
+			want: OSRelease{
+				ID: "rocky", IDLike: []string{"rhel", "centos", "fedora"}, Name: "Rocky Linux",
+				PrettyName: "Rocky Linux 9.3 (Blue Onyx)", VersionID: "9.3",
+			},
+			wantDistro: DistroRocky, wantFamily: FamilyRHEL, wantMajor: 9,
+		},
+		{
+			name: "ubuntu使用UBUNTU_CODENAME补全代号",
+			data: `# comment
+NAME="Ubuntu"
+ID=ubuntu
+ID_LIKE=debian
+VERSION_ID="22.04"
+UBUNTU_CODENAME=jammy
+`,
+			want: OSRelease{
+				ID: "ubuntu", IDLike: []string{"debian"}, Name: "Ubuntu",
+				PrettyName: "Ubuntu 22.04", VersionID: "22.04", VersionCodename: "jammy",
+			},
+			wantDistro: DistroUbuntu, wantFamily: FamilyDebian, wantMajor: 22,
+		},
+		{
+			name: "未知发行版按ID_LIKE判断家族",
+			data: `NAME='Linx'
+ID=Linx
+ID_LIKE="Debian"
+VERSION_ID=6.0.100
+VERSION_CODENAME=buster
+`,
+			want: OSRelease{
+				ID: "linx", IDLike: []string{"debian"}, Name: "Linx",
+				PrettyName: "Linx 6.0.100", VersionID: "6.0.100", VersionCodename: "buster",
+			},
+			wantDistro: "Linx", wantFamily: FamilyDebian, wantMajor: 6,
+		},
+		{
+			name: "转义字符与无效行",
+			data: `ID=opensuse-leap
+NAME="openSUSE \"Leap\""
+invalid line
+VERSION_ID=rolling
+`,
+			want: OSRelease{
+				ID: "opensuse-leap", IDLike: []string{}, Name: `openSUSE "Leap"`, PrettyName: `openSUSE "Leap" rolling`, VersionID: "rolling",
+			},
+			wantDistro: DistroOpenSUSE, wantFamily: FamilySUSE, wantMajor: 0,
+		},
+	}
+	useMemFS(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ParseOSRelease([]byte(tt.data))
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseOSRelease() = %+v, want %+v", got, tt.want)
+			}
+			if distro := got.Distro(); distro != tt.wantDistro {
+				t.Errorf("Distro() = %s, want %s", distro, tt.wantDistro)
+			}
+			if family := got.Family(); family != tt.wantFamily {
+				t.Errorf("Family() = %s, want %s", family, tt.wantFamily)
+			}
+			if major := got.MajorVersion(); major != tt.wantMajor {
+				t.Errorf("MajorVersion() = %d, want %d", major, tt.wantMajor)
+			}
+		})
+	}
+}
+
+func TestOSReleaseFamilyFallback(t *testing.T) {
+	tests := []struct {
+		file string
+		want Family
+	}{
+		{file: "/etc/openEuler-release", want: FamilyRHEL},
+		{file: "/etc/debian_version", want: FamilyDebian},
+		{file: "", want: FamilyUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.want), func(t *testing.T) {
+			m := useMemFS(t)
+			if tt.file != "" {
+				if err := m.WriteFile(tt.file, []byte("1\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 麒麟没有ID_LIKE时根据发行版文件判断家族
+			release := ParseOSRelease([]byte("ID=kylin\nVERSION_ID=V10\n"))
+			if got := release.Family(); got != tt.want {
+				t.Errorf("Family() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
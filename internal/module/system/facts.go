@@ -0,0 +1,276 @@
+package system
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// Memory 内存信息，单位字节
+type Memory struct {
+	Total     uint64 `json:"total" yaml:"total"`
+	Available uint64 `json:"available" yaml:"available"`
+	SwapTotal uint64 `json:"swap_total" yaml:"swap_total"`
+	SwapFree  uint64 `json:"swap_free" yaml:"swap_free"`
+	SwapOn    bool   `json:"swap_on" yaml:"swap_on"`
+}
+
+// Disk 块设备
+type Disk struct {
+	Name       string `json:"name" yaml:"name"`
+	Size       uint64 `json:"size" yaml:"size"`
+	Rotational bool   `json:"rotational" yaml:"rotational"`
+	Model      string `json:"model,omitempty" yaml:"model,omitempty"`
+}
+
+// Mount 挂载点
+type Mount struct {
+	Device     string `json:"device" yaml:"device"`
+	MountPoint string `json:"mount_point" yaml:"mount_point"`
+	FSType     string `json:"fs_type" yaml:"fs_type"`
+	Size       uint64 `json:"size" yaml:"size"`
+	Available  uint64 `json:"available" yaml:"available"`
+}
+
+// Security 安全模块状态
+type Security struct {
+	SELinux  string `json:"selinux" yaml:"selinux"`   // enforcing/permissive/disabled
+	AppArmor string `json:"apparmor" yaml:"apparmor"` // enabled/disabled
+}
+
+// Firewall 防火墙
+type Firewall struct {
+	Service      string `json:"service" yaml:"service"`                                 // firewalld/ufw/nftables/none
+	IptablesMode string `json:"iptables_mode,omitempty" yaml:"iptables_mode,omitempty"` // nf_tables/legacy
+}
+
+// TimeSync 时间同步
+type TimeSync struct {
+	Service      string `json:"service" yaml:"service"` // chronyd/ntpd/systemd-timesyncd/none
+	Synchronized bool   `json:"synchronized" yaml:"synchronized"`
+}
+
+// Facts 主机详细信息
+type Facts struct {
+	system        `yaml:",inline"`
+	Hostname      string         `json:"hostname" yaml:"hostname"`
+	MachineID     string         `json:"machine_id,omitempty" yaml:"machine_id,omitempty"`
+	ProductUUID   string         `json:"product_uuid,omitempty" yaml:"product_uuid,omitempty"`
+	Memory        Memory         `json:"memory" yaml:"memory"`
+	Disks         []Disk         `json:"disks" yaml:"disks"`
+	Mounts        []Mount        `json:"mounts" yaml:"mounts"`
+	Interfaces    []NetInterface `json:"interfaces" yaml:"interfaces"`
+	DefaultRoute  *Route         `json:"default_route,omitempty" yaml:"default_route,omitempty"`
+	DefaultRoute6 *Route         `json:"default_route6,omitempty" yaml:"default_route6,omitempty"`
+	CgroupVersion int            `json:"cgroup_version" yaml:"cgroup_version"`
+	Security      Security       `json:"security" yaml:"security"`
+	Firewall      Firewall       `json:"firewall" yaml:"firewall"`
+	TimeSync      TimeSync       `json:"time_sync" yaml:"time_sync"`
+}
+
+// virtualFSTypes 统计挂载点时忽略的虚拟文件系统
+var virtualFSTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true, "securityfs": true,
+	"cgroup": true, "cgroup2": true, "pstore": true, "bpf": true, "debugfs": true, "tracefs": true,
+	"mqueue": true, "hugetlbfs": true, "configfs": true, "fusectl": true, "autofs": true, "binfmt_misc": true,
+	"rpc_pipefs": true, "nsfs": true, "overlay": true, "squashfs": true, "efivarfs": true, "selinuxfs": true,
+}
+
+// CollectFacts 采集主机详细信息
+func CollectFacts() Facts {
+	Detect()
+	facts := Facts{system: System}
+	facts.Hostname, _ = os.Hostname()
+	if System.OS != "linux" {
+		return facts
+	}
+
+	facts.MachineID = readTrim("/etc/machine-id", true)
+	facts.ProductUUID = readTrim("/sys/class/dmi/id/product_uuid", false)
+	facts.Memory = memoryInfo()
+	facts.Disks = diskInfo()
+	facts.Mounts = mountInfo()
+	facts.Interfaces, _ = NetInterfaces()
+	if route, err := DefaultRoute(); err == nil {
+		facts.DefaultRoute = &route
+	}
+	if route, err := DefaultRoute6(); err == nil {
+		facts.DefaultRoute6 = &route
+	}
+	facts.CgroupVersion = CgroupVersion()
+	facts.Security = securityInfo()
+	facts.Firewall = firewallInfo()
+	facts.TimeSync = timeSyncInfo()
+
+	return facts
+}
+
+// readTrim 读取文件内容，inRoot为true时从--root指定的根目录读取
+func readTrim(name string, inRoot bool) string {
+	var data []byte
+	var err error
+	if inRoot {
+		data, err = pkg.ReadFile(name)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// serviceActive systemd服务是否处于运行状态
+func serviceActive(name string) bool {
+	out, err := pkg.CmdOutput(exec.Command("systemctl", "is-active", name))
+	return err == nil && strings.TrimSpace(string(out)) == "active"
+}
+
+func memoryInfo() Memory {
+	var memory Memory
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return memory
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		value *= 1024
+		switch strings.TrimSuffix(fields[0], ":") {
+		case "MemTotal":
+			memory.Total = value
+		case "MemAvailable":
+			memory.Available = value
+		case "SwapTotal":
+			memory.SwapTotal = value
+		case "SwapFree":
+			memory.SwapFree = value
+		}
+	}
+
+	// /proc/swaps 首行为表头
+	swaps := readTrim("/proc/swaps", false)
+	memory.SwapOn = len(strings.Split(swaps, "\n")) > 1
+
+	return memory
+}
+
+func diskInfo() []Disk {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+	var disks []Disk
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") || strings.HasPrefix(name, "zram") {
+			continue
+		}
+		base := filepath.Join("/sys/block", name)
+		sectors, _ := strconv.ParseUint(readTrim(filepath.Join(base, "size"), false), 10, 64)
+		disks = append(disks, Disk{
+			Name:       name,
+			Size:       sectors * 512,
+			Rotational: readTrim(filepath.Join(base, "queue/rotational"), false) == "1",
+			Model:      readTrim(filepath.Join(base, "device/model"), false),
+		})
+	}
+	return disks
+}
+
+func mountInfo() []Mount {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var mounts []Mount
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || virtualFSTypes[fields[2]] || seen[fields[1]] {
+			continue
+		}
+		seen[fields[1]] = true
+		mount := Mount{Device: fields[0], MountPoint: fields[1], FSType: fields[2]}
+		if size, available, err := DiskUsage(fields[1]); err == nil {
+			mount.Size, mount.Available = size, available
+		}
+		mounts = append(mounts, mount)
+	}
+	return mounts
+}
+
+// CgroupVersion cgroup版本
+func CgroupVersion() int {
+	if _, err := os.Stat("/sys/fs/cgroup/cgroup.controllers"); err == nil {
+		return 2
+	}
+	return 1
+}
+
+func securityInfo() Security {
+	security := Security{SELinux: "disabled", AppArmor: "disabled"}
+	switch readTrim("/sys/fs/selinux/enforce", false) {
+	case "1":
+		security.SELinux = "enforcing"
+	case "0":
+		security.SELinux = "permissive"
+	}
+	if readTrim("/sys/module/apparmor/parameters/enabled", false) == "Y" {
+		security.AppArmor = "enabled"
+	}
+	return security
+}
+
+func firewallInfo() Firewall {
+	firewall := Firewall{Service: "none"}
+	switch {
+	case serviceActive("firewalld"):
+		firewall.Service = "firewalld"
+	case serviceActive("ufw"):
+		firewall.Service = "ufw"
+	case serviceActive("nftables"):
+		firewall.Service = "nftables"
+	}
+	if out, err := pkg.CmdOutput(exec.Command("iptables", "-V")); err == nil && len(out) > 0 {
+		if strings.Contains(string(out), "nf_tables") {
+			firewall.IptablesMode = "nf_tables"
+		} else {
+			firewall.IptablesMode = "legacy"
+		}
+	}
+	return firewall
+}
+
+func timeSyncInfo() TimeSync {
+	timeSync := TimeSync{Service: "none"}
+	for _, service := range []string{"chronyd", "chrony", "ntpd", "ntp", "systemd-timesyncd"} {
+		if serviceActive(service) {
+			timeSync.Service = service
+			break
+		}
+	}
+	out, err := pkg.CmdOutput(exec.Command("timedatectl", "show", "-p", "NTPSynchronized", "--value"))
+	if err == nil {
+		timeSync.Synchronized = strings.TrimSpace(string(out)) == "yes"
+	}
+	return timeSync
+}
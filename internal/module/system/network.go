@@ -0,0 +1,231 @@
+package system
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"strings"
+)
+
+// NetInterface 网卡信息
+type NetInterface struct {
+	Name  string   `json:"name" yaml:"name"`
+	MAC   string   `json:"mac,omitempty" yaml:"mac,omitempty"`
+	MTU   int      `json:"mtu" yaml:"mtu"`
+	Up    bool     `json:"up" yaml:"up"`
+	Addrs []string `json:"addrs,omitempty" yaml:"addrs,omitempty"` // CIDR格式
+}
+
+// Route 路由信息
+type Route struct {
+	Interface string `json:"interface" yaml:"interface"`
+	Gateway   string `json:"gateway,omitempty" yaml:"gateway,omitempty"`
+}
+
+// NetInterfaces 主机网卡列表，忽略回环网卡
+func NetInterfaces() ([]NetInterface, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var list []NetInterface
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		nic := NetInterface{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			MTU:  iface.MTU,
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			nic.Addrs = append(nic.Addrs, addr.String())
+		}
+		list = append(list, nic)
+	}
+	return list, nil
+}
+
+// DefaultRoute IPv4默认路由
+func DefaultRoute() (Route, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return Route{}, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// Iface Destination Gateway Flags RefCnt Use Metric Mask ...
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		route := Route{Interface: fields[0]}
+		if gateway, e := hex.DecodeString(fields[2]); e == nil && len(gateway) == 4 {
+			ip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(gateway))
+			route.Gateway = ip.String()
+		}
+		return route, nil
+	}
+	return Route{}, errors.New("未找到IPv4默认路由")
+}
+
+// DefaultRoute6 IPv6默认路由
+func DefaultRoute6() (Route, error) {
+	file, err := os.Open("/proc/net/ipv6_route")
+	if err != nil {
+		return Route{}, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	// Destination DstPrefixLen Source SrcPrefixLen NextHop Metric RefCnt Use Flags Iface
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[0] != strings.Repeat("0", 32) || fields[1] != "00" || fields[9] == "lo" {
+			continue
+		}
+		route := Route{Interface: fields[9]}
+		if gateway, e := hex.DecodeString(fields[4]); e == nil && len(gateway) == 16 {
+			if ip := net.IP(gateway); !ip.IsUnspecified() {
+				route.Gateway = ip.String()
+			}
+		}
+		return route, nil
+	}
+	return Route{}, errors.New("未找到IPv6默认路由")
+}
+
+// InterfaceAddresses 网卡上的全局单播地址及网段，不含链路本地地址，按内核返回顺序排列
+func InterfaceAddresses(name string) ([]*net.IPNet, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("网卡%s不存在", name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+	var list []*net.IPNet
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if ok && ipNet.IP.IsGlobalUnicast() {
+			list = append(list, ipNet)
+		}
+	}
+	return list, nil
+}
+
+// InterfaceByAddress 地址所在的网卡
+func InterfaceByAddress(ip net.IP) (string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, iface := range interfaces {
+		addrs, _ := iface.Addrs()
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("未找到地址%s所在的网卡(%s)", ip, interfaceSummary())
+}
+
+// AdvertiseAddress 检测节点对外地址，iface为空时使用默认路由所在网卡，IPv4优先，
+// 忽略exclude中的地址(如高可用虚拟IP)，网卡上存在多个不同网段的同族地址时返回错误
+func AdvertiseAddress(iface string, exclude ...string) (string, error) {
+	ipv6 := false
+	if iface == "" {
+		route, err := DefaultRoute()
+		if err != nil {
+			if route, err = DefaultRoute6(); err != nil {
+				return "", fmt.Errorf("未找到默认路由，请通过--interface或--advertise-address指定(%s)", interfaceSummary())
+			}
+			ipv6 = true
+		}
+		iface = route.Interface
+	}
+
+	addrs, err := InterfaceAddresses(iface)
+	if err != nil {
+		return "", err
+	}
+	var v4, v6 []*net.IPNet
+	for _, addr := range addrs {
+		if slices.ContainsFunc(exclude, func(ip string) bool { return addr.IP.Equal(net.ParseIP(ip)) }) {
+			continue
+		}
+		if addr.IP.To4() != nil {
+			v4 = append(v4, addr)
+		} else {
+			v6 = append(v6, addr)
+		}
+	}
+	candidates := v4
+	if ipv6 || len(v4) == 0 {
+		candidates = v6
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("网卡%s没有可用的IP地址，请通过--interface或--advertise-address指定(%s)", iface, interfaceSummary())
+	}
+	return primaryAddress(iface, candidates)
+}
+
+// primaryAddress 从同族地址中选出网卡的主地址，addrs按内核返回顺序排列。
+// 虚拟IP通常以/32、/128单独添加，存在其他地址时忽略；同一网段的后续地址为从地址，取首个地址
+func primaryAddress(iface string, addrs []*net.IPNet) (string, error) {
+	var list []*net.IPNet
+	for _, addr := range addrs {
+		if ones, bits := addr.Mask.Size(); ones != bits {
+			list = append(list, addr)
+		}
+	}
+	if len(list) == 0 {
+		list = addrs
+	}
+
+	primary := list[0]
+	for _, addr := range list[1:] {
+		if !primary.Contains(addr.IP) {
+			var names []string
+			for _, addr := range list {
+				names = append(names, addr.IP.String())
+			}
+			return "", fmt.Errorf("网卡%s存在多个地址(%s)，请通过--advertise-address指定", iface, strings.Join(names, ", "))
+		}
+	}
+	return primary.IP.String(), nil
+}
+
+// interfaceSummary 网卡及地址摘要，用于错误提示
+func interfaceSummary() string {
+	interfaces, err := NetInterfaces()
+	if err != nil {
+		return err.Error()
+	}
+	var list []string
+	for _, nic := range interfaces {
+		if nic.Up && len(nic.Addrs) > 0 {
+			list = append(list, nic.Name+"="+strings.Join(nic.Addrs, ","))
+		}
+	}
+	if len(list) == 0 {
+		return "无可用网卡"
+	}
+	return "可用网卡: " + strings.Join(list, "; ")
+}
@@ -0,0 +1,44 @@
+package system
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPrimaryAddress(t *testing.T) {
+	tests := []struct {
+		name    string
+		addrs   []string
+		want    string
+		wantErr bool
+	}{
+		{name: "单个地址", addrs: []string{"192.168.1.10/24"}, want: "192.168.1.10"},
+		{name: "忽略/32虚拟IP", addrs: []string{"192.168.1.10/24", "192.168.1.100/32"}, want: "192.168.1.10"},
+		{name: "虚拟IP先于主地址", addrs: []string{"192.168.1.100/32", "192.168.1.10/24"}, want: "192.168.1.10"},
+		{name: "同网段从地址", addrs: []string{"192.168.1.10/24", "192.168.1.100/24"}, want: "192.168.1.10"},
+		{name: "仅有/32地址", addrs: []string{"10.0.0.5/32"}, want: "10.0.0.5"},
+		{name: "IPv6忽略/128地址", addrs: []string{"fd00::10/64", "fd00::100/128"}, want: "fd00::10"},
+		{name: "多个网段", addrs: []string{"192.168.1.10/24", "10.0.0.10/8"}, wantErr: true},
+		{name: "多个/32地址", addrs: []string{"10.0.0.5/32", "10.0.0.6/32"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var addrs []*net.IPNet
+			for _, cidr := range tt.addrs {
+				ip, ipNet, err := net.ParseCIDR(cidr)
+				if err != nil {
+					t.Fatal(err)
+				}
+				ipNet.IP = ip
+				addrs = append(addrs, ipNet)
+			}
+			got, err := primaryAddress("eth0", addrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("primaryAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("primaryAddress() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,394 @@
+package system
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+)
+
+// Package 软件包
+type Package struct {
+	Name    string // 包名
+	Version string // 版本号，为空时安装最新版本，可省略发行号(如1.27.6)
+}
+
+// Packages 按包名构造软件包列表
+func Packages(names ...string) []Package {
+	list := make([]Package, 0, len(names))
+	for _, name := range names {
+		list = append(list, Package{Name: name})
+	}
+	return list
+}
+
+// Repo 软件仓库
+type Repo struct {
+	Name       string   // 仓库名称，用作仓库文件名
+	BaseURL    string   // 仓库地址
+	Suite      string   // apt发行版代号，如kubernetes-xenial，为"/"时表示扁平仓库
+	Components []string // apt组件，默认为main，扁平仓库不使用组件
+	GPGKey     string   // 签名公钥地址，为空时不校验签名
+	RepoFile   string   // 远程仓库定义文件地址(如docker-ce.repo)，设置后忽略BaseURL
+}
+
+// PackageManager 包管理器
+type PackageManager interface {
+	// Name 包管理器名称
+	Name() string
+	// Install 安装软件包
+	Install(packages ...Package) error
+	// Remove 卸载软件包
+	Remove(names ...string) error
+	// Refresh 刷新软件源缓存
+	Refresh() error
+	// Upgrade 升级系统软件包
+	Upgrade() error
+	// AddRepo 添加软件仓库
+	AddRepo(repo Repo) error
+	// ImportKey 导入签名公钥
+	ImportKey(name, url string) error
+	// Hold 锁定软件包版本
+	Hold(names ...string) error
+	// Unhold 解除软件包版本锁定
+	Unhold(names ...string) error
+	// Versions 软件源中可用的版本，新版本在前
+	Versions(name string) ([]string, error)
+}
+
+// GetPackageManager 当前发行版的包管理器
+func GetPackageManager() (PackageManager, error) {
+	switch System.LinuxDistroFamily {
+	case FamilyRHEL:
+		if pkg.FileExists("/usr/bin/dnf") {
+			return dnf{rpmManager{name: "dnf"}}, nil
+		}
+		return yum{rpmManager{name: "yum"}}, nil
+	case FamilyDebian:
+		return apt{}, nil
+	case FamilySUSE:
+		return zypper{}, nil
+	}
+	return nil, fmt.Errorf("不支持的Linux发行版: %s", System.LinuxDistro)
+}
+
+// ResolveVersion 从软件源中查找与version匹配的完整版本号，找不到时原样返回
+func ResolveVersion(pm PackageManager, name, version string) string {
+	if version == "" {
+		return ""
+	}
+	versions, err := pm.Versions(name)
+	if err != nil {
+		return version
+	}
+	for _, v := range versions {
+		if v == version || strings.HasPrefix(v, version+"-") {
+			return v
+		}
+	}
+	return version
+}
+
+// rpmRepoFile 生成yum/dnf/zypper仓库文件
+func rpmRepoFile(repo Repo) []byte {
+	gpgCheck := 0
+	if repo.GPGKey != "" {
+		gpgCheck = 1
+	}
+	content := fmt.Sprintf(`[%s]
+name=%s
+baseurl=%s
+enabled=1
+gpgcheck=%d
+repo_gpgcheck=0
+`, repo.Name, repo.Name, repo.BaseURL, gpgCheck)
+	if repo.GPGKey != "" {
+		content += "gpgkey=" + repo.GPGKey + "\n"
+	}
+	return []byte(content)
+}
+
+// rpmManager yum/dnf公共实现
+type rpmManager struct {
+	name string
+}
+
+func (r rpmManager) Name() string {
+	return r.name
+}
+
+func (r rpmManager) Install(packages ...Package) error {
+	args := []string{"install", "-y"}
+	for _, p := range packages {
+		if p.Version == "" {
+			args = append(args, p.Name)
+		} else if strings.Contains(p.Version, "-") {
+			args = append(args, p.Name+"-"+p.Version)
+		} else {
+			args = append(args, p.Name+"-"+p.Version+"*")
+		}
+	}
+	return pkg.ExecCmd(exec.Command(r.name, args...))
+}
+
+func (r rpmManager) Remove(names ...string) error {
+	return pkg.ExecCmd(exec.Command(r.name, append([]string{"remove", "-y"}, names...)...))
+}
+
+func (r rpmManager) Refresh() error {
+	if err := pkg.ExecCmd(exec.Command(r.name, "clean", "all")); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(exec.Command(r.name, "makecache"))
+}
+
+func (r rpmManager) Upgrade() error {
+	return pkg.ExecCmd(exec.Command(r.name, "update", "-y"))
+}
+
+func (r rpmManager) AddRepo(repo Repo) error {
+	repoPath := fmt.Sprintf("/etc/yum.repos.d/%s.repo", repo.Name)
+	if repo.RepoFile != "" {
+		return pkg.ExecCmd(exec.Command("curl", "-fsSL", "-o", repoPath, repo.RepoFile))
+	}
+	return pkg.WriteFile(repoPath, rpmRepoFile(repo), 0644)
+}
+
+func (r rpmManager) ImportKey(_, url string) error {
+	return pkg.ExecCmd(exec.Command("rpm", "--import", url))
+}
+
+func (r rpmManager) Hold(names ...string) error {
+	return pkg.ExecCmd(exec.Command(r.name, append([]string{"versionlock", "add"}, names...)...))
+}
+
+func (r rpmManager) Unhold(names ...string) error {
+	return pkg.ExecCmd(exec.Command(r.name, append([]string{"versionlock", "delete"}, names...)...))
+}
+
+func (r rpmManager) Versions(name string) ([]string, error) {
+	out, err := pkg.CmdOutput(exec.Command(r.name, "list", "--showduplicates", "--quiet", name))
+	if err != nil {
+		return nil, err
+	}
+
+	// 输出格式: kubeadm.x86_64    1.27.6-0    kubernetes
+	var versions []string
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], name+".") {
+			continue
+		}
+		version := fields[1]
+		if _, v, ok := strings.Cut(version, ":"); ok {
+			version = v
+		}
+		versions = append([]string{version}, versions...)
+	}
+	return versions, nil
+}
+
+// yum CentOS 7等旧版本
+type yum struct {
+	rpmManager
+}
+
+func (y yum) Hold(names ...string) error {
+	if err := pkg.ExecCmd(exec.Command("yum", "install", "-y", "yum-plugin-versionlock")); err != nil {
+		return err
+	}
+	return y.rpmManager.Hold(names...)
+}
+
+// dnf RHEL 8+、Rocky、AlmaLinux、openEuler、Fedora等
+type dnf struct {
+	rpmManager
+}
+
+func (d dnf) Hold(names ...string) error {
+	if err := pkg.ExecCmd(exec.Command("dnf", "install", "-y", "python3-dnf-plugin-versionlock")); err != nil {
+		return err
+	}
+	return d.rpmManager.Hold(names...)
+}
+
+// apt Debian/Ubuntu
+type apt struct{}
+
+// aptKeyringPath apt签名公钥路径
+func aptKeyringPath(name string) string {
+	return fmt.Sprintf("/etc/apt/keyrings/%s.gpg", name)
+}
+
+func (apt) Name() string {
+	return "apt"
+}
+
+func (apt) Install(packages ...Package) error {
+	args := []string{"install", "-y"}
+	for _, p := range packages {
+		if p.Version == "" {
+			args = append(args, p.Name)
+		} else if strings.Contains(p.Version, "-") {
+			args = append(args, p.Name+"="+p.Version)
+		} else {
+			args = append(args, p.Name+"="+p.Version+"-*")
+		}
+	}
+	cmd := exec.Command("apt-get", args...)
+	cmd.Env = append(cmd.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	return pkg.ExecCmd(cmd)
+}
+
+func (apt) Remove(names ...string) error {
+	return pkg.ExecCmd(exec.Command("apt-get", append([]string{"remove", "-y"}, names...)...))
+}
+
+func (apt) Refresh() error {
+	return pkg.ExecCmd(exec.Command("apt-get", "update"))
+}
+
+func (apt) Upgrade() error {
+	cmd := exec.Command("apt-get", "upgrade", "-y")
+	cmd.Env = append(cmd.Environ(), "DEBIAN_FRONTEND=noninteractive")
+	return pkg.ExecCmd(cmd)
+}
+
+func (apt) AddRepo(repo Repo) error {
+	components := repo.Components
+	if len(components) == 0 && !strings.HasSuffix(repo.Suite, "/") {
+		components = []string{"main"}
+	}
+	options := []string{"arch=" + System.Arch}
+	if repo.GPGKey != "" {
+		options = append(options, "signed-by="+aptKeyringPath(repo.Name))
+	} else {
+		options = append(options, "trusted=yes")
+	}
+	return pkg.WriteFile(
+		fmt.Sprintf("/etc/apt/sources.list.d/%s.list", repo.Name),
+		[]byte(fmt.Sprintf(
+			"%s\n",
+			strings.TrimSpace(fmt.Sprintf(
+				"deb [%s] %s %s %s",
+				strings.Join(options, " "),
+				repo.BaseURL,
+				repo.Suite,
+				strings.Join(components, " "),
+			)),
+		)),
+		0644,
+	)
+}
+
+func (apt) ImportKey(name, url string) error {
+	if err := pkg.MkdirAll("/etc/apt/keyrings", 0755); err != nil {
+		return err
+	}
+	return pkg.ExecCmd(exec.Command(
+		"/bin/bash",
+		"-c",
+		fmt.Sprintf("curl -fsSL %s | gpg --dearmor --yes -o %s", url, aptKeyringPath(name)),
+	))
+}
+
+func (apt) Hold(names ...string) error {
+	return pkg.ExecCmd(exec.Command("apt-mark", append([]string{"hold"}, names...)...))
+}
+
+func (apt) Unhold(names ...string) error {
+	return pkg.ExecCmd(exec.Command("apt-mark", append([]string{"unhold"}, names...)...))
+}
+
+func (apt) Versions(name string) ([]string, error) {
+	out, err := pkg.CmdOutput(exec.Command("apt-cache", "madison", name))
+	if err != nil {
+		return nil, err
+	}
+
+	// 输出格式: kubeadm | 1.27.6-00 | https://mirrors.aliyun.com/kubernetes/apt kubernetes-xenial/main amd64 Packages
+	var versions []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) >= 3 {
+			versions = append(versions, strings.TrimSpace(fields[1]))
+		}
+	}
+	return versions, nil
+}
+
+// zypper openSUSE/SLES
+type zypper struct{}
+
+func (zypper) Name() string {
+	return "zypper"
+}
+
+func (zypper) run(args ...string) error {
+	return pkg.ExecCmd(exec.Command("zypper", append([]string{"--non-interactive"}, args...)...))
+}
+
+func (z zypper) Install(packages ...Package) error {
+	args := []string{"install"}
+	for _, p := range packages {
+		if p.Version == "" {
+			args = append(args, p.Name)
+		} else {
+			args = append(args, p.Name+"="+p.Version)
+		}
+	}
+	return z.run(args...)
+}
+
+func (z zypper) Remove(names ...string) error {
+	return z.run(append([]string{"remove"}, names...)...)
+}
+
+func (z zypper) Refresh() error {
+	return z.run("refresh")
+}
+
+func (z zypper) Upgrade() error {
+	return z.run("update")
+}
+
+func (zypper) AddRepo(repo Repo) error {
+	repoPath := fmt.Sprintf("/etc/zypp/repos.d/%s.repo", repo.Name)
+	if repo.RepoFile != "" {
+		return pkg.ExecCmd(exec.Command("curl", "-fsSL", "-o", repoPath, repo.RepoFile))
+	}
+	return pkg.WriteFile(repoPath, rpmRepoFile(repo), 0644)
+}
+
+func (zypper) ImportKey(_, url string) error {
+	return pkg.ExecCmd(exec.Command("rpm", "--import", url))
+}
+
+func (z zypper) Hold(names ...string) error {
+	return z.run(append([]string{"addlock"}, names...)...)
+}
+
+func (z zypper) Unhold(names ...string) error {
+	return z.run(append([]string{"removelock"}, names...)...)
+}
+
+func (zypper) Versions(name string) ([]string, error) {
+	out, err := pkg.CmdOutput(exec.Command("zypper", "--quiet", "search", "-s", "--match-exact", name))
+	if err != nil {
+		return nil, err
+	}
+
+	// 输出格式: v | kubeadm | package | 1.27.6-0 | x86_64 | kubernetes
+	var versions []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) >= 4 && strings.TrimSpace(fields[1]) == name {
+			versions = append(versions, strings.TrimSpace(fields[3]))
+		}
+	}
+	return versions, nil
+}
@@ -0,0 +1,73 @@
+package system
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/dysodeng/devops-tools/internal/pkg"
+	"github.com/spf13/cobra"
+)
+
+// Requirement 命令执行要求
+type Requirement string
+
+const (
+	RequireHostInfo Requirement = "host"  // 需要主机信息
+	RequireLinux    Requirement = "linux" // 需要在Linux上执行，同时采集主机信息
+	RequireRoot     Requirement = "root"  // 需要root权限，预演模式下不检查
+)
+
+// requirementAnnotation 命令执行要求的注解名
+const requirementAnnotation = "devops/requirements"
+
+var detectOnce sync.Once
+
+// Detect 采集主机信息，仅在首次调用时执行
+func Detect() {
+	detectOnce.Do(func() {
+		System = systemInfo()
+	})
+}
+
+// Require 声明命令的执行要求
+func Require(cmd *cobra.Command, requirements ...Requirement) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	list := strings.Fields(cmd.Annotations[requirementAnnotation])
+	for _, requirement := range requirements {
+		list = append(list, string(requirement))
+	}
+	cmd.Annotations[requirementAnnotation] = strings.Join(list, " ")
+}
+
+// requirements 命令及其父命令声明的执行要求
+func requirements(cmd *cobra.Command) map[Requirement]bool {
+	list := map[Requirement]bool{}
+	for c := cmd; c != nil; c = c.Parent() {
+		for _, requirement := range strings.Fields(c.Annotations[requirementAnnotation]) {
+			list[Requirement(requirement)] = true
+		}
+	}
+	return list
+}
+
+// CheckRequirements 检查命令的执行要求，并按需采集主机信息
+func CheckRequirements(cmd *cobra.Command) error {
+	list := requirements(cmd)
+	if len(list) == 0 {
+		return nil
+	}
+
+	Detect()
+
+	if list[RequireLinux] && System.OS != "linux" {
+		return errors.New("the operating system needs to be Linux")
+	}
+	if list[RequireRoot] && !pkg.IsDryRun() && !pkg.IsRoot() {
+		return errors.New("root permission is required to execute")
+	}
+
+	return nil
+}
@@ -3,6 +3,7 @@ package system
 import (
 	"errors"
 	"fmt"
+	"github.com/dysodeng/devops-tools/internal/module/mirror"
 	"github.com/dysodeng/devops-tools/internal/pkg"
 	"github.com/spf13/cobra"
 	"log"
@@ -11,6 +12,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"text/tabwriter"
 )
 
 var ArchMap = map[string]string{
@@ -20,22 +22,23 @@ var ArchMap = map[string]string{
 
 // system 操作系统信息
 type system struct {
-	OS                   string // 操作系统类型
-	Arch                 string // 平台架构
-	LinuxDistro          string // Linux发行版名称
-	LinuxDistroVersion   string // Linux发行版(full版本号)
-	LinuxKernel          string // Linux内核版本
-	LinuxKernelMasterNum int    // Linux内核主要版本
-	CodeName             string // Linux发行版代号
-	CpuCores             int    // Cpu核心数
+	OS                   string `json:"os" yaml:"os"`                                                   // 操作系统类型
+	Arch                 string `json:"arch" yaml:"arch"`                                               // 平台架构
+	LinuxDistro          string `json:"distro,omitempty" yaml:"distro,omitempty"`                       // Linux发行版名称
+	LinuxDistroID        string `json:"distro_id,omitempty" yaml:"distro_id,omitempty"`                 // Linux发行版ID(os-release ID)
+	LinuxDistroFamily    Family `json:"distro_family,omitempty" yaml:"distro_family,omitempty"`         // Linux发行版家族
+	LinuxDistroVersion   string `json:"distro_version,omitempty" yaml:"distro_version,omitempty"`       // Linux发行版(full版本号)
+	LinuxDistroVersionID string `json:"distro_version_id,omitempty" yaml:"distro_version_id,omitempty"` // Linux发行版版本号
+	LinuxDistroMajorNum  int    `json:"-" yaml:"-"`                                                     // Linux发行版主要版本
+	LinuxKernel          string `json:"kernel,omitempty" yaml:"kernel,omitempty"`                       // Linux内核版本
+	LinuxKernelMasterNum int    `json:"-" yaml:"-"`                                                     // Linux内核主要版本
+	CodeName             string `json:"codename,omitempty" yaml:"codename,omitempty"`                   // Linux发行版代号
+	CpuCores             int    `json:"cpus" yaml:"cpus"`                                               // Cpu核心数
 }
 
+// System 主机信息，在命令声明RequireHostInfo/RequireLinux后由CheckRequirements采集
 var System = system{}
 
-func init() {
-	systemInfo()
-}
-
 var Cmd = &cobra.Command{
 	Use:   "system",
 	Short: "操作系统配置",
@@ -45,33 +48,79 @@ var Cmd = &cobra.Command{
 	},
 }
 
+// infoOutput 系统信息输出格式
+var infoOutput string
+
 var infoCmd = &cobra.Command{
 	Use:   "info",
 	Short: "系统信息",
 	Long:  "系统信息",
 	Run: func(cmd *cobra.Command, args []string) {
-		// 获取当前操作系统
-		tablePrefix := "\t"
-		if System.OS == "linux" {
-			tablePrefix = "\t\t"
-		}
-		fmt.Println("---------- 系统信息 ----------")
-		fmt.Printf("OS:%s%s\n", tablePrefix, System.OS)
-		fmt.Printf("Arch:%s%s\n", tablePrefix, System.Arch)
-		if System.OS == "linux" {
-			fmt.Printf("Linux Dist:\t%s\n", System.LinuxDistroVersion)
-			fmt.Printf("Linux Kernel:\t%s\n", System.LinuxKernel)
+		facts := CollectFacts()
+		if infoOutput != pkg.OutputTable {
+			if err := pkg.PrintStructured(os.Stdout, infoOutput, facts); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+			return
 		}
-		fmt.Printf("Cpus:%s%d\n", tablePrefix, System.CpuCores)
+		printFactsTable(facts)
 	},
 }
 
+// printFactsTable 以表格形式输出系统信息
+func printFactsTable(facts Facts) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	defer func() {
+		_ = w.Flush()
+	}()
+
+	_, _ = fmt.Fprintln(w, "---------- 系统信息 ----------")
+	_, _ = fmt.Fprintf(w, "OS:\t%s\n", facts.OS)
+	_, _ = fmt.Fprintf(w, "Arch:\t%s\n", facts.Arch)
+	_, _ = fmt.Fprintf(w, "Hostname:\t%s\n", facts.Hostname)
+	if facts.OS == "linux" {
+		_, _ = fmt.Fprintf(w, "Linux Dist:\t%s (%s)\n", facts.LinuxDistroVersion, facts.LinuxDistroFamily)
+		_, _ = fmt.Fprintf(w, "Linux Kernel:\t%s\n", facts.LinuxKernel)
+	}
+	_, _ = fmt.Fprintf(w, "Cpus:\t%d\n", facts.CpuCores)
+	if facts.OS != "linux" {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "Memory:\t%s (available %s)\n", pkg.HumanSize(facts.Memory.Total), pkg.HumanSize(facts.Memory.Available))
+	_, _ = fmt.Fprintf(w, "Swap:\t%s (on: %t)\n", pkg.HumanSize(facts.Memory.SwapTotal), facts.Memory.SwapOn)
+	for _, disk := range facts.Disks {
+		_, _ = fmt.Fprintf(w, "Disk:\t%s %s %s\n", disk.Name, pkg.HumanSize(disk.Size), disk.Model)
+	}
+	for _, mount := range facts.Mounts {
+		_, _ = fmt.Fprintf(
+			w,
+			"Mount:\t%s %s %s (available %s/%s)\n",
+			mount.MountPoint, mount.FSType, mount.Device, pkg.HumanSize(mount.Available), pkg.HumanSize(mount.Size),
+		)
+	}
+	for _, nic := range facts.Interfaces {
+		_, _ = fmt.Fprintf(w, "NIC:\t%s mtu=%d mac=%s up=%t %s\n", nic.Name, nic.MTU, nic.MAC, nic.Up, strings.Join(nic.Addrs, ","))
+	}
+	if facts.DefaultRoute != nil {
+		_, _ = fmt.Fprintf(w, "Default Route:\t%s via %s\n", facts.DefaultRoute.Interface, facts.DefaultRoute.Gateway)
+	}
+	_, _ = fmt.Fprintf(w, "Cgroup:\tv%d\n", facts.CgroupVersion)
+	_, _ = fmt.Fprintf(w, "SELinux:\t%s\n", facts.Security.SELinux)
+	_, _ = fmt.Fprintf(w, "AppArmor:\t%s\n", facts.Security.AppArmor)
+	_, _ = fmt.Fprintf(w, "Firewall:\t%s %s\n", facts.Firewall.Service, facts.Firewall.IptablesMode)
+	_, _ = fmt.Fprintf(w, "Time Sync:\t%s (synchronized: %t)\n", facts.TimeSync.Service, facts.TimeSync.Synchronized)
+	_, _ = fmt.Fprintf(w, "Machine ID:\t%s\n", facts.MachineID)
+	_, _ = fmt.Fprintf(w, "Product UUID:\t%s\n", facts.ProductUUID)
+}
+
 var toolCmd = &cobra.Command{
 	Use:   "tool",
 	Short: "安装系统必要的工具",
 	Long:  "安装系统必要的工具",
 	Run: func(cmd *cobra.Command, args []string) {
-		err := toolInstall(System.LinuxDistro)
+		err := toolInstall()
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
@@ -84,19 +133,13 @@ var (
 	initWithDefaultSource bool
 )
 
-const (
-	initWithCentOSDefaultSource string = "https://mirrors.aliyun.com/repo/Centos-7.repo"
-	initWithUbuntuDefaultSource string = ""
-	initWithDebianDefaultSource string = ""
-)
-
 var initCmd = &cobra.Command{
 	Use:   "init",
 	Short: "系统初始化",
 	Long:  "系统初始化",
 	Run: func(cmd *cobra.Command, args []string) {
 		// 更换软件源
-		err := changeSource(System.LinuxDistro, initWithDefaultSource, initWithSource)
+		err := changeSource(System.LinuxDistroFamily, initWithDefaultSource, initWithSource)
 		if err != nil {
 			fmt.Println(err.Error())
 			os.Exit(1)
@@ -104,7 +147,7 @@ var initCmd = &cobra.Command{
 
 		// 升级Linux内核版本
 		if System.LinuxKernelMasterNum < 4 {
-			err = upgradeLinuxKernel(System.LinuxDistro)
+			err = upgradeLinuxKernel(System.LinuxDistroFamily)
 			if err != nil {
 				fmt.Println(err.Error())
 				os.Exit(1)
@@ -114,8 +157,12 @@ var initCmd = &cobra.Command{
 }
 
 func InitSystemCmd() {
-	initCmd.Flags().BoolVarP(&initWithDefaultSource, "default-source", "", false, "default-source")
-	initCmd.Flags().StringVarP(&initWithSource, "source", "", "", "source")
+	Require(infoCmd, RequireHostInfo)
+	infoCmd.Flags().StringVarP(&infoOutput, "output", "o", pkg.OutputTable, "输出格式: table|json|yaml")
+	Require(toolCmd, RequireLinux, RequireRoot)
+	Require(initCmd, RequireLinux, RequireRoot)
+	initCmd.Flags().BoolVarP(&initWithDefaultSource, "default-source", "", false, "使用--mirror所选镜像源")
+	initCmd.Flags().StringVarP(&initWithSource, "source", "", "", "软件源，CentOS为.repo文件地址，Ubuntu/Debian为镜像地址(如https://mirrors.ustc.edu.cn/ubuntu/)")
 	Cmd.AddCommand(
 		infoCmd,
 		toolCmd,
@@ -124,182 +171,123 @@ func InitSystemCmd() {
 }
 
 // systemInfo 获取操作系统信息
-func systemInfo() {
-	osType := runtime.GOOS
-	var linuxDistro, linuxDistroVersion, linuxCodeName, linuxKernel string
-	var linuxKernelMasterNum int
-
-	if osType != "linux" {
-		log.Println("The operating system needs to be Linux")
-		os.Exit(1)
+func systemInfo() system {
+	info := system{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		CpuCores: runtime.NumCPU(),
 	}
-
-	if !pkg.IsRoot() {
-		log.Println("root permission is required to execute.")
-		os.Exit(1)
+	if info.OS != "linux" {
+		return info
 	}
 
-sysInfo:
-
 	// 获取linux发行版本
-	distroCmd := exec.Command("lsb_release", "-a")
-	distroOutput, err := distroCmd.Output()
-	if err == nil {
-		list := strings.Split(string(distroOutput), "\n")
-		for _, out := range list {
-			if strings.Contains(out, "Distributor ID:") {
-				linuxDistro = strings.TrimSpace(strings.Replace(out, "Distributor ID:", "", -1))
-			}
-			if strings.Contains(out, "Description:") {
-				linuxDistroVersion = strings.TrimSpace(strings.Replace(out, "Description:", "", -1))
-			}
-			if strings.Contains(out, "Codename:") {
-				linuxCodeName = strings.TrimSpace(strings.Replace(out, "Codename:", "", -1))
-			}
-		}
-	} else {
-		if errors.Is(err, exec.ErrNotFound) {
-			// 安装 lsb_release
-			for _, o := range []string{"CentOS", "Ubuntu", "Debian"} {
-				switch o {
-				case "CentOS":
-					installLsbReleaseCmd := exec.Command("yum", "-y", "install", "redhat-lsb")
-					err = pkg.ExecCmd(installLsbReleaseCmd)
-					if err == nil {
-						goto sysInfo
-					}
-
-				default:
-					installLsbReleaseCmd := exec.Command("apt", "-y", "install", "lsb-release")
-					err = pkg.ExecCmd(installLsbReleaseCmd)
-					if err == nil {
-						goto sysInfo
-					}
-				}
-			}
-		}
+	release, err := readOSRelease()
+	if err != nil {
+		log.Printf("failed to read os-release: %v", err)
 	}
+	info.LinuxDistro = release.Distro()
+	info.LinuxDistroID = release.ID
+	info.LinuxDistroFamily = release.Family()
+	info.LinuxDistroVersion = release.PrettyName
+	info.LinuxDistroVersionID = release.VersionID
+	info.LinuxDistroMajorNum = release.MajorVersion()
+	info.CodeName = release.VersionCodename
 
 	// 获取linux内核版本
-	kernelCmd := exec.Command("uname", "-r")
-	kernelOutput, err := kernelCmd.Output()
-	if err == nil {
-		linuxKernel = strings.TrimSpace(string(kernelOutput))
-		kernel := strings.Split(linuxKernel, ".")
+	kernelOutput, err := pkg.CmdOutput(exec.Command("uname", "-r"))
+	if err == nil && len(kernelOutput) > 0 {
+		info.LinuxKernel = strings.TrimSpace(string(kernelOutput))
+		kernel := strings.Split(info.LinuxKernel, ".")
 		kernelNum, err := strconv.ParseInt(kernel[0], 10, 64)
 		if err == nil {
-			linuxKernelMasterNum = int(kernelNum)
+			info.LinuxKernelMasterNum = int(kernelNum)
 		}
 	}
 
-	System = system{
-		OS:                   osType,
-		Arch:                 runtime.GOARCH,
-		LinuxDistro:          linuxDistro,
-		LinuxDistroVersion:   linuxDistroVersion,
-		LinuxKernel:          linuxKernel,
-		LinuxKernelMasterNum: linuxKernelMasterNum,
-		CodeName:             linuxCodeName,
-		CpuCores:             runtime.NumCPU(),
-	}
+	return info
 }
 
 // toolInstall 工具安装
-func toolInstall(linuxDistro string) error {
-	var err error
-	switch linuxDistro {
-	case "CentOS":
-		err = pkg.ExecCmd(exec.Command("yum", "install", "-y", "wget", "curl", "vim", "net-tools"))
-		break
-	case "Ubuntu":
-		err = pkg.ExecCmd(exec.Command("apt", "install", "-y", "wget", "curl", "vim", "net-tools"))
-		break
-	case "Debian":
-		err = pkg.ExecCmd(exec.Command("apt", "install", "-y", "wget", "curl", "vim", "net-tools"))
-		break
-	default:
-		err = errors.New("不支持的Linux发行版")
-	}
-	return err
-}
-
-func cleanSystemSource(linuxDistro string) error {
-	var err error
-
-	switch linuxDistro {
-	case "CentOS":
-		err = pkg.ExecCmd(exec.Command("yum", "clean", "all"))
-		if err != nil {
-			return err
-		}
-		err = pkg.ExecCmd(exec.Command("yum", "makecache"))
-		if err != nil {
-			return err
-		}
-		break
-
-	case "Ubuntu":
-		break
-
-	case "Debian":
-		break
+func toolInstall() error {
+	pm, err := GetPackageManager()
+	if err != nil {
+		return err
 	}
-
-	return nil
+	return pm.Install(Packages("wget", "curl", "vim", "net-tools")...)
 }
 
-// changeSource 更换软件源
-func changeSource(linuxDistro string, isDefaultSource bool, customSource string) error {
+// changeSource 更换软件源，isDefaultSource为true时使用--mirror所选镜像源
+func changeSource(family Family, isDefaultSource bool, customSource string) error {
 	var descSource string
-	if !isDefaultSource {
-		descSource = customSource
-	}
+	var centOSRepo []byte
 	if isDefaultSource {
-		switch linuxDistro {
-		case "CentOS":
-			descSource = initWithCentOSDefaultSource
+		profile := mirror.Current()
+		switch family {
+		case FamilyRHEL:
+			centOSRepo = profile.CentOSRepo()
+			descSource = profile.CentOS
 			break
-		case "Ubuntu":
-			descSource = initWithUbuntuDefaultSource
-			break
-		case "Debian":
-			descSource = initWithDebianDefaultSource
+		case FamilyDebian:
+			if System.LinuxDistro == DistroUbuntu {
+				descSource = profile.UbuntuMirror(System.Arch)
+			} else {
+				descSource = profile.Debian
+			}
 			break
 		}
 	} else {
 		descSource = customSource
 	}
 
-	var err error
 	if descSource == "" {
 		return nil
 	}
 
-	switch linuxDistro {
-	case "CentOS":
-		err = pkg.ExecCmd(exec.Command("mv", "/etc/yum.repos.d/CentOS-Base.repo", "/etc/yum.repos.d/CentOS-Base.repo.bak"))
+	pm, err := GetPackageManager()
+	if err != nil {
+		return err
+	}
+
+	switch family {
+	case FamilyRHEL:
+		// 默认源仅适用于CentOS 7
+		if System.LinuxDistro != DistroCentOS {
+			return fmt.Errorf("暂不支持更换%s软件源", System.LinuxDistro)
+		}
+
+		err = pkg.BackupFile("/etc/yum.repos.d/CentOS-Base.repo")
 		if err != nil {
 			return err
 		}
 
-		err = pkg.ExecCmd(exec.Command("wget", "-O", "/etc/yum.repos.d/CentOS-Base.repo", descSource))
+		if centOSRepo != nil {
+			err = pkg.WriteFile("/etc/yum.repos.d/CentOS-Base.repo", centOSRepo, 0644)
+		} else {
+			err = pkg.ExecCmd(exec.Command("wget", "-O", "/etc/yum.repos.d/CentOS-Base.repo", descSource))
+		}
 		if err != nil {
 			return err
 		}
-		err = cleanSystemSource(linuxDistro)
+		err = pm.Refresh()
 		if err != nil {
 			return err
 		}
-		err = pkg.ExecCmd(exec.Command("yum", "update", "-y"))
+		err = pm.Upgrade()
 		if err != nil {
 			return err
 		}
 		break
 
-	case "Ubuntu":
-		break
-
-	case "Debian":
+	case FamilyDebian:
+		err = changeAptSource(descSource)
+		if err != nil {
+			return err
+		}
+		err = pm.Refresh()
+		if err != nil {
+			return err
+		}
 		break
 
 	default:
@@ -310,56 +298,40 @@ func changeSource(linuxDistro string, isDefaultSource bool, customSource string)
 }
 
 // upgradeLinuxKernel 升级Linux内核版本
-func upgradeLinuxKernel(linuxDistro string) error {
-	var err error
-	switch linuxDistro {
-	case "CentOS":
-
-		// 内核源
-		err = elrepo()
-		if err != nil {
-			return err
-		}
-
-		err = cleanSystemSource(linuxDistro)
-		if err != nil {
-			return err
-		}
+func upgradeLinuxKernel(family Family) error {
+	// 仅CentOS 7等el7发行版内核低于4.x，通过elrepo升级
+	if family != FamilyRHEL {
+		return nil
+	}
 
-		err = pkg.ExecCmd(exec.Command("yum", "install", "-y", "kernel-lt-5.4.262"))
-		if err != nil {
-			return err
-		}
-		err = pkg.ExecCmd(exec.Command("yum", "install", "-y", "kernel-lt-devel-5.4.262"))
-		if err != nil {
-			return err
-		}
-		_ = pkg.ExecCmd(exec.Command("grub2-set-default", "0"))
-		fmt.Println("内核已更新，重启后生效")
-		break
+	pm, err := GetPackageManager()
+	if err != nil {
+		return err
+	}
 
-	case "Ubuntu":
-		break
+	// 内核源
+	err = pm.AddRepo(Repo{
+		Name:    "elrepo",
+		BaseURL: mirror.Current().ELRepoKernel(7, ArchMap[System.Arch]),
+	})
+	if err != nil {
+		return err
+	}
 
-	case "Debian":
-		break
+	err = pm.Refresh()
+	if err != nil {
+		return err
 	}
-	return err
-}
 
-func elrepo() error {
-	repoFile, err := os.OpenFile("/etc/yum.repos.d/elrepo.repo", os.O_CREATE|os.O_RDWR, 0644)
+	err = pm.Install(
+		Package{Name: "kernel-lt", Version: "5.4.262"},
+		Package{Name: "kernel-lt-devel", Version: "5.4.262"},
+	)
 	if err != nil {
 		return err
 	}
-	defer func() {
-		_ = repoFile.Close()
-	}()
+	_ = pkg.ExecCmd(exec.Command("grub2-set-default", "0"))
+	fmt.Println("内核已更新，重启后生效")
 
-	_, err = repoFile.Write([]byte(`[elrepo]
-name=elrepo
-baseurl=https://mirrors.aliyun.com/elrepo/archive/kernel/el7/x86_64
-gpgcheck=0
-enabled=1`))
-	return err
+	return nil
 }
@@ -0,0 +1,392 @@
+package pkg
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FS 主机文件系统抽象，所有对主机文件的读写都应通过FS进行
+type FS interface {
+	// Path 文件在宿主机上的真实路径
+	Path(name string) string
+	ReadFile(name string) ([]byte, error)
+	// WriteFile 写入文件，不存在的上级目录将被创建
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	MkdirAll(name string, perm os.FileMode) error
+	Rename(oldName, newName string) error
+	Remove(name string) error
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// osFS 以root为根目录的本地文件系统
+type osFS struct {
+	root string
+}
+
+// NewOSFS 本地文件系统，所有路径都将以root为前缀
+func NewOSFS(root string) FS {
+	if root == "" {
+		root = "/"
+	}
+	return osFS{root: filepath.Clean(root)}
+}
+
+func (f osFS) Path(name string) string {
+	return filepath.Join(f.root, filepath.Clean("/"+name))
+}
+
+func (f osFS) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(f.Path(name))
+}
+
+func (f osFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path(name)), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(f.Path(name), data, perm)
+}
+
+func (f osFS) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(f.Path(name), perm)
+}
+
+func (f osFS) Rename(oldName, newName string) error {
+	return os.Rename(f.Path(oldName), f.Path(newName))
+}
+
+func (f osFS) Remove(name string) error {
+	return os.Remove(f.Path(name))
+}
+
+func (f osFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(f.Path(name))
+}
+
+func (f osFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(f.Path(name))
+}
+
+// memFile 内存文件
+type memFile struct {
+	name    string
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (m *memFile) Name() string               { return path.Base(m.name) }
+func (m *memFile) Size() int64                { return int64(len(m.data)) }
+func (m *memFile) Mode() os.FileMode          { return m.mode }
+func (m *memFile) ModTime() time.Time         { return m.modTime }
+func (m *memFile) IsDir() bool                { return m.mode.IsDir() }
+func (m *memFile) Sys() any                   { return nil }
+func (m *memFile) Type() fs.FileMode          { return m.mode.Type() }
+func (m *memFile) Info() (fs.FileInfo, error) { return m, nil }
+
+// MemFS 内存文件系统，用于预演与生成文件的校验
+type MemFS struct {
+	mu    sync.RWMutex
+	files map[string]*memFile
+}
+
+// NewMemFS 内存文件系统
+func NewMemFS() *MemFS {
+	return &MemFS{files: map[string]*memFile{"/": {name: "/", mode: fs.ModeDir | 0755}}}
+}
+
+func memPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+func (m *MemFS) Path(name string) string {
+	return memPath(name)
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if f.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errors.New("is a directory")}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *MemFS) mkdirAll(name string, perm os.FileMode) {
+	for dir := memPath(name); ; dir = path.Dir(dir) {
+		if _, ok := m.files[dir]; !ok {
+			m.files[dir] = &memFile{name: dir, mode: fs.ModeDir | perm.Perm(), modTime: time.Now()}
+		}
+		if dir == "/" {
+			return
+		}
+	}
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	m.mkdirAll(path.Dir(p), 0755)
+	m.files[p] = &memFile{name: p, data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mkdirAll(name, perm)
+	return nil
+}
+
+func (m *MemFS) Rename(oldName, newName string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldPath, newPath := memPath(oldName), memPath(newName)
+	if _, ok := m.files[oldPath]; !ok {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrNotExist}
+	}
+	m.mkdirAll(path.Dir(newPath), 0755)
+	for p, file := range m.files {
+		if p == oldPath || strings.HasPrefix(p, oldPath+"/") {
+			delete(m.files, p)
+			file.name = newPath + strings.TrimPrefix(p, oldPath)
+			m.files[file.name] = file
+		}
+	}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := memPath(name)
+	if _, ok := m.files[p]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, p)
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return f, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dir := memPath(name)
+	if f, ok := m.files[dir]; !ok || !f.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for p, f := range m.files {
+		if p != dir && path.Dir(p) == dir {
+			entries = append(entries, f)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// dryRunFS 预演文件系统，读取宿主机文件，修改仅写入内存并记录为执行步骤
+type dryRunFS struct {
+	mu       sync.Mutex
+	base     FS
+	overlay  *MemFS
+	removed  map[string]bool
+	recorder Recorder
+}
+
+// NewDryRunFS 预演文件系统
+func NewDryRunFS(base FS, recorder Recorder) FS {
+	return &dryRunFS{base: base, overlay: NewMemFS(), removed: map[string]bool{}, recorder: recorder}
+}
+
+func (d *dryRunFS) isRemoved(name string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.removed[memPath(name)]
+}
+
+func (d *dryRunFS) setRemoved(name string, removed bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.removed[memPath(name)] = removed
+}
+
+func (d *dryRunFS) Path(name string) string {
+	return d.base.Path(name)
+}
+
+func (d *dryRunFS) ReadFile(name string) ([]byte, error) {
+	if d.isRemoved(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if data, err := d.overlay.ReadFile(name); err == nil {
+		return data, nil
+	}
+	return d.base.ReadFile(name)
+}
+
+func (d *dryRunFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	d.recorder.Record(Step{Kind: StepWrite, Path: d.Path(name), Data: append([]byte(nil), data...), Perm: perm})
+	d.setRemoved(name, false)
+	return d.overlay.WriteFile(name, data, perm)
+}
+
+func (d *dryRunFS) MkdirAll(name string, perm os.FileMode) error {
+	d.recorder.Record(Step{Kind: StepMkdir, Path: d.Path(name), Perm: perm})
+	d.setRemoved(name, false)
+	return d.overlay.MkdirAll(name, perm)
+}
+
+func (d *dryRunFS) Rename(oldName, newName string) error {
+	info, err := d.Stat(oldName)
+	if err != nil {
+		return err
+	}
+	d.recorder.Record(Step{Kind: StepRename, Path: d.Path(oldName), NewPath: d.Path(newName)})
+	if !info.IsDir() {
+		data, e := d.ReadFile(oldName)
+		if e != nil {
+			return e
+		}
+		_ = d.overlay.WriteFile(newName, data, info.Mode())
+	} else {
+		_ = d.overlay.MkdirAll(newName, info.Mode().Perm())
+	}
+	_ = d.overlay.Remove(oldName)
+	d.setRemoved(oldName, true)
+	d.setRemoved(newName, false)
+	return nil
+}
+
+func (d *dryRunFS) Remove(name string) error {
+	if _, err := d.Stat(name); err != nil {
+		return err
+	}
+	d.recorder.Record(Step{Kind: StepRemove, Path: d.Path(name)})
+	_ = d.overlay.Remove(name)
+	d.setRemoved(name, true)
+	return nil
+}
+
+func (d *dryRunFS) Stat(name string) (fs.FileInfo, error) {
+	if d.isRemoved(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	if info, err := d.overlay.Stat(name); err == nil {
+		return info, nil
+	}
+	return d.base.Stat(name)
+}
+
+func (d *dryRunFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries := map[string]fs.DirEntry{}
+	baseEntries, baseErr := d.base.ReadDir(name)
+	for _, entry := range baseEntries {
+		entries[entry.Name()] = entry
+	}
+	overlayEntries, overlayErr := d.overlay.ReadDir(name)
+	for _, entry := range overlayEntries {
+		entries[entry.Name()] = entry
+	}
+	if baseErr != nil && overlayErr != nil {
+		return nil, baseErr
+	}
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	for entryName, entry := range entries {
+		if !d.isRemoved(path.Join(memPath(name), entryName)) {
+			list = append(list, entry)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+var fileSystem = NewOSFS("/")
+
+// SetFS 设置全局文件系统
+func SetFS(f FS) {
+	fileSystem = f
+}
+
+// HostFS 当前全局文件系统
+func HostFS() FS {
+	return fileSystem
+}
+
+// ReadFile 读取文件
+func ReadFile(name string) ([]byte, error) {
+	return fileSystem.ReadFile(name)
+}
+
+// WriteFile 写入文件
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	return fileSystem.WriteFile(name, data, perm)
+}
+
+// MkdirAll 创建目录
+func MkdirAll(name string, perm os.FileMode) error {
+	return fileSystem.MkdirAll(name, perm)
+}
+
+// Rename 移动文件
+func Rename(oldName, newName string) error {
+	return fileSystem.Rename(oldName, newName)
+}
+
+// Remove 删除文件
+func Remove(name string) error {
+	return fileSystem.Remove(name)
+}
+
+// FileExists 文件是否存在
+func FileExists(name string) bool {
+	_, err := fileSystem.Stat(name)
+	return err == nil
+}
+
+// BackupFile 将已存在的文件重命名为*.bak，已有备份时保留最初的备份
+func BackupFile(name string) error {
+	if !FileExists(name) || FileExists(name+".bak") {
+		return nil
+	}
+	return fileSystem.Rename(name, name+".bak")
+}
+
+// EditFile 读取文件内容，经edit修改后写回，保留原文件权限
+func EditFile(name string, edit func(content string) string) error {
+	info, err := fileSystem.Stat(name)
+	if err != nil {
+		return err
+	}
+	data, err := fileSystem.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	edited := edit(string(data))
+	if edited == string(data) {
+		return nil
+	}
+	return fileSystem.WriteFile(name, []byte(edited), info.Mode().Perm())
+}
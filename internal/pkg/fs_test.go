@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"errors"
+	"io/fs"
+	"testing"
+)
+
+func TestMemFSBackupFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    map[string]string
+		missing []string
+	}{
+		{
+			name:    "备份已存在的文件",
+			files:   map[string]string{"/etc/a.conf": "old"},
+			want:    map[string]string{"/etc/a.conf.bak": "old"},
+			missing: []string{"/etc/a.conf"},
+		},
+		{
+			name:  "已有备份时保留最初的备份",
+			files: map[string]string{"/etc/a.conf": "new", "/etc/a.conf.bak": "old"},
+			want:  map[string]string{"/etc/a.conf": "new", "/etc/a.conf.bak": "old"},
+		},
+		{
+			name:    "文件不存在时不做处理",
+			missing: []string{"/etc/a.conf", "/etc/a.conf.bak"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMemFS()
+			for name, data := range tt.files {
+				if err := m.WriteFile(name, []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			prev := HostFS()
+			SetFS(m)
+			defer SetFS(prev)
+
+			if err := BackupFile("/etc/a.conf"); err != nil {
+				t.Fatalf("BackupFile() error = %v", err)
+			}
+			for name, want := range tt.want {
+				got, err := m.ReadFile(name)
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q, %v, want %q", name, got, err, want)
+				}
+			}
+			for _, name := range tt.missing {
+				if _, err := m.Stat(name); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("%s should not exist, err = %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMemFSEditFileKeepsMode(t *testing.T) {
+	m := NewMemFS()
+	if err := m.WriteFile("/etc/fstab", []byte("a\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	prev := HostFS()
+	SetFS(m)
+	defer SetFS(prev)
+
+	if err := EditFile("/etc/fstab", func(content string) string { return content + "b\n" }); err != nil {
+		t.Fatalf("EditFile() error = %v", err)
+	}
+	got, _ := m.ReadFile("/etc/fstab")
+	if string(got) != "a\nb\n" {
+		t.Errorf("content = %q", got)
+	}
+	info, _ := m.Stat("/etc/fstab")
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+}
@@ -3,52 +3,16 @@ package pkg
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net/http"
-	"os"
 	"os/exec"
 	"os/user"
-	"sync"
+	"time"
 )
 
 // ExecCmd 执行系统命令
 func ExecCmd(cmd *exec.Cmd) error {
-	cmd.Stdin = os.Stdin
-
-	var wg sync.WaitGroup
-	wg.Add(2)
-
-	// 捕获标准输出
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		fmt.Println("INFO: ", err)
-		os.Exit(1)
-	}
-	readout := bufio.NewReader(stdout)
-	go func() {
-		defer wg.Done()
-		PrintOutput(readout)
-	}()
-
-	// 捕获标准错误
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		fmt.Println("ERROR: ", err)
-		os.Exit(1)
-	}
-	readerr := bufio.NewReader(stderr)
-	go func() {
-		defer wg.Done()
-		PrintOutput(readerr)
-	}()
-
-	// 执行命令
-	err = cmd.Run()
-	if err != nil {
-		return err
-	}
-	wg.Wait()
-
-	return nil
+	return runner.Run(cmd)
 }
 
 func PrintOutput(reader *bufio.Reader) {
@@ -88,6 +52,24 @@ func CheckNetworkFileExists(url string) bool {
 	}
 }
 
+// downloadClient 下载使用的客户端，上游不可达时避免长时间阻塞
+var downloadClient = &http.Client{Timeout: 30 * time.Second}
+
+// Download 下载网络文件内容
+func Download(url string) ([]byte, error) {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("下载%s失败: %w", url, err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载%s失败: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // IsRoot 是否为root用户
 func IsRoot() bool {
 	currentUser, err := user.Current()
@@ -0,0 +1,293 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// StepKind 执行步骤类型
+type StepKind string
+
+const (
+	StepExec   StepKind = "exec"   // 执行命令
+	StepWrite  StepKind = "write"  // 写入文件
+	StepMkdir  StepKind = "mkdir"  // 创建目录
+	StepRename StepKind = "rename" // 移动文件
+	StepRemove StepKind = "remove" // 删除文件
+)
+
+// Step 执行步骤
+type Step struct {
+	Kind    StepKind    // 步骤类型
+	Command string      // 命令行(exec)
+	Path    string      // 文件路径(write/mkdir/rename/remove)
+	NewPath string      // 目标路径(rename)
+	Data    []byte      // 文件内容(write)
+	Perm    os.FileMode // 文件权限(write/mkdir)
+}
+
+// String 步骤描述
+func (s Step) String() string {
+	switch s.Kind {
+	case StepWrite:
+		return fmt.Sprintf("write  %s (%04o, %d bytes)", s.Path, s.Perm.Perm(), len(s.Data))
+	case StepMkdir:
+		return fmt.Sprintf("mkdir  %s (%04o)", s.Path, s.Perm.Perm())
+	case StepRename:
+		return fmt.Sprintf("rename %s -> %s", s.Path, s.NewPath)
+	case StepRemove:
+		return "remove " + s.Path
+	default:
+		return "exec   " + s.Command
+	}
+}
+
+// Recorder 执行步骤记录器
+type Recorder interface {
+	Record(step Step)
+}
+
+// Runner 命令执行器，所有对主机执行的命令都应通过Runner进行，文件操作见FS
+type Runner interface {
+	// Run 执行命令，并将标准输出与标准错误实时打印
+	Run(cmd *exec.Cmd) error
+	// Output 执行命令并返回标准输出
+	Output(cmd *exec.Cmd) ([]byte, error)
+}
+
+// CommandLine 命令行字符串
+func CommandLine(cmd *exec.Cmd) string {
+	args := make([]string, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'$|&;<>*?\\") {
+			arg = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+		args = append(args, arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// localRunner 在本机执行
+type localRunner struct{}
+
+// NewLocalRunner 本机执行器
+func NewLocalRunner() Runner {
+	return localRunner{}
+}
+
+func (localRunner) Run(cmd *exec.Cmd) error {
+	cmd.Stdin = os.Stdin
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// 捕获标准输出
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	readout := bufio.NewReader(stdout)
+
+	// 捕获标准错误
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	readerr := bufio.NewReader(stderr)
+
+	// 执行命令
+	if err = cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		defer wg.Done()
+		PrintOutput(readout)
+	}()
+	go func() {
+		defer wg.Done()
+		PrintOutput(readerr)
+	}()
+	wg.Wait()
+
+	return cmd.Wait()
+}
+
+func (localRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	return cmd.Output()
+}
+
+// chrootRunner 在指定根目录下通过chroot执行命令
+type chrootRunner struct {
+	root string
+	next Runner
+}
+
+// NewChrootRunner chroot执行器，命令将在root目录下执行
+func NewChrootRunner(root string, next Runner) Runner {
+	return chrootRunner{root: root, next: next}
+}
+
+func (r chrootRunner) wrap(cmd *exec.Cmd) *exec.Cmd {
+	c := exec.Command("chroot", append([]string{r.root}, cmd.Args...)...)
+	c.Env = cmd.Env
+	c.Stdin = cmd.Stdin
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	return c
+}
+
+func (r chrootRunner) Run(cmd *exec.Cmd) error {
+	return r.next.Run(r.wrap(cmd))
+}
+
+func (r chrootRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	return r.next.Output(r.wrap(cmd))
+}
+
+// RecordingRunner 记录所有执行步骤，可选地交由下一级执行器真正执行
+type RecordingRunner struct {
+	mu    sync.Mutex
+	next  Runner
+	steps []Step
+}
+
+// NewRecordingRunner 记录执行器，next为nil时仅记录不执行
+func NewRecordingRunner(next Runner) *RecordingRunner {
+	return &RecordingRunner{next: next}
+}
+
+// Steps 已记录的步骤
+func (r *RecordingRunner) Steps() []Step {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Step(nil), r.steps...)
+}
+
+// Record 记录步骤
+func (r *RecordingRunner) Record(step Step) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.steps = append(r.steps, step)
+}
+
+func (r *RecordingRunner) Run(cmd *exec.Cmd) error {
+	r.Record(Step{Kind: StepExec, Command: CommandLine(cmd)})
+	if r.next == nil {
+		return nil
+	}
+	return r.next.Run(cmd)
+}
+
+func (r *RecordingRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	r.Record(Step{Kind: StepExec, Command: CommandLine(cmd)})
+	if r.next == nil {
+		return nil, nil
+	}
+	return r.next.Output(cmd)
+}
+
+// DryRunRunner 仅打印执行计划，不对主机做任何修改
+type DryRunRunner struct {
+	recorder *RecordingRunner
+	out      io.Writer
+}
+
+// dryRunPreviewLines 预演时输出的文件内容最大行数
+const dryRunPreviewLines = 200
+
+// NewDryRunRunner 预演执行器，按顺序将命令与文件操作计划输出到out
+func NewDryRunRunner(out io.Writer) *DryRunRunner {
+	return &DryRunRunner{recorder: NewRecordingRunner(nil), out: out}
+}
+
+// Record 记录并打印步骤
+func (r *DryRunRunner) Record(step Step) {
+	r.recorder.Record(step)
+	n := len(r.recorder.Steps())
+	_, _ = fmt.Fprintf(r.out, "[dry-run] %3d. %s\n", n, step)
+	// 二进制文件仅输出大小，较长的文件仅输出开头部分
+	if step.Kind == StepWrite && len(step.Data) > 0 && utf8.Valid(step.Data) && !bytes.ContainsRune(step.Data, 0) {
+		lines := strings.Split(strings.TrimRight(string(step.Data), "\n"), "\n")
+		for i, line := range lines {
+			if i == dryRunPreviewLines {
+				_, _ = fmt.Fprintf(r.out, "[dry-run]        | ... (省略%d行)\n", len(lines)-i)
+				break
+			}
+			_, _ = fmt.Fprintf(r.out, "[dry-run]        | %s\n", line)
+		}
+	}
+}
+
+func (r *DryRunRunner) Run(cmd *exec.Cmd) error {
+	r.Record(Step{Kind: StepExec, Command: CommandLine(cmd)})
+	return nil
+}
+
+func (r *DryRunRunner) Output(cmd *exec.Cmd) ([]byte, error) {
+	r.Record(Step{Kind: StepExec, Command: CommandLine(cmd)})
+	return nil, nil
+}
+
+var (
+	runner  Runner = NewLocalRunner()
+	dryRun  bool
+	rootDir string
+)
+
+// SetRunner 设置全局命令执行器
+func SetRunner(r Runner) {
+	runner = r
+}
+
+// GetRunner 当前全局命令执行器
+func GetRunner() Runner {
+	return runner
+}
+
+// SetRoot 将所有文件操作与命令执行限定在root目录下，用于制作离线镜像或chroot环境
+func SetRoot(root string) {
+	if root == "" || filepath.Clean(root) == "/" {
+		return
+	}
+	rootDir = filepath.Clean(root)
+	SetFS(NewOSFS(rootDir))
+	SetRunner(NewChrootRunner(rootDir, runner))
+}
+
+// Root 当前根目录，未设置时为/
+func Root() string {
+	if rootDir == "" {
+		return "/"
+	}
+	return rootDir
+}
+
+// EnableDryRun 开启预演模式，文件操作仅在内存中生效
+func EnableDryRun(out io.Writer) {
+	dryRun = true
+	r := NewDryRunRunner(out)
+	SetFS(NewDryRunFS(fileSystem, r))
+	if rootDir != "" {
+		SetRunner(NewChrootRunner(rootDir, r))
+	} else {
+		SetRunner(r)
+	}
+}
+
+// IsDryRun 是否为预演模式
+func IsDryRun() bool {
+	return dryRun
+}
+
+// CmdOutput 通过全局执行器执行命令并返回标准输出
+func CmdOutput(cmd *exec.Cmd) ([]byte, error) {
+	return runner.Output(cmd)
+}